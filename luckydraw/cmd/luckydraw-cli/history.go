@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/event"
+	"luckydraw/internal/live"
+	"luckydraw/internal/service"
+)
+
+func (e *env) runHistory(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("history 后面要跟 list / export / verify / notify")
+	}
+
+	switch args[0] {
+	case "list":
+		return e.runHistoryList(args[1:])
+	case "export":
+		return e.runHistoryExport(args[1:])
+	case "verify":
+		return e.runHistoryVerify(args[1:])
+	case "notify":
+		return e.runHistoryNotify(args[1:])
+	}
+	return fmt.Errorf("history 没有 %s 这个操作", args[0])
+}
+
+func (e *env) runHistoryList(args []string) error {
+	fs := flag.NewFlagSet("history list", flag.ExitOnError)
+	ref := fs.String("profile", "", "配置 ID 或名字，不写就用当前配置")
+	fs.Parse(args)
+
+	profile, err := e.findProfile(*ref)
+	if err != nil {
+		return err
+	}
+	raw, err := e.profile.GetHistory(profile.ID)
+	if err != nil {
+		return err
+	}
+	var history []config.HistoryRecord
+	if err := json.Unmarshal([]byte(raw), &history); err != nil {
+		return err
+	}
+
+	if e.jsonOut {
+		if history == nil {
+			history = []config.HistoryRecord{}
+		}
+		e.print(history, "")
+		return nil
+	}
+	if len(history) == 0 {
+		fmt.Println("还没有抽过奖")
+		return nil
+	}
+	for _, r := range history {
+		fmt.Printf("%s  %s  关键词 %q  %d 人参与，中奖 %d 人\n",
+			r.ID, r.Time.Format("2006-01-02 15:04"), r.Keyword, r.ParticipantCount, len(r.Winners))
+	}
+	return nil
+}
+
+func (e *env) runHistoryExport(args []string) error {
+	fs := flag.NewFlagSet("history export", flag.ExitOnError)
+	id := fs.String("id", "", "历史记录 ID")
+	out := fs.String("out", "", "导出到哪，不写就放在当前目录")
+	proof := fs.Bool("proof", false, "导出开奖证明（JSON）而不是 Markdown")
+	fs.Parse(args)
+
+	if *id == "" {
+		return fmt.Errorf("要给 --id 哦")
+	}
+	profileID, _, _, err := e.profile.LoadHistory(*id)
+	if err != nil {
+		return err
+	}
+
+	path := *out
+	if *proof {
+		if path == "" {
+			path = *id + ".proof.json"
+		}
+		path, err = e.profile.ExportDrawProof(profileID, *id, path)
+	} else {
+		if path == "" {
+			if path, err = e.profile.HistoryExportFilename(profileID, *id); err != nil {
+				return err
+			}
+		}
+		path, err = e.profile.ExportHistory(profileID, *id, path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
+
+func (e *env) runHistoryVerify(args []string) error {
+	fs := flag.NewFlagSet("history verify", flag.ExitOnError)
+	id := fs.String("id", "", "历史记录 ID")
+	fs.Parse(args)
+
+	if *id == "" {
+		return fmt.Errorf("要给 --id 哦")
+	}
+	profileID, _, _, err := e.profile.LoadHistory(*id)
+	if err != nil {
+		return err
+	}
+	raw, err := e.profile.VerifyHistory(profileID, *id)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		OK      bool    `json:"ok"`
+		Winners []int64 `json:"winners"`
+		Error   string  `json:"error,omitempty"`
+	}
+	json.Unmarshal([]byte(raw), &result)
+	if e.jsonOut {
+		e.print(result, "")
+	} else {
+		for i, uid := range result.Winners {
+			fmt.Printf("%3d. %d\n", i+1, uid)
+		}
+	}
+	if !result.OK {
+		return fmt.Errorf("校验失败: %s", result.Error)
+	}
+	if !e.jsonOut {
+		fmt.Println("校验通过")
+	}
+	return nil
+}
+
+// 每个人的结果由事件打出来，等这批发完再回头数一下
+func (e *env) runHistoryNotify(args []string) error {
+	fs := flag.NewFlagSet("history notify", flag.ExitOnError)
+	id := fs.String("id", "", "历史记录 ID")
+	fs.Parse(args)
+
+	if *id == "" {
+		return fmt.Errorf("要给 --id 哦")
+	}
+	raw, err := e.notice.NotifyWinners(*id)
+	if err != nil {
+		return err
+	}
+	var queued []event.WinnerNotice
+	json.Unmarshal([]byte(raw), &queued)
+	e.notice.Wait()
+
+	_, record, _, err := e.profile.LoadHistory(*id)
+	if err != nil {
+		return err
+	}
+	waiting := map[int64]bool{}
+	for _, q := range queued {
+		waiting[q.UID] = true
+	}
+	sent, failed := 0, 0
+	for _, w := range record.Winners {
+		if !waiting[w.UID] || w.Forfeited {
+			continue
+		}
+		switch {
+		case w.Notice != nil && w.Notice.Sent:
+			sent++
+		case !live.IsOpenUID(w.UID):
+			// 开放平台的人再跑也发不了，事件里已经说过了
+			failed++
+		}
+	}
+	if !e.jsonOut {
+		if len(queued) == 0 {
+			fmt.Println("没有要私信的人了")
+		} else {
+			fmt.Printf("私信了 %d 人，失败 %d 人\n", sent, failed)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("有 %d 人没发出去，过一会儿再跑一次会接着发", failed)
+	}
+	return nil
+}
+
+func (e *env) runRecordings() error {
+	raw, err := e.profile.GetRecordings()
+	if err != nil {
+		return err
+	}
+	var recordings []service.RecordingInfo
+	if err := json.Unmarshal([]byte(raw), &recordings); err != nil {
+		return err
+	}
+	if e.jsonOut {
+		e.print(recordings, "")
+		return nil
+	}
+	if len(recordings) == 0 {
+		fmt.Println("还没有录像，配置里开启录像或者用 --record")
+		return nil
+	}
+	for _, r := range recordings {
+		fmt.Printf("%s  %s  %d KB\n", r.Name, r.Time.Format("2006-01-02 15:04"), (r.Size+1023)/1024)
+	}
+	return nil
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	bundlePath := fs.String("bundle", "", "开奖记录导出的校验文件（JSON）")
+	fs.Parse(args)
+
+	if *bundlePath == "" {
+		return fmt.Errorf("usage: luckydraw-cli verify --bundle draw.json")
+	}
+
+	data, err := os.ReadFile(*bundlePath)
+	if err != nil {
+		return err
+	}
+
+	var bundle live.VerifyBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("看不懂这个文件: %v", err)
+	}
+
+	winners, err := bundle.Verify()
+	fmt.Printf("算法:     %s\n", bundle.Proof.Algorithm)
+	fmt.Printf("承诺:     %s\n", bundle.Proof.Commitment)
+	fmt.Printf("名单哈希: %s\n", bundle.Proof.SnapshotHash)
+	fmt.Printf("参与人数: %d\n", len(bundle.Participants))
+	for _, t := range bundle.Tiers {
+		fmt.Printf("%s: %d 名，%d 人有资格，名单哈希 %s\n", t.Name, t.Count, len(t.Participants), t.Proof.SnapshotHash)
+	}
+	for i, uid := range winners {
+		fmt.Printf("%3d. %d\n", i+1, uid)
+	}
+	if err != nil {
+		return fmt.Errorf("校验失败: %v", err)
+	}
+	fmt.Println("校验通过")
+	return nil
+}
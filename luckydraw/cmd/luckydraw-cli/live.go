@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/live"
+	"luckydraw/internal/service"
+)
+
+type roomList []int
+
+func (r *roomList) String() string {
+	return fmt.Sprint([]int(*r))
+}
+
+func (r *roomList) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id <= 0 {
+			return fmt.Errorf("房间号不对: %s", part)
+		}
+		*r = append(*r, id)
+	}
+	return nil
+}
+
+type liveFlags struct {
+	rooms    roomList
+	keyword  string
+	regex    string
+	profile  string
+	record   bool
+	announce bool
+	replay   string
+	speed    float64
+	open     bool
+	code     string
+	window   config.LotteryWindow
+}
+
+func (f *liveFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.rooms, "room", "直播间号，可以写多次或用逗号隔开")
+	fs.StringVar(&f.keyword, "keyword", "", "参与关键词，不写就用配置里的")
+	fs.StringVar(&f.regex, "regex", "", "用正则匹配弹幕，盖掉配置里的关键词")
+	fs.StringVar(&f.profile, "profile", "", "配置 ID 或名字，不写就用当前配置")
+	fs.BoolVar(&f.record, "record", false, "把收到的弹幕录下来（配置里开了录像也会录）")
+	fs.BoolVar(&f.announce, "announce", false, "开完奖把中奖名单发到直播间弹幕（配置里开了也会发）")
+	fs.StringVar(&f.replay, "replay", "", "不连直播间，回放一个录像文件")
+	fs.Float64Var(&f.speed, "speed", 1, "回放倍速，0 表示一口气放完")
+	fs.BoolVar(&f.open, "open", false, "走开放平台互动玩法，用 open-platform 里存的 key")
+	fs.StringVar(&f.code, "code", "", "主播身份码，不写就用存着的")
+}
+
+func (e *env) startLive(f *liveFlags) (config.ProfileConfig, error) {
+	profile, err := e.findProfile(f.profile)
+	if err != nil {
+		return profile, err
+	}
+
+	rooms := []int(f.rooms)
+	if len(rooms) == 0 {
+		rooms = profile.WatchedRooms
+	}
+	if len(rooms) == 0 && f.replay == "" && !f.open {
+		return profile, fmt.Errorf("先看几个直播呢？用 --room 指定直播间")
+	}
+	if f.record {
+		profile.RecordSessions = true
+	}
+	if f.announce {
+		profile.Announce = true
+	}
+	// 命令行给了就只按命令行的来，归一化和排除词还用配置里的
+	switch {
+	case f.regex != "":
+		profile.Match.Mode, profile.Match.Keywords, profile.Match.Pattern = live.MatchRegex, nil, f.regex
+	case f.keyword != "":
+		if profile.Match.Mode == live.MatchRegex {
+			profile.Match.Mode = ""
+		}
+		profile.Match.Keywords, profile.Match.Pattern = []string{f.keyword}, ""
+	}
+	keyword := profile.Keyword
+	matcher, err := live.NewMatcher(service.ProfileMatch(keyword, profile))
+	if err != nil {
+		return profile, err
+	}
+
+	if err := e.overlay.Attach(e.live); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else if !e.jsonOut {
+		var settings struct {
+			URL string `json:"url"`
+		}
+		raw, _ := e.overlay.GetOverlaySettings()
+		json.Unmarshal([]byte(raw), &settings)
+		if settings.URL != "" {
+			fmt.Println("OBS 叠加层:", settings.URL)
+		}
+	}
+
+	if f.replay != "" {
+		if err := e.live.ConnectReplay(f.replay, f.speed); err != nil {
+			return profile, err
+		}
+	} else if f.open {
+		settings := e.auth.OpenPlatform()
+		if f.code != "" {
+			settings.IdentityCode = f.code
+		}
+		if err := e.live.ConnectOpenPlatform(settings); err != nil {
+			return profile, err
+		}
+	} else if err := e.live.ConnectProfileRooms(rooms, profile); err != nil {
+		return profile, err
+	}
+	if err := e.live.StartLotteryWindow(keyword, profile, f.window); err != nil {
+		return profile, err
+	}
+	if e.jsonOut {
+		return profile, nil
+	}
+	if f.replay != "" {
+		fmt.Printf("正在回放 %s（%gx），关键词: %q\n", f.replay, f.speed, matcher.String())
+	} else if f.open {
+		fmt.Printf("正在通过开放平台监听，关键词: %q\n", matcher.String())
+	} else {
+		fmt.Printf("正在监听 %v，关键词: %q\n", rooms, matcher.String())
+	}
+	return profile, nil
+}
+
+func (e *env) runWatch(args []string) error {
+	var f liveFlags
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	f.register(fs)
+	duration := fs.Duration("duration", 0, "收多久自动停，不写就一直收")
+	until := fs.String("until", "", "几点自动停，21:30 或者 RFC3339 的完整时间")
+	fs.BoolVar(&f.window.AutoDraw, "auto-draw", false, "到点直接开奖，配了奖项就按奖项开")
+	fs.Parse(args)
+
+	f.window.DurationSeconds = int(duration.Seconds())
+	if *until != "" {
+		end, err := parseUntil(*until, time.Now())
+		if err != nil {
+			return err
+		}
+		f.window.EndAt = end
+	}
+
+	profile, err := e.startLive(&f)
+	if err != nil {
+		return err
+	}
+	defer e.live.Stop()
+	defer e.overlay.Stop()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-sig:
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				// 标准输入关了就一直听到被杀掉
+				lines = nil
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "draw":
+				count := 0
+				if len(fields) > 1 {
+					count, _ = strconv.Atoi(fields[1])
+				}
+				if err := e.drawAndPrint(profile, count); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			case "count":
+				n := e.live.GetParticipantCount()
+				e.print(map[string]int{"participants": n}, fmt.Sprintf("当前 %d 人参与", n))
+			case "rooms":
+				if err := e.printRooms(); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			case "stop":
+				if err := e.live.StopLiveLottery(); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			case "quit", "exit":
+				return nil
+			default:
+				fmt.Fprintln(os.Stderr, "看不懂，可以输入: draw [人数] / count / rooms / stop / quit（draw 不写人数就按配置的奖项开）")
+			}
+		}
+	}
+}
+
+func (e *env) printRooms() error {
+	raw, err := e.live.GetRoomStatuses()
+	if err != nil {
+		return err
+	}
+	var statuses []live.RoomStatus
+	if err := json.Unmarshal([]byte(raw), &statuses); err != nil {
+		return err
+	}
+	if e.jsonOut {
+		e.print(statuses, "")
+		return nil
+	}
+	for _, st := range statuses {
+		state := "未连接"
+		if st.Connected {
+			state = "已连接 " + st.Host
+		}
+		fmt.Printf("%d (%d) %s  %s  在线 %d  重连 %d 次", st.RoomID, st.RealRoomID, st.Title, state, st.Online, st.ReconnectAttempts)
+		if !st.LastMessage.IsZero() {
+			fmt.Printf("  最后消息 %s", st.LastMessage.Format("15:04:05"))
+		}
+		if st.LastError != "" {
+			fmt.Printf("  最近错误: %s", st.LastError)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func (e *env) runDraw(args []string) error {
+	var f liveFlags
+	fs := flag.NewFlagSet("draw", flag.ExitOnError)
+	f.register(fs)
+	count := fs.Int("count", 0, "中奖人数，不写就用配置里的奖项或人数")
+	duration := fs.Duration("duration", 0, "收集多久，不写就等回车或 Ctrl+C")
+	fs.Parse(args)
+
+	profile, err := e.startLive(&f)
+	if err != nil {
+		return err
+	}
+	defer e.live.Stop()
+	defer e.overlay.Stop()
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	if *duration > 0 {
+		if !e.jsonOut {
+			fmt.Printf("%s 后开奖\n", duration.String())
+		}
+		select {
+		case <-time.After(*duration):
+		case <-done:
+		}
+	} else {
+		if !e.jsonOut {
+			fmt.Println("收集中，回车或 Ctrl+C 开奖")
+		}
+		go func() {
+			bufio.NewReader(os.Stdin).ReadString('\n')
+			done <- os.Interrupt
+		}()
+		<-done
+	}
+	signal.Stop(done)
+
+	if err := e.live.StopLiveLottery(); err != nil {
+		return err
+	}
+	return e.drawAndPrint(profile, *count)
+}
+
+// drawAndPrint 没给人数的话，配置里有奖项就按奖项开，没有就按配置的人数
+func (e *env) drawAndPrint(profile config.ProfileConfig, count int) error {
+	var err error
+	switch {
+	case count > 0:
+		_, err = e.live.DrawWinners(count)
+	case len(profile.Prizes) > 0:
+		_, err = e.live.DrawPrizes(profile.Prizes)
+	default:
+		_, err = e.live.DrawWinners(max(profile.WinnerCount, 1))
+	}
+	// 历史没存上的时候人还是抽出来了，先把名单打出来再报错
+	if err != nil && !errors.Is(err, service.ErrHistoryNotSaved) {
+		return err
+	}
+	draw := e.live.LastDraw()
+	if draw == nil {
+		return fmt.Errorf("没抽出来喵")
+	}
+	if e.jsonOut {
+		e.print(map[string]any{"winners": draw.Winners, "proof": draw.Proof}, "")
+		return err
+	}
+
+	fmt.Printf("%d 人参与，抽出 %d 人:\n", draw.Proof.Participants, len(draw.Winners))
+	if len(draw.Tiers) == 0 {
+		printWinners(draw.Winners)
+	}
+	for _, t := range draw.Tiers {
+		fmt.Printf("%s（%d 名，%d 人有资格）:\n", t.Name, t.Quantity, t.Proof.Participants)
+		printWinners(t.Winners)
+	}
+	fmt.Printf("种子: %s\n", draw.Proof.Seed)
+	return err
+}
+
+func printWinners(winners []*live.DanmakuUser) {
+	for i, w := range winners {
+		fmt.Printf("%3d. %s (UID: %d)\n", i+1, w.Username, w.UID)
+	}
+}
+
+// parseUntil 只给时分就是今天的这个点
+func parseUntil(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("15:04", v, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("看不懂的时间: %s", v)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location()), nil
+}
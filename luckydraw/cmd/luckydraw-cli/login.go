@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"luckydraw/internal/login"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var qrPollInterval = 2 * time.Second
+
+func (e *env) runLoginQR() error {
+	qrLogin := login.NewQRLogin()
+	info, err := qrLogin.GetQRCode()
+	if err != nil {
+		return fmt.Errorf("老大咱码没了喵: %v", err)
+	}
+
+	qr, err := qrcode.New(info.URL, qrcode.Low)
+	if err != nil {
+		return err
+	}
+	fmt.Print(qr.ToSmallString(false))
+	fmt.Println("用 B 站 App 扫一下，扫不出来就打开:", info.URL)
+
+	scanned := false
+	for {
+		time.Sleep(qrPollInterval)
+		// 走服务层，refresh_token 才能跟着存下来
+		raw, err := e.auth.CheckQRCodeStatus(info.QrcodeKey)
+		if err != nil {
+			return err
+		}
+		var status login.QRCodeStatus
+		if err := json.Unmarshal([]byte(raw), &status); err != nil {
+			return err
+		}
+		if status.Code != 0 {
+			return fmt.Errorf("验牌失败了: %s", status.Message)
+		}
+
+		switch status.Data.Code {
+		case 0:
+			msg, err := e.auth.LoginWithQRCode(status.Cookie)
+			if err != nil {
+				return err
+			}
+			fmt.Println(msg)
+			return nil
+		case 86090:
+			if !scanned {
+				scanned = true
+				fmt.Println("扫到了，在手机上点一下确认")
+			}
+		case 86038:
+			return fmt.Errorf("码过期了，再来一次吧")
+		case 86101:
+		default:
+			return fmt.Errorf("验牌失败了: %s", status.Data.Message)
+		}
+	}
+}
+
+func (e *env) runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	cookie := fs.String("cookie", "", "浏览器里复制的 Cookie")
+	fs.Parse(args)
+
+	if *cookie == "" {
+		*cookie = os.Getenv("LUCKYDRAW_COOKIE")
+	}
+	msg, err := e.auth.Login(*cookie)
+	if err != nil {
+		return err
+	}
+	fmt.Println(msg)
+	return nil
+}
+
+func (e *env) runWhoami() error {
+	raw, err := e.auth.GetAccountInfo()
+	if err != nil {
+		return err
+	}
+	var info struct {
+		Name string `json:"name"`
+		UID  int64  `json:"uid"`
+	}
+	json.Unmarshal([]byte(raw), &info)
+	e.print(info, fmt.Sprintf("%s (UID: %d)", info.Name, info.UID))
+	return nil
+}
+
+func (e *env) runOpenPlatform(args []string) error {
+	current := e.auth.OpenPlatform()
+	fs := flag.NewFlagSet("open-platform", flag.ExitOnError)
+	keyID := fs.String("key-id", current.AccessKeyID, "开放平台 access_key_id")
+	secret := fs.String("key-secret", "", "开放平台 access_key_secret，不写就沿用之前的")
+	appID := fs.Int64("app-id", current.AppID, "互动玩法的项目 ID")
+	code := fs.String("code", current.IdentityCode, "主播身份码")
+	fs.Parse(args)
+
+	if fs.NFlag() == 0 {
+		raw, err := e.auth.GetOpenPlatformSettings()
+		if err != nil {
+			return err
+		}
+		fmt.Println(raw)
+		return nil
+	}
+	raw, err := e.auth.SaveOpenPlatformSettings(*keyID, *secret, *appID, *code)
+	if err != nil {
+		return err
+	}
+	fmt.Println(raw)
+	return nil
+}
+
+func (e *env) runAccounts(args []string) error {
+	if len(args) == 0 {
+		raw, err := e.auth.GetAccounts()
+		if err != nil {
+			return err
+		}
+		var list struct {
+			Accounts []struct {
+				UID      int64  `json:"uid"`
+				Name     string `json:"name"`
+				LoggedIn bool   `json:"logged_in"`
+			} `json:"accounts"`
+			ActiveAccount int64 `json:"active_account"`
+		}
+		json.Unmarshal([]byte(raw), &list)
+		if e.jsonOut {
+			e.print(list, "")
+			return nil
+		}
+		if len(list.Accounts) == 0 {
+			fmt.Println("一个号都没登，先 login-qr 吧")
+		}
+		for _, account := range list.Accounts {
+			mark := " "
+			if account.UID == list.ActiveAccount {
+				mark = "*"
+			}
+			state := ""
+			if !account.LoggedIn {
+				state = "（登录失效）"
+			}
+			fmt.Printf("%s %d  %s%s\n", mark, account.UID, account.Name, state)
+		}
+		return nil
+	}
+
+	fs := flag.NewFlagSet("accounts "+args[0], flag.ExitOnError)
+	ref := fs.String("profile", "", "配置 ID 或名字，不写就用当前配置")
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		return fmt.Errorf("用法: accounts switch|remove|bind UID")
+	}
+	uid, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("UID 不对: %s", fs.Arg(0))
+	}
+
+	switch args[0] {
+	case "switch":
+		if _, err := e.auth.SwitchAccount(uid); err != nil {
+			return err
+		}
+		fmt.Println("切过去了")
+	case "remove":
+		if err := e.auth.RemoveAccount(uid); err != nil {
+			return err
+		}
+		fmt.Println("删掉了")
+	case "bind":
+		profile, err := e.findProfile(*ref)
+		if err != nil {
+			return err
+		}
+		if uid != 0 {
+			if _, err := e.auth.ClientFor(uid); err != nil {
+				return err
+			}
+		}
+		if err := e.profile.BindAccount(profile.ID, uid); err != nil {
+			return err
+		}
+		if uid == 0 {
+			fmt.Printf("%s 跟着当前账号走\n", profile.Name)
+		} else {
+			fmt.Printf("%s 以后用 %d 连直播间\n", profile.Name, uid)
+		}
+	default:
+		return fmt.Errorf("用法: accounts switch|remove|bind UID")
+	}
+	return nil
+}
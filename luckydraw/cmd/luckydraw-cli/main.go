@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/event"
+	"luckydraw/internal/live"
+	"luckydraw/internal/service"
+)
+
+const usage = `luckydraw-cli — 不开窗口也能抽奖
+
+用法:
+  luckydraw-cli login-qr                       终端扫码登录
+  luckydraw-cli login --cookie "SESSDATA=..."  用 Cookie 登录
+  luckydraw-cli whoami                         看看登的是谁
+  luckydraw-cli logout                         退出当前账号
+  luckydraw-cli accounts                       列出存着的账号，再登一个就是加一个号
+  luckydraw-cli accounts switch|remove UID     切换 / 删掉账号
+  luckydraw-cli accounts bind [--profile P] UID
+                                               配置固定用这个号连直播间，UID 写 0 就跟着当前账号
+  luckydraw-cli refresh                        用扫码时存下的 refresh_token 换一套新 Cookie
+  luckydraw-cli open-platform [--key-id K --key-secret S --app-id N --code C]
+                                               看 / 改开放平台互动玩法的设置
+  luckydraw-cli watch --room N [--room M] [--keyword K | --regex R]
+                                               监听弹幕，标准输入 draw [n] / count / rooms / quit
+  luckydraw-cli watch ... [--duration 10m | --until 21:30] [--auto-draw]
+                                               到点自动停止收人，--auto-draw 顺手按配置开奖
+  luckydraw-cli draw --room N --count 3 [--keyword K] [--duration 5m]
+                                               收集一段时间后直接开奖并写入历史，
+                                               不写 --count 就按配置里的奖项依次开
+  luckydraw-cli watch|draw ... --announce      开完奖用登录的号把中奖名单发到直播间弹幕
+  luckydraw-cli watch --replay 录像.jsonl.gz [--speed 10]
+                                               回放录像，draw 同理；加 --record 会把直播录下来
+  luckydraw-cli watch --open [--code 身份码]    不登录，走开放平台互动玩法收弹幕，draw 同理
+  luckydraw-cli recordings                     列出录像
+  luckydraw-cli history list [--profile ID]    列出历史记录
+  luckydraw-cli history export --id ID [--out file.md]
+  luckydraw-cli history verify --id ID         重新校验一次开奖
+  luckydraw-cli history notify --id ID         按配置的模板私信中奖者，发过的不重发
+  luckydraw-cli verify --bundle draw.json      校验导出的开奖证明
+
+数据目录和桌面版共用 ~/.luckydraw，可以用 --home 或 LUCKYDRAW_HOME 换一个。
+登录信息加密保存，密钥放在系统钥匙串里；没有钥匙串的服务器上设置 LUCKYDRAW_PASSPHRASE 用口令加密。
+桌面版里打开了 OBS 叠加层的话，watch / draw 也会把它一起开起来。
+`
+
+type env struct {
+	configPath string
+	statePath  string
+	auth       *service.AuthService
+	profile    *service.ProfileService
+	live       *service.LiveLotteryService
+	overlay    *service.OverlayService
+	notice     *service.NoticeService
+	state      *config.RuntimeState
+	jsonOut    bool
+}
+
+func main() {
+	args := os.Args[1:]
+	home := os.Getenv("LUCKYDRAW_HOME")
+	jsonOut := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch {
+		case args[0] == "--json" || args[0] == "-json":
+			jsonOut = true
+			args = args[1:]
+		case (args[0] == "--home" || args[0] == "-home") && len(args) > 1:
+			home = args[1]
+			args = args[2:]
+		default:
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if args[0] == "verify" {
+		exit(runVerify(args[1:]))
+	}
+
+	e, err := newEnv(home)
+	if err != nil {
+		exit(err)
+	}
+	e.jsonOut = jsonOut
+
+	switch args[0] {
+	case "login-qr":
+		err = e.runLoginQR()
+	case "login":
+		err = e.runLogin(args[1:])
+	case "accounts":
+		err = e.runAccounts(args[1:])
+	case "whoami":
+		err = e.runWhoami()
+	case "logout":
+		err = e.auth.Logout()
+	case "refresh":
+		var msg string
+		if msg, err = e.auth.RefreshCookie(); err == nil {
+			fmt.Println(msg)
+		}
+	case "open-platform":
+		err = e.runOpenPlatform(args[1:])
+	case "watch":
+		err = e.runWatch(args[1:])
+	case "draw":
+		err = e.runDraw(args[1:])
+	case "history":
+		err = e.runHistory(args[1:])
+	case "recordings":
+		err = e.runRecordings()
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	exit(err)
+}
+
+func newEnv(home string) (*env, error) {
+	if home == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		home = filepath.Join(userHome, ".luckydraw")
+	}
+
+	e := &env{
+		configPath: filepath.Join(home, "config.json"),
+		statePath:  filepath.Join(home, "state.json"),
+	}
+	cfg, err := config.LoadConfig(e.configPath)
+	if err != nil {
+		if cfg == nil {
+			return nil, err
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+	state, _ := config.LoadRuntimeState(e.statePath)
+	e.state = state
+
+	e.overlay = service.NewOverlayService(cfg, e.configPath)
+	emitter := event.Multi{&stdoutEmitter{json: &e.jsonOut}, e.overlay}
+	e.auth = service.NewAuthService(cfg, e.configPath)
+	// 命令行没界面要等，账号检查完再干活
+	e.auth.Wait()
+	e.profile = service.NewProfileService(state, e.statePath, emitter)
+	e.live = service.NewLiveLotteryService(emitter, e.auth.ClientFor, e.profile)
+	e.notice = service.NewNoticeService(emitter, e.auth.ClientFor, e.profile)
+	return e, nil
+}
+
+// 按 ID 或名字找配置，不给就用当前配置；不会改桌面版的当前配置
+func (e *env) findProfile(ref string) (config.ProfileConfig, error) {
+	if ref == "" {
+		if active := e.profile.ActiveProfile(); active != nil {
+			return *active, nil
+		}
+		return config.ProfileConfig{}, fmt.Errorf("一个配置都没有喵")
+	}
+	for _, p := range e.state.Profiles {
+		if p.ID == ref || p.Name == ref {
+			return p, nil
+		}
+	}
+	return config.ProfileConfig{}, fmt.Errorf("没有这个配置喵: %s", ref)
+}
+
+func (e *env) print(v any, text string) {
+	if e.jsonOut {
+		data, _ := json.Marshal(v)
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Println(text)
+}
+
+type stdoutEmitter struct {
+	json *bool
+}
+
+func (s *stdoutEmitter) Emit(name string, data ...any) bool {
+	if *s.json {
+		payload := any(nil)
+		if len(data) == 1 {
+			payload = data[0]
+		} else if len(data) > 1 {
+			payload = data
+		}
+		line, _ := json.Marshal(map[string]any{"event": name, "data": payload})
+		fmt.Println(string(line))
+		return true
+	}
+
+	switch name {
+	case event.LiveUserJoin:
+		if user, ok := data[0].(*live.DanmakuUser); ok {
+			fmt.Printf("+ %s (%d) @%d %s\n", user.Username, user.UID, user.RoomID, joinDetail(user))
+		}
+	case event.LiveUserReject:
+		if r, ok := data[0].(*live.Rejection); ok {
+			fmt.Printf("- %s (%d) @%d %s\n", r.Username, r.UID, r.RoomID, r.Message)
+		}
+	case event.LiveLotteryStarted:
+		if e, ok := data[0].(event.LotteryStarted); ok {
+			fmt.Printf("种子承诺: %s (%s)\n", e.Commitment, e.Algorithm)
+		}
+	case event.LiveCountdown:
+		// 每秒一条太吵，整分钟和最后十秒说一声
+		if e, ok := data[0].(event.Countdown); ok && (e.Remaining%60 == 0 || e.Remaining <= 10) {
+			if e.Remaining == 0 {
+				fmt.Println("时间到，停止收人")
+			} else {
+				fmt.Printf("还剩 %s\n", time.Duration(e.Remaining)*time.Second)
+			}
+		}
+	case event.LiveDrawCompleted:
+		if e, ok := data[0].(event.DrawCompleted); ok && e.Auto {
+			if e.Error != "" {
+				fmt.Fprintf(os.Stderr, "自动开奖出问题了: %s\n", e.Error)
+			}
+			if e.Error != "" && len(e.Winners) == 0 {
+				break
+			}
+			fmt.Printf("自动开奖：%d 人参与，抽出 %d 人:\n", e.Participants, len(e.Winners))
+			for i, w := range e.Winners {
+				if w.Prize != "" {
+					fmt.Printf("%3d. [%s] %s (UID: %d)\n", i+1, w.Prize, w.Username, w.UID)
+				} else {
+					fmt.Printf("%3d. %s (UID: %d)\n", i+1, w.Username, w.UID)
+				}
+			}
+		}
+	case event.LiveAnnounce:
+		if e, ok := data[0].(event.Announcement); ok {
+			switch {
+			case e.RoomID == 0:
+				fmt.Fprintf(os.Stderr, "中奖弹幕没发: %s\n", e.Error)
+			case e.OK:
+				fmt.Printf("[%d] 弹幕 %d/%d 已发送: %s\n", e.RoomID, e.Index, e.Total, e.Message)
+			default:
+				fmt.Fprintf(os.Stderr, "[%d] 弹幕 %d/%d 没发出去: %s（%s）\n", e.RoomID, e.Index, e.Total, e.Message, e.Error)
+			}
+		}
+	case event.LiveWinnerNotified:
+		if e, ok := data[0].(event.WinnerNotice); ok {
+			if e.Sent {
+				fmt.Printf("已私信 %s (UID: %d)\n", e.Username, e.UID)
+			} else {
+				fmt.Fprintf(os.Stderr, "私信 %s (UID: %d) 失败，试了 %d 次: %s\n", e.Username, e.UID, e.Attempts, e.Error)
+			}
+		}
+	case event.RoomConnected:
+		if e, ok := data[0].(event.RoomConnection); ok {
+			fmt.Printf("[%d] 已连接 %s\n", e.RoomID, e.Host)
+		}
+	case event.RoomDisconnected:
+		if e, ok := data[0].(event.RoomDisconnection); ok {
+			fmt.Printf("[%d] 断开了: %s\n", e.RoomID, e.Error)
+		}
+	case event.RoomReconnecting:
+		if e, ok := data[0].(event.RoomReconnect); ok {
+			fmt.Printf("[%d] %dms 后第 %d 次重连\n", e.RoomID, e.DelayMS, e.Attempt)
+		}
+	case event.RoomAuthFailed:
+		if e, ok := data[0].(event.RoomAuthFailure); ok {
+			fmt.Printf("[%d] %s\n", e.RoomID, e.Error)
+		}
+	}
+	return true
+}
+
+func joinDetail(user *live.DanmakuUser) string {
+	if user.Detail != "" {
+		return user.Detail
+	}
+	return user.Message
+}
+
+func exit(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -16,6 +16,8 @@ type AppService struct {
 	auth    *service.AuthService
 	live    *service.LiveLotteryService
 	profile *service.ProfileService
+	overlay *service.OverlayService
+	notice  *service.NoticeService
 	app     *application.App
 }
 
@@ -32,11 +34,16 @@ func (a *AppService) ServiceStartup(ctx context.Context, options application.Ser
 	state, _ := config.LoadRuntimeState(statePath)
 
 	a.app = application.Get()
-	emitter := &wailsEmitter{app: a.app}
+	a.overlay = service.NewOverlayService(cfg, configPath)
+	emitter := event.Multi{&wailsEmitter{app: a.app}, a.overlay}
 
 	a.auth = service.NewAuthService(cfg, configPath)
-	a.live = service.NewLiveLotteryService(emitter, a.auth.Client)
 	a.profile = service.NewProfileService(state, statePath, emitter)
+	a.live = service.NewLiveLotteryService(emitter, a.auth.ClientFor, a.profile)
+	a.notice = service.NewNoticeService(emitter, a.auth.ClientFor, a.profile)
+	if err := a.overlay.Attach(a.live); err != nil {
+		a.app.Logger.Warn("overlay server not started", "error", err)
+	}
 	return nil
 }
 
@@ -44,6 +51,12 @@ func (a *AppService) ServiceShutdown() error {
 	if a.live != nil {
 		a.live.Stop()
 	}
+	if a.overlay != nil {
+		a.overlay.Stop()
+	}
+	if a.notice != nil {
+		a.notice.Stop()
+	}
 	return nil
 }
 
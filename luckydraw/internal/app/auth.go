@@ -24,7 +24,31 @@ func (a *AppService) GetAccountInfo() (string, error) {
 	return a.auth.GetAccountInfo()
 }
 
+func (a *AppService) RefreshCookie() (string, error) {
+	return a.auth.RefreshCookie()
+}
+
 func (a *AppService) Logout() error {
 	a.live.Stop()
 	return a.auth.Logout()
 }
+
+func (a *AppService) GetAccounts() (string, error) {
+	return a.auth.GetAccounts()
+}
+
+func (a *AppService) SwitchAccount(uid int64) (string, error) {
+	return a.auth.SwitchAccount(uid)
+}
+
+func (a *AppService) RemoveAccount(uid int64) error {
+	return a.auth.RemoveAccount(uid)
+}
+
+func (a *AppService) GetOpenPlatformSettings() (string, error) {
+	return a.auth.GetOpenPlatformSettings()
+}
+
+func (a *AppService) SaveOpenPlatformSettings(accessKeyID, accessKeySecret string, appID int64, identityCode string) (string, error) {
+	return a.auth.SaveOpenPlatformSettings(accessKeyID, accessKeySecret, appID, identityCode)
+}
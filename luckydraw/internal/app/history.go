@@ -12,6 +12,31 @@ func (a *AppService) DeleteAllHistory(profileID string) error {
 	return a.profile.DeleteAllHistory(profileID)
 }
 
+func (a *AppService) GetHistorySnapshot(profileID, historyID string) (string, error) {
+	return a.profile.GetHistorySnapshot(profileID, historyID)
+}
+
+func (a *AppService) VerifyHistory(profileID, historyID string) (string, error) {
+	return a.profile.VerifyHistory(profileID, historyID)
+}
+
+func (a *AppService) ExportDrawProof(profileID, historyID string) (string, error) {
+	dialog := a.app.Dialog.SaveFile().
+		SetMessage("导出开奖校验文件").
+		SetFilename(historyID+"-proof.json").
+		AddFilter("JSON", "*.json")
+
+	path, err := dialog.PromptForSingleSelection()
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", nil
+	}
+
+	return a.profile.ExportDrawProof(profileID, historyID, path)
+}
+
 func (a *AppService) ExportHistory(profileID, historyID string) (string, error) {
 	filename, err := a.profile.HistoryExportFilename(profileID, historyID)
 	if err != nil {
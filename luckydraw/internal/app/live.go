@@ -1,17 +1,33 @@
 package app
 
-import (
-	"encoding/json"
-
-	"luckydraw/internal/config"
-)
+import "luckydraw/internal/config"
 
 func (a *AppService) ConnectLiveRooms(roomIDs []int) error {
 	return a.live.ConnectLiveRooms(roomIDs)
 }
 
+func (a *AppService) ConnectReplay(path string, speed float64) error {
+	return a.live.ConnectReplay(path, speed)
+}
+
+func (a *AppService) ConnectOpenPlatform() error {
+	return a.live.ConnectOpenPlatform(a.auth.OpenPlatform())
+}
+
 func (a *AppService) StartLiveLottery(keyword string) error {
-	return a.live.StartLiveLottery(keyword)
+	return a.StartLotteryWindow(keyword, config.LotteryWindow{})
+}
+
+func (a *AppService) StartLotteryWindow(keyword string, window config.LotteryWindow) error {
+	var profile config.ProfileConfig
+	if active := a.profile.ActiveProfile(); active != nil {
+		profile = *active
+	}
+	return a.live.StartLotteryWindow(keyword, profile, window)
+}
+
+func (a *AppService) GetLotteryWindow() (string, error) {
+	return a.live.GetLotteryWindow()
 }
 
 func (a *AppService) StopLiveLottery() error {
@@ -19,25 +35,53 @@ func (a *AppService) StopLiveLottery() error {
 }
 
 func (a *AppService) DrawWinners(count int) (string, error) {
-	result, err := a.live.DrawWinners(count)
-	if err != nil {
-		return "", err
-	}
+	return a.live.DrawWinners(count)
+}
 
-	var winners []config.HistoryWinner
-	if err := json.Unmarshal([]byte(result), &winners); err == nil {
-		profile := a.profile.ActiveProfile()
-		if profile != nil {
-			_ = a.profile.AddHistory(profile.ID, profile.Keyword, count, winners)
-		}
+func (a *AppService) DrawPrizes() (string, error) {
+	var prizes []config.PrizeTier
+	if active := a.profile.ActiveProfile(); active != nil {
+		prizes = active.Prizes
 	}
-	return result, nil
+	return a.live.DrawPrizes(prizes)
+}
+
+func (a *AppService) RedrawWinner(historyID string, uid int64) (string, error) {
+	return a.live.RedrawWinner(historyID, uid)
+}
+
+func (a *AppService) AnnounceWinners() (string, error) {
+	return a.live.AnnounceWinners()
+}
+
+func (a *AppService) GetSeedCommitment() string {
+	return a.live.GetSeedCommitment()
 }
 
 func (a *AppService) GetParticipantCount() int {
 	return a.live.GetParticipantCount()
 }
 
+func (a *AppService) GetParticipants() (string, error) {
+	return a.live.GetParticipants()
+}
+
+func (a *AppService) GetLastWinners() (string, error) {
+	return a.live.GetLastWinners()
+}
+
+func (a *AppService) GetRoomStatuses() (string, error) {
+	return a.live.GetRoomStatuses()
+}
+
+func (a *AppService) GetRejectedUsers() (string, error) {
+	return a.live.GetRejectedUsers()
+}
+
+func (a *AppService) GetUndecodedPacketCount() int64 {
+	return a.live.GetUndecodedPacketCount()
+}
+
 func (a *AppService) IsLiveLotteryRunning() bool {
 	return a.live.IsLiveLotteryRunning()
 }
@@ -0,0 +1,5 @@
+package app
+
+func (a *AppService) NotifyWinners(historyID string) (string, error) {
+	return a.notice.NotifyWinners(historyID)
+}
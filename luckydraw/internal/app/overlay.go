@@ -0,0 +1,13 @@
+package app
+
+func (a *AppService) GetOverlaySettings() (string, error) {
+	return a.overlay.GetOverlaySettings()
+}
+
+func (a *AppService) SaveOverlaySettings(enabled bool, addr string) (string, error) {
+	return a.overlay.SaveOverlaySettings(enabled, addr)
+}
+
+func (a *AppService) ResetOverlayToken() (string, error) {
+	return a.overlay.ResetOverlayToken()
+}
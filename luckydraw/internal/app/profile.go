@@ -1,5 +1,7 @@
 package app
 
+import "luckydraw/internal/config"
+
 func (a *AppService) GetProfiles() (string, error) {
 	return a.profile.GetProfiles()
 }
@@ -24,6 +26,54 @@ func (a *AppService) SaveProfileConfig(keyword string, winnerCount int) error {
 	return a.profile.SaveProfileConfig(keyword, winnerCount)
 }
 
+func (a *AppService) SaveKeywordMatch(match config.KeywordMatch) error {
+	return a.profile.SaveKeywordMatch(match)
+}
+
+func (a *AppService) SavePrizeTiers(prizes []config.PrizeTier) error {
+	return a.profile.SavePrizeTiers(prizes)
+}
+
+func (a *AppService) SaveEligibilityRules(rules config.EligibilityRules) error {
+	return a.profile.SaveEligibilityRules(rules)
+}
+
+func (a *AppService) SaveGiftEntry(mode string, gift config.GiftEntryRules) error {
+	return a.profile.SaveGiftEntry(mode, gift)
+}
+
+func (a *AppService) SaveWeighting(weighting config.WeightingConfig) error {
+	return a.profile.SaveWeighting(weighting)
+}
+
+func (a *AppService) SaveRecording(enabled bool) error {
+	return a.profile.SaveRecording(enabled)
+}
+
+func (a *AppService) SaveAnnounce(enabled bool) error {
+	return a.profile.SaveAnnounce(enabled)
+}
+
+func (a *AppService) SaveClaimNotice(claim config.ClaimNotice) error {
+	return a.profile.SaveClaimNotice(claim)
+}
+
+func (a *AppService) BindAccount(profileID string, uid int64) error {
+	return a.profile.BindAccount(profileID, uid)
+}
+
+func (a *AppService) GetRecordings() (string, error) {
+	return a.profile.GetRecordings()
+}
+
+func (a *AppService) SaveExclusionPolicy(policy config.ExclusionPolicy) error {
+	return a.profile.SaveExclusionPolicy(policy)
+}
+
+func (a *AppService) GetExcludedUsers(profileID string) (string, error) {
+	return a.profile.GetExcludedUsers(profileID)
+}
+
 func (a *AppService) SetBackgroundImage(imagePath string) error {
 	return a.profile.SetBackgroundImage(imagePath)
 }
@@ -0,0 +1,90 @@
+package bili
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 直播间发弹幕的几个常见错误码
+const (
+	CodeSendTooFast  = 10030
+	CodeSendRepeated = 10031
+)
+
+// DefaultDanmakuLimit 是没拿到房间设置时按的字数，低等级的号就是 20
+const DefaultDanmakuLimit = 20
+
+// SendDanmaku 用当前 Cookie 往直播间发一条弹幕，roomID 要用长号
+func (c *Client) SendDanmaku(roomID int, msg string) error {
+	csrf := c.CookieValue("bili_jct")
+	if csrf == "" {
+		return fmt.Errorf("Cookie 里没有 bili_jct，发不了弹幕")
+	}
+	form := url.Values{}
+	form.Set("bubble", "0")
+	form.Set("msg", msg)
+	form.Set("color", "16777215")
+	form.Set("mode", "1")
+	form.Set("fontsize", "25")
+	form.Set("rnd", strconv.FormatInt(time.Now().Unix(), 10))
+	form.Set("roomid", strconv.Itoa(roomID))
+	form.Set("csrf", csrf)
+	form.Set("csrf_token", csrf)
+
+	req, err := http.NewRequest("POST", c.liveBase+"/msg/send", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	data, err := c.do(req, true)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Msg     string `json:"msg"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return &APIError{Code: resp.Code, Message: resp.Message}
+	}
+	// 被屏蔽词吞掉的时候 code 还是 0，只在 msg 里给个 f 或 k
+	if resp.Msg == "f" || resp.Msg == "k" {
+		return fmt.Errorf("弹幕被屏蔽了: %s", msg)
+	}
+	return nil
+}
+
+// DanmakuLimit 是这个号在这个直播间一条弹幕最多几个字，拿不到就按 DefaultDanmakuLimit
+func (c *Client) DanmakuLimit(roomID int) int {
+	data, err := c.Get(c.liveBase+"/xlive/web-room/v1/index/getInfoByUser", map[string]string{
+		"room_id": strconv.Itoa(roomID),
+		"from":    "0",
+	})
+	if err != nil {
+		return DefaultDanmakuLimit
+	}
+	var resp struct {
+		Code int `json:"code"`
+		Data struct {
+			Property struct {
+				Danmu struct {
+					Length int `json:"length"`
+				} `json:"danmu"`
+			} `json:"property"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(data, &resp) != nil || resp.Code != 0 || resp.Data.Property.Danmu.Length <= 0 {
+		return DefaultDanmakuLimit
+	}
+	return resp.Data.Property.Danmu.Length
+}
@@ -1,18 +1,43 @@
 package bili
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Client struct {
-	cookie string
-	client *http.Client
+	cookie   string
+	client   *http.Client
+	apiBase  string
+	liveBase string
+	vcBase   string
+
+	mu         sync.Mutex
+	wbi        wbiKey
+	buvid      Buvid
+	buvidTried time.Time
+	ticket     webTicket
+	dev        string
 }
 
+var (
+	APIBaseURL      = "https://api.bilibili.com"
+	LiveAPIBaseURL  = "https://api.live.bilibili.com"
+	PassportBaseURL = "https://passport.bilibili.com"
+	WWWBaseURL      = "https://www.bilibili.com"
+	VCBaseURL       = "https://api.vc.bilibili.com"
+)
+
+const UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
 var DefaultHTTPClient = &http.Client{
 	Timeout: 30 * time.Second,
 	Transport: &http.Transport{
@@ -22,27 +47,55 @@ var DefaultHTTPClient = &http.Client{
 	},
 }
 
+// 地址和 http.Client 在创建时定下来，后台重连时不再去读包级变量
 func NewClient(cookie string) *Client {
 	return &Client{
-		cookie: cookie,
-		client: DefaultHTTPClient,
+		cookie:   cookie,
+		client:   DefaultHTTPClient,
+		apiBase:  APIBaseURL,
+		liveBase: LiveAPIBaseURL,
+		vcBase:   VCBaseURL,
 	}
 }
 
 func (c *Client) GetCookie() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.cookie
 }
 
+// SetCookie 换成刷新后的 Cookie；别处拿着的还是这个 Client，不用再找它们一个个换
+func (c *Client) SetCookie(cookie string) {
+	c.mu.Lock()
+	c.cookie = cookie
+	c.mu.Unlock()
+}
+
+// CookieValue 取 Cookie 里某一项，没有就是空的
+func (c *Client) CookieValue(name string) string {
+	return cookieValue(c.GetCookie(), name)
+}
+
+func cookieValue(cookie, name string) string {
+	for _, part := range strings.Split(cookie, ";") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, name+"=") {
+			return strings.TrimPrefix(part, name+"=")
+		}
+	}
+	return ""
+}
+
 func (c *Client) Get(url string, params map[string]string) ([]byte, error) {
+	return c.get(url, params, true)
+}
+
+func (c *Client) get(url string, params map[string]string, withDevice bool) ([]byte, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Cookie", c.cookie)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Accept", "application/json, text/plain, */*")
-
 	if len(params) > 0 {
 		q := req.URL.Query()
 		for k, v := range params {
@@ -50,14 +103,105 @@ func (c *Client) Get(url string, params map[string]string) ([]byte, error) {
 		}
 		req.URL.RawQuery = q.Encode()
 	}
+	return c.do(req, withDevice)
+}
+
+// GetPlain 不补 buvid 和 bili_ticket，登录那边的接口用
+func (c *Client) GetPlain(url string, params map[string]string) ([]byte, error) {
+	return c.get(url, params, false)
+}
+
+// PostForm 发表单，连响应头一起带回来，好拿里面下发的 Cookie
+func (c *Client) PostForm(rawURL string, form url.Values) ([]byte, http.Header, error) {
+	req, err := http.NewRequest("POST", rawURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.send(req, false)
+}
+
+func (c *Client) do(req *http.Request, withDevice bool) ([]byte, error) {
+	body, _, err := c.send(req, withDevice)
+	return body, err
+}
+
+// send 补上浏览器的请求头；withDevice 时顺便把缺的 buvid 和 bili_ticket 塞进 Cookie
+func (c *Client) send(req *http.Request, withDevice bool) ([]byte, http.Header, error) {
+	cookie := c.GetCookie()
+	if withDevice {
+		cookie = c.deviceCookie()
+	}
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "application/json, text/plain, */*")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	switch {
+	case strings.HasPrefix(req.URL.String(), c.liveBase):
+		req.Header.Set("Referer", "https://live.bilibili.com/")
+		req.Header.Set("Origin", "https://live.bilibili.com")
+	case strings.HasPrefix(req.URL.String(), c.vcBase):
+		req.Header.Set("Referer", "https://message.bilibili.com/")
+		req.Header.Set("Origin", "https://message.bilibili.com")
+	default:
+		req.Header.Set("Referer", "https://www.bilibili.com/")
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, nil, fmt.Errorf("火星的网络有点意思: HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 有的接口不管 Accept-Encoding 都回 gzip
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer reader.Close()
+		body, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return body, resp.Header, nil
+}
+
+func (c *Client) deviceCookie() string {
+	cookie := c.GetCookie()
+	var extra []string
+	if cookieValue(cookie, "buvid3") == "" {
+		if buvid, err := c.Buvid(); err == nil {
+			extra = append(extra, "buvid3="+buvid.B3)
+			if buvid.B4 != "" && cookieValue(cookie, "buvid4") == "" {
+				extra = append(extra, "buvid4="+buvid.B4)
+			}
+		}
+	}
+	if cookieValue(cookie, "bili_ticket") == "" {
+		if ticket, err := c.Ticket(); err == nil {
+			extra = append(extra, "bili_ticket="+ticket)
+		}
+	}
+	if len(extra) == 0 {
+		return cookie
+	}
+	if cookie != "" {
+		extra = append([]string{strings.TrimRight(cookie, "; ")}, extra...)
+	}
+	return strings.Join(extra, "; ")
 }
 
 type APIResponse struct {
@@ -66,8 +210,20 @@ type APIResponse struct {
 	Data    json.RawMessage `json:"data"`
 }
 
+// APIError 是接口正常回了、但 code 不是 0；跟断网分开，-101 才说明 Cookie 真没用了
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error: %d %s", e.Code, e.Message)
+}
+
+const CodeNotLoggedIn = -101
+
 func (c *Client) GetMyInfo() (*UserInfo, error) {
-	data, err := c.Get("https://api.bilibili.com/x/space/myinfo", nil)
+	data, err := c.Get(c.apiBase+"/x/space/myinfo", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +234,7 @@ func (c *Client) GetMyInfo() (*UserInfo, error) {
 	}
 
 	if resp.Code != 0 {
-		return nil, fmt.Errorf("api error: %d %s", resp.Code, resp.Message)
+		return nil, &APIError{Code: resp.Code, Message: resp.Message}
 	}
 
 	var info UserInfo
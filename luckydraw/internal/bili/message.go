@@ -0,0 +1,87 @@
+package bili
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SendPrivateMessage 用当前 Cookie 给 receiver 发一条文字私信
+func (c *Client) SendPrivateMessage(receiver int64, text string) error {
+	csrf := c.CookieValue("bili_jct")
+	sender := c.CookieValue("DedeUserID")
+	if csrf == "" || sender == "" {
+		return fmt.Errorf("Cookie 里没有 bili_jct 或 DedeUserID，发不了私信")
+	}
+	content, err := json.Marshal(map[string]string{"content": text})
+	if err != nil {
+		return err
+	}
+	devID := c.devID()
+	receiverID := strconv.FormatInt(receiver, 10)
+
+	form := url.Values{}
+	form.Set("msg[sender_uid]", sender)
+	form.Set("msg[receiver_id]", receiverID)
+	form.Set("msg[receiver_type]", "1")
+	form.Set("msg[msg_type]", "1")
+	form.Set("msg[msg_status]", "0")
+	form.Set("msg[content]", string(content))
+	form.Set("msg[timestamp]", strconv.FormatInt(time.Now().Unix(), 10))
+	form.Set("msg[new_face_version]", "0")
+	form.Set("msg[dev_id]", devID)
+	form.Set("from_firework", "0")
+	form.Set("build", "0")
+	form.Set("mobi_app", "web")
+	form.Set("csrf", csrf)
+	form.Set("csrf_token", csrf)
+
+	// 查询串里还要再签一份 WBI
+	key, err := c.WbiKey()
+	if err != nil {
+		return err
+	}
+	query := SignWbi(map[string]string{
+		"w_sender_uid":  sender,
+		"w_receiver_id": receiverID,
+		"w_dev_id":      devID,
+	}, key, time.Now().Unix())
+
+	req, err := http.NewRequest("POST", c.vcBase+"/web_im/v1/web_im/send_msg?"+query, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	data, err := c.do(req, true)
+	if err != nil {
+		return err
+	}
+
+	var resp APIResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return &APIError{Code: resp.Code, Message: resp.Message}
+	}
+	return nil
+}
+
+// devID 网页端每个标签页一个，这里一个 Client 一个
+func (c *Client) devID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dev == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		c.dev = strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]))
+	}
+	return c.dev
+}
@@ -0,0 +1,152 @@
+package bili
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 开放平台（互动玩法）的接口，跟网页端不是一个域名，也不用 Cookie
+var OpenAPIBaseURL = "https://live-open.biliapi.com"
+
+type OpenClient struct {
+	accessKeyID     string
+	accessKeySecret string
+	baseURL         string
+	client          *http.Client
+}
+
+type OpenGame struct {
+	GameInfo struct {
+		GameID string `json:"game_id"`
+	} `json:"game_info"`
+	WebsocketInfo struct {
+		AuthBody string   `json:"auth_body"`
+		WssLink  []string `json:"wss_link"`
+	} `json:"websocket_info"`
+	AnchorInfo OpenAnchor `json:"anchor_info"`
+}
+
+type OpenAnchor struct {
+	RoomID int    `json:"room_id"`
+	Uname  string `json:"uname"`
+	Uface  string `json:"uface"`
+	UID    int64  `json:"uid"`
+	OpenID string `json:"open_id"`
+}
+
+func NewOpenClient(accessKeyID, accessKeySecret string) *OpenClient {
+	return &OpenClient{
+		accessKeyID:     accessKeyID,
+		accessKeySecret: accessKeySecret,
+		baseURL:         OpenAPIBaseURL,
+		client:          DefaultHTTPClient,
+	}
+}
+
+// AppStart 用主播的身份码开一局游戏，拿到长连地址和认证包
+func (c *OpenClient) AppStart(code string, appID int64) (*OpenGame, error) {
+	data, err := c.Post("/v2/app/start", map[string]any{"code": code, "app_id": appID})
+	if err != nil {
+		return nil, err
+	}
+	var game OpenGame
+	if err := json.Unmarshal(data, &game); err != nil {
+		return nil, err
+	}
+	if game.GameInfo.GameID == "" || len(game.WebsocketInfo.WssLink) == 0 {
+		return nil, fmt.Errorf("开放平台没给长连地址")
+	}
+	return &game, nil
+}
+
+// AppHeartbeat 要 20 秒左右发一次，超过 60 秒没发这局就没了
+func (c *OpenClient) AppHeartbeat(gameID string) error {
+	_, err := c.Post("/v2/app/heartbeat", map[string]any{"game_id": gameID})
+	return err
+}
+
+func (c *OpenClient) AppEnd(appID int64, gameID string) error {
+	_, err := c.Post("/v2/app/end", map[string]any{"app_id": appID, "game_id": gameID})
+	return err
+}
+
+func (c *OpenClient) Post(path string, payload any) (json.RawMessage, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sum := md5.Sum(body)
+	headers := map[string]string{
+		"x-bili-accesskeyid":       c.accessKeyID,
+		"x-bili-content-md5":       hex.EncodeToString(sum[:]),
+		"x-bili-signature-method":  "HMAC-SHA256",
+		"x-bili-signature-nonce":   hex.EncodeToString(nonce),
+		"x-bili-signature-version": "1.0",
+		"x-bili-timestamp":         strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Authorization", OpenSignature(headers, c.accessKeySecret))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("开放平台连不上: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result APIResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("开放平台回了看不懂的东西: %v", err)
+	}
+	if result.Code != 0 {
+		return nil, fmt.Errorf("开放平台 %s 失败: %d %s", path, result.Code, result.Message)
+	}
+	return result.Data, nil
+}
+
+// OpenSignature 把 x-bili-* 头按名字排好，拼成 k:v 一行一个，再拿 secret 做 HMAC-SHA256
+func OpenSignature(headers map[string]string, secret string) string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		if strings.HasPrefix(k, "x-bili-") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+":"+headers[k])
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
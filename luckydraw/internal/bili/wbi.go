@@ -0,0 +1,237 @@
+package bili
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WBI 的 key 每天换，缓存一小时够用了；拿失败的东西隔一会儿再试，别每个请求都去撞
+const (
+	wbiKeyTTL     = time.Hour
+	retryCooldown = time.Minute
+)
+
+var mixinKeyEncTab = [64]int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35, 27, 43, 5, 49,
+	33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13, 37, 48, 7, 16, 24, 55, 40,
+	61, 26, 17, 0, 1, 60, 51, 30, 4, 22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11,
+	36, 20, 34, 44, 52,
+}
+
+type wbiKey struct {
+	key     string
+	fetched time.Time
+}
+
+type Buvid struct {
+	B3 string `json:"b_3"`
+	B4 string `json:"b_4"`
+}
+
+type webTicket struct {
+	value   string
+	expires time.Time
+	tried   time.Time
+}
+
+// MixinKey 把 nav 里 img_key 和 sub_key 拼起来按表打乱，取前 32 位
+func MixinKey(imgKey, subKey string) string {
+	raw := imgKey + subKey
+	var b strings.Builder
+	for _, i := range mixinKeyEncTab {
+		if i < len(raw) {
+			b.WriteByte(raw[i])
+		}
+	}
+	key := b.String()
+	if len(key) > 32 {
+		key = key[:32]
+	}
+	return key
+}
+
+// SignWbi 给参数加上 wts 和 w_rid，返回编码好的查询串
+func SignWbi(params map[string]string, mixinKey string, ts int64) string {
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, strings.Map(func(r rune) rune {
+			if strings.ContainsRune("!'()*", r) {
+				return -1
+			}
+			return r
+		}, v))
+	}
+	values.Set("wts", strconv.FormatInt(ts, 10))
+
+	// 跟浏览器的 encodeURIComponent 对齐，空格是 %20 不是 +
+	query := strings.ReplaceAll(values.Encode(), "+", "%20")
+	sum := md5.Sum([]byte(query + mixinKey))
+	return query + "&w_rid=" + hex.EncodeToString(sum[:])
+}
+
+// GetWbi 跟 Get 一样，只是参数先签上 WBI
+func (c *Client) GetWbi(rawURL string, params map[string]string) ([]byte, error) {
+	key, err := c.WbiKey()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = SignWbi(params, key, time.Now().Unix())
+	return c.do(req, true)
+}
+
+func (c *Client) WbiKey() (string, error) {
+	c.mu.Lock()
+	cached := c.wbi
+	c.mu.Unlock()
+	if cached.key != "" && time.Since(cached.fetched) < wbiKeyTTL {
+		return cached.key, nil
+	}
+
+	data, err := c.get(c.apiBase+"/x/web-interface/nav", nil, false)
+	if err != nil {
+		return "", fmt.Errorf("拿不到 WBI 的 key: %v", err)
+	}
+	// 没登录时 code 是 -101，但 wbi_img 照样给
+	var resp struct {
+		Data struct {
+			WbiImg struct {
+				ImgURL string `json:"img_url"`
+				SubURL string `json:"sub_url"`
+			} `json:"wbi_img"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("拿不到 WBI 的 key: %v", err)
+	}
+	imgKey := keyFromURL(resp.Data.WbiImg.ImgURL)
+	subKey := keyFromURL(resp.Data.WbiImg.SubURL)
+	if imgKey == "" || subKey == "" {
+		return "", fmt.Errorf("nav 里没有 wbi_img")
+	}
+
+	key := MixinKey(imgKey, subKey)
+	c.mu.Lock()
+	c.wbi = wbiKey{key: key, fetched: time.Now()}
+	c.mu.Unlock()
+	return key, nil
+}
+
+// InvalidateWbi 碰上 -352 之类的时候丢掉缓存，下次重新拿
+func (c *Client) InvalidateWbi() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wbi = wbiKey{}
+}
+
+func keyFromURL(u string) string {
+	name := path.Base(u)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// Buvid 优先用 Cookie 里的，没有就找 spi 要一对，要到了就一直用
+func (c *Client) Buvid() (Buvid, error) {
+	if b3 := c.CookieValue("buvid3"); b3 != "" {
+		return Buvid{B3: b3, B4: c.CookieValue("buvid4")}, nil
+	}
+
+	c.mu.Lock()
+	cached, tried := c.buvid, c.buvidTried
+	if cached.B3 == "" && time.Since(tried) >= retryCooldown {
+		c.buvidTried = time.Now()
+	}
+	c.mu.Unlock()
+	if cached.B3 != "" {
+		return cached, nil
+	}
+	if time.Since(tried) < retryCooldown {
+		return Buvid{}, fmt.Errorf("spi 刚才没给 buvid")
+	}
+
+	data, err := c.get(c.apiBase+"/x/frontend/finger/spi", nil, false)
+	var resp struct {
+		Code int   `json:"code"`
+		Data Buvid `json:"data"`
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &resp)
+	}
+	if err == nil && (resp.Code != 0 || resp.Data.B3 == "") {
+		err = fmt.Errorf("spi 没给 buvid: code=%d", resp.Code)
+	}
+	if err != nil {
+		return Buvid{}, err
+	}
+
+	c.mu.Lock()
+	c.buvid = resp.Data
+	c.mu.Unlock()
+	return resp.Data, nil
+}
+
+// Ticket 是 bili_ticket，有效期内复用
+func (c *Client) Ticket() (string, error) {
+	c.mu.Lock()
+	cached := c.ticket
+	c.mu.Unlock()
+	if cached.value != "" && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+	if time.Since(cached.tried) < retryCooldown {
+		return "", fmt.Errorf("bili_ticket 刚才没拿到")
+	}
+	c.mu.Lock()
+	c.ticket.tried = time.Now()
+	c.mu.Unlock()
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("XgwSnGZ1p"))
+	mac.Write([]byte("ts" + ts))
+	params := url.Values{}
+	params.Set("key_id", "ec02")
+	params.Set("hexsign", hex.EncodeToString(mac.Sum(nil)))
+	params.Set("context[ts]", ts)
+	params.Set("csrf", c.CookieValue("bili_jct"))
+
+	req, err := http.NewRequest("POST", c.apiBase+"/bapis/bilibili.api.ticket.v1.Ticket/GenWebTicket?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	data, err := c.do(req, false)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Code int `json:"code"`
+		Data struct {
+			Ticket    string `json:"ticket"`
+			CreatedAt int64  `json:"created_at"`
+			TTL       int64  `json:"ttl"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+	if resp.Code != 0 || resp.Data.Ticket == "" {
+		return "", fmt.Errorf("bili_ticket 没拿到: code=%d", resp.Code)
+	}
+
+	expires := time.Unix(resp.Data.CreatedAt+resp.Data.TTL, 0)
+	c.mu.Lock()
+	c.ticket = webTicket{value: resp.Data.Ticket, expires: expires, tried: c.ticket.tried}
+	c.mu.Unlock()
+	return resp.Data.Ticket, nil
+}
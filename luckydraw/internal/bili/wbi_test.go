@@ -0,0 +1,23 @@
+package bili
+
+import "testing"
+
+// 用的是公开文档里的示例
+func TestSignWbi(t *testing.T) {
+	key := MixinKey("7cd084941338484aae1ad9425b84077c", "4932caff0ff746eab6f01bf08b70ac45")
+	if key != "ea1db124af3c7062474693fa704f4ff8" {
+		t.Fatalf("mixin key = %s", key)
+	}
+	query := SignWbi(map[string]string{"foo": "114", "bar": "514", "zab": "1919810"}, key, 1702204169)
+	want := "bar=514&foo=114&wts=1702204169&zab=1919810&w_rid=8f6f2b5b3d485fe1886cec6a0be8c5d4"
+	if query != want {
+		t.Fatalf("signed query = %s\nwant %s", query, want)
+	}
+}
+
+func TestSignWbiEncodesLikeBrowser(t *testing.T) {
+	query := SignWbi(map[string]string{"keyword": "a b(c)!*'"}, "key", 1)
+	if want := "keyword=a%20bc&wts=1&w_rid="; query[:len(want)] != want {
+		t.Fatalf("signed query = %s", query)
+	}
+}
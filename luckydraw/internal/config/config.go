@@ -2,29 +2,232 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
+
+	"luckydraw/internal/secret"
 )
 
 type Config struct {
-	Cookie string `json:"cookie,omitempty"`
+	// deprecated — 老版本只存一个号，启动时挪进 Accounts
+	Cookie       string `json:"cookie,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+
+	Accounts      []Account          `json:"accounts,omitempty"`
+	ActiveAccount int64              `json:"active_account,omitempty"`
+	Overlay       OverlayConfig      `json:"overlay"`
+	OpenPlatform  OpenPlatformConfig `json:"open_platform"`
+	// 落盘时各个号的 Cookie、refresh_token 和开放平台的 secret、身份码都加密放在这里，明文那几项是空的
+	Sealed *SealedCredentials `json:"sealed,omitempty"`
+}
+
+// Account 是存着的一个 B 站账号，Cookie 为空说明登录失效了要重新登
+type Account struct {
+	UID          int64  `json:"uid"`
+	Name         string `json:"name,omitempty"`
+	Face         string `json:"face,omitempty"`
+	Cookie       string `json:"cookie,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func (c *Config) Account(uid int64) *Account {
+	for i := range c.Accounts {
+		if c.Accounts[i].UID == uid {
+			return &c.Accounts[i]
+		}
+	}
+	return nil
+}
+
+type SealedCredentials struct {
+	Keeper string `json:"keeper"`
+	Data   string `json:"data"`
+}
+
+type credentials struct {
+	Cookie          string                       `json:"cookie,omitempty"`
+	RefreshToken    string                       `json:"refresh_token,omitempty"`
+	AccessKeySecret string                       `json:"access_key_secret,omitempty"`
+	IdentityCode    string                       `json:"identity_code,omitempty"`
+	Accounts        map[int64]accountCredentials `json:"accounts,omitempty"`
+}
+
+type accountCredentials struct {
+	Cookie       string `json:"cookie,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func (c credentials) empty() bool {
+	return c.Cookie == "" && c.RefreshToken == "" && c.AccessKeySecret == "" && c.IdentityCode == "" && len(c.Accounts) == 0
+}
+
+func (c *Config) credentials() credentials {
+	creds := credentials{
+		Cookie:          c.Cookie,
+		RefreshToken:    c.RefreshToken,
+		AccessKeySecret: c.OpenPlatform.AccessKeySecret,
+		IdentityCode:    c.OpenPlatform.IdentityCode,
+	}
+	for _, account := range c.Accounts {
+		if account.Cookie == "" && account.RefreshToken == "" {
+			continue
+		}
+		if creds.Accounts == nil {
+			creds.Accounts = make(map[int64]accountCredentials)
+		}
+		creds.Accounts[account.UID] = accountCredentials{Cookie: account.Cookie, RefreshToken: account.RefreshToken}
+	}
+	return creds
+}
+
+func (c *Config) setCredentials(creds credentials) {
+	c.Cookie = creds.Cookie
+	c.RefreshToken = creds.RefreshToken
+	c.OpenPlatform.AccessKeySecret = creds.AccessKeySecret
+	c.OpenPlatform.IdentityCode = creds.IdentityCode
+	if len(c.Accounts) == 0 {
+		return
+	}
+	// 换一个切片，SaveConfig 拿副本清凭据时别改到原来的
+	accounts := make([]Account, len(c.Accounts))
+	for i, account := range c.Accounts {
+		secret := creds.Accounts[account.UID]
+		account.Cookie = secret.Cookie
+		account.RefreshToken = secret.RefreshToken
+		accounts[i] = account
+	}
+	c.Accounts = accounts
+}
+
+// 开放平台互动玩法：key 和 app_id 是开发者的，身份码是主播在直播姬里拿的
+type OpenPlatformConfig struct {
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	AccessKeySecret string `json:"access_key_secret,omitempty"`
+	AppID           int64  `json:"app_id,omitempty"`
+	IdentityCode    string `json:"identity_code,omitempty"`
+}
+
+type OverlayConfig struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr,omitempty"`
+	Token   string `json:"token,omitempty"`
 }
 
 type HistoryWinner struct {
-	UID      int64  `json:"uid"`
-	Username string `json:"username"`
-	Count    int    `json:"count"`
+	UID       int64   `json:"uid"`
+	Username  string  `json:"username"`
+	Count     int     `json:"count"`
+	Weight    float64 `json:"weight,omitempty"`
+	Forfeited bool    `json:"forfeited,omitempty"`
+	Replaces  int64   `json:"replaces,omitempty"`
+	Prize     string  `json:"prize,omitempty"`
+	Notice    *Notice `json:"notice,omitempty"`
+}
+
+// Notice 是私信通知中奖者的结果，Attempts 算上了重试
+type Notice struct {
+	Sent     bool      `json:"sent"`
+	Time     time.Time `json:"time"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type RedrawRecord struct {
+	Time           time.Time `json:"time"`
+	Attempt        int       `json:"attempt"`
+	ForfeitedUID   int64     `json:"forfeited_uid"`
+	ReplacementUID int64     `json:"replacement_uid"`
+	PoolHash       string    `json:"pool_hash"`
+	PoolSize       int       `json:"pool_size"`
+	Prize          string    `json:"prize,omitempty"`
+}
+
+type DrawProof struct {
+	Algorithm    string `json:"algorithm"`
+	Commitment   string `json:"commitment"`
+	Seed         string `json:"seed"`
+	SnapshotHash string `json:"snapshot_hash"`
+	Round        int    `json:"round"`
+	Participants int    `json:"participants"`
+}
+
+// TierRecord 是分奖项开奖时每个奖项自己的那一轮，中奖的人在 HistoryRecord.Winners 里按 Prize 分
+type TierRecord struct {
+	Name     string     `json:"name"`
+	Quantity int        `json:"quantity"`
+	Proof    *DrawProof `json:"proof,omitempty"`
 }
 
 type HistoryRecord struct {
-	ID          string          `json:"id"`
-	Keyword     string          `json:"keyword"`
-	WinnerCount int             `json:"winner_count"`
-	Time        time.Time       `json:"time"`
-	Winners     []HistoryWinner `json:"winners"`
+	ID               string          `json:"id"`
+	Keyword          string          `json:"keyword"`
+	WinnerCount      int             `json:"winner_count"`
+	Time             time.Time       `json:"time"`
+	Winners          []HistoryWinner `json:"winners"`
+	Proof            *DrawProof      `json:"proof,omitempty"`
+	ParticipantCount int             `json:"participant_count,omitempty"`
+	SnapshotFile     string          `json:"snapshot_file,omitempty"`
+	Redraws          []RedrawRecord  `json:"redraws,omitempty"`
+	Recording        string          `json:"recording,omitempty"`
+	Replay           string          `json:"replay,omitempty"`
+	Tiers            []TierRecord    `json:"tiers,omitempty"`
+}
+
+// Participant 的 Ineligible 是这个人不够格的奖项下标，复验时按它还原每个奖项的名单
+type Participant struct {
+	UID        int64     `json:"uid"`
+	Username   string    `json:"username"`
+	RoomID     int       `json:"room_id"`
+	FirstSeen  time.Time `json:"first_seen"`
+	Message    string    `json:"message,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	Count      int       `json:"count"`
+	Weight     float64   `json:"weight"`
+	Excluded   string    `json:"excluded,omitempty"`
+	Ineligible []int     `json:"ineligible,omitempty"`
+}
+
+type ParticipantSnapshot struct {
+	HistoryID    string        `json:"history_id"`
+	Time         time.Time     `json:"time"`
+	Participants []Participant `json:"participants"`
 }
 
+func SnapshotDir(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "snapshots")
+}
+
+func RecordingDir(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "recordings")
+}
+
+func LoadSnapshot(path string) (*ParticipantSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap ParticipantSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+func SaveSnapshot(path string, snap *ParticipantSnapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadConfig 顺手把老版本的明文凭据加密后写回去；凭据解不开时其余配置照常返回
 func LoadConfig(path string) (*Config, error) {
 	if path == "" {
 		return &Config{}, nil
@@ -42,10 +245,31 @@ func LoadConfig(path string) (*Config, error) {
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		os.Chmod(path, 0600)
+	}
 
+	dir := filepath.Dir(path)
+	if cfg.Sealed != nil {
+		// 解不开就留着 Sealed，下次保存时原样写回去，别把凭据弄丢了
+		creds, err := unseal(dir, cfg.Sealed)
+		if err != nil {
+			return &cfg, fmt.Errorf("登录信息解不开: %v", err)
+		}
+		cfg.Sealed = nil
+		cfg.setCredentials(creds)
+		return &cfg, nil
+	}
+
+	if !cfg.credentials().empty() {
+		if _, err := secret.Default(dir); err == nil {
+			SaveConfig(path, &cfg)
+		}
+	}
 	return &cfg, nil
 }
 
+// SaveConfig 凭据加密后才落盘；加密不了的话其余配置照写，凭据留着文件里上一份密文，并返回错误
 func SaveConfig(path string, cfg *Config) error {
 	if path == "" {
 		home, _ := os.UserHomeDir()
@@ -57,22 +281,195 @@ func SaveConfig(path string, cfg *Config) error {
 		return err
 	}
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	out := *cfg
+	out.setCredentials(credentials{})
+	var sealErr error
+	if creds := cfg.credentials(); !creds.empty() {
+		sealed, err := seal(dir, creds)
+		if err != nil {
+			// 明文不能写，清空又会把登录全弄丢，只能先留着上次加密好的
+			sealErr = err
+			if out.Sealed == nil {
+				out.Sealed = previousSealed(path)
+			}
+		} else {
+			out.Sealed = sealed
+		}
+	}
+
+	data, err := json.MarshalIndent(&out, "", "  ")
 	if err != nil {
 		return err
 	}
+	if err := writePrivate(path, data); err != nil {
+		return err
+	}
+	if sealErr != nil {
+		return fmt.Errorf("登录信息没法加密，这次没存下来: %v", sealErr)
+	}
+	return nil
+}
 
-	return os.WriteFile(path, data, 0644)
+func previousSealed(path string) *SealedCredentials {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var old struct {
+		Sealed *SealedCredentials `json:"sealed"`
+	}
+	json.Unmarshal(data, &old)
+	return old.Sealed
+}
+
+func seal(dir string, creds credentials) (*SealedCredentials, error) {
+	keeper, err := secret.Default(dir)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keeper.Key()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(creds)
+	if err != nil {
+		return nil, err
+	}
+	data, err := secret.Seal(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &SealedCredentials{Keeper: keeper.Name(), Data: data}, nil
+}
+
+func unseal(dir string, sealed *SealedCredentials) (credentials, error) {
+	var creds credentials
+	keeper, err := secret.ByName(sealed.Keeper, dir)
+	if err != nil {
+		return creds, err
+	}
+	key, err := keeper.Key()
+	if err != nil {
+		return creds, err
+	}
+	plaintext, err := secret.Open(key, sealed.Data)
+	if err != nil {
+		return creds, err
+	}
+	err = json.Unmarshal(plaintext, &creds)
+	return creds, err
+}
+
+// writePrivate 先写临时文件再换过去，临时文件建出来就是 0600
+func writePrivate(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type EligibilityRules struct {
+	MedalName     string `json:"medal_name,omitempty"`
+	MedalOwnRoom  bool   `json:"medal_own_room,omitempty"`
+	MinMedalLevel int    `json:"min_medal_level,omitempty"`
+	MinUserLevel  int    `json:"min_user_level,omitempty"`
+	GuardLevel    int    `json:"guard_level,omitempty"`
+}
+
+const (
+	EntryModeDanmaku = "danmaku"
+	EntryModeGift    = "gift"
+	EntryModeAny     = "any"
+)
+
+type GiftEntryRules struct {
+	GiftIDs           []int    `json:"gift_ids,omitempty"`
+	GiftNames         []string `json:"gift_names,omitempty"`
+	MinNum            int      `json:"min_num,omitempty"`
+	MinCoin           int64    `json:"min_coin,omitempty"`
+	AcceptGuard       bool     `json:"accept_guard,omitempty"`
+	AcceptSuperChat   bool     `json:"accept_super_chat,omitempty"`
+	MinSuperChatPrice int64    `json:"min_super_chat_price,omitempty"`
+}
+
+// KeywordMatch 决定什么弹幕算参与；关键词和正则都没填时退回老的 Keyword 包含匹配。
+// IgnoreScript 是繁体当简体比，「抽獎」也算「抽奖」
+type KeywordMatch struct {
+	Mode         string   `json:"mode,omitempty"`
+	Keywords     []string `json:"keywords,omitempty"`
+	Pattern      string   `json:"pattern,omitempty"`
+	Exclude      []string `json:"exclude,omitempty"`
+	IgnoreCase   bool     `json:"ignore_case,omitempty"`
+	IgnoreWidth  bool     `json:"ignore_width,omitempty"`
+	IgnoreEmoji  bool     `json:"ignore_emoji,omitempty"`
+	IgnoreScript bool     `json:"ignore_script,omitempty"`
+}
+
+// LotteryWindow 定时收人：EndAt 和 DurationSeconds 给一个，都给以 EndAt 为准；
+// AutoDraw 的话到点直接开奖，配了奖项就按奖项开，没配就按 WinnerCount
+type LotteryWindow struct {
+	DurationSeconds int       `json:"duration_seconds,omitempty"`
+	EndAt           time.Time `json:"end_at,omitempty"`
+	AutoDraw        bool      `json:"auto_draw,omitempty"`
+}
+
+// ClaimNotice 私信中奖者领奖的模板，可以用 {name} {prize} {deadline} {history_id}；
+// Deadline 从开奖时间往后算几天
+type ClaimNotice struct {
+	Template     string `json:"template,omitempty"`
+	DeadlineDays int    `json:"deadline_days,omitempty"`
+}
+
+// PrizeTier 按顺序开，前面中过的后面不再中；Rules 不填就是谁都能抽
+type PrizeTier struct {
+	Name     string            `json:"name"`
+	Quantity int               `json:"quantity"`
+	Rules    *EligibilityRules `json:"rules,omitempty"`
+}
+
+type WeightingConfig struct {
+	Strategy           string  `json:"strategy,omitempty"`
+	GovernorMultiplier float64 `json:"governor_multiplier,omitempty"`
+	AdmiralMultiplier  float64 `json:"admiral_multiplier,omitempty"`
+	CaptainMultiplier  float64 `json:"captain_multiplier,omitempty"`
+}
+
+type ExclusionPolicy struct {
+	LastDraws int      `json:"last_draws,omitempty"`
+	LastDays  int      `json:"last_days,omitempty"`
+	Profiles  []string `json:"profiles,omitempty"`
+	Blacklist []int64  `json:"blacklist,omitempty"`
+	Whitelist []int64  `json:"whitelist,omitempty"`
 }
 
 type ProfileConfig struct {
-	ID              string          `json:"id"`
-	Name            string          `json:"name"`
-	BackgroundImage string          `json:"background_image,omitempty"`
-	WatchedRooms    []int           `json:"watched_rooms,omitempty"`
-	Keyword         string          `json:"keyword,omitempty"`
-	WinnerCount     int             `json:"winner_count"`
-	History         []HistoryRecord `json:"history,omitempty"`
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	BackgroundImage string           `json:"background_image,omitempty"`
+	WatchedRooms    []int            `json:"watched_rooms,omitempty"`
+	Keyword         string           `json:"keyword,omitempty"`
+	Match           KeywordMatch     `json:"match"`
+	WinnerCount     int              `json:"winner_count"`
+	Prizes          []PrizeTier      `json:"prizes,omitempty"`
+	Rules           EligibilityRules `json:"rules"`
+	EntryMode       string           `json:"entry_mode,omitempty"`
+	GiftEntry       GiftEntryRules   `json:"gift_entry"`
+	Weighting       WeightingConfig  `json:"weighting"`
+	Exclusion       ExclusionPolicy  `json:"exclusion"`
+	RecordSessions  bool             `json:"record_sessions,omitempty"`
+	Announce        bool             `json:"announce,omitempty"`
+	ClaimNotice     ClaimNotice      `json:"claim_notice"`
+	AccountUID      int64            `json:"account_uid,omitempty"`
+	History         []HistoryRecord  `json:"history,omitempty"`
 }
 
 type RuntimeState struct {
@@ -150,10 +547,10 @@ func defaultRuntimeState() *RuntimeState {
 	return &RuntimeState{
 		ActiveProfile: "default",
 		Profiles: []ProfileConfig{{
-			ID:          "default",
-			Name:        "默认配置",
+			ID:           "default",
+			Name:         "默认配置",
 			WatchedRooms: []int{},
-			WinnerCount: 1,
+			WinnerCount:  1,
 		}},
 	}
 }
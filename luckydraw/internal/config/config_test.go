@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"luckydraw/internal/secret"
+)
+
+func TestConfigCredentialsEncrypted(t *testing.T) {
+	t.Setenv(secret.PassphraseEnv, "hunter2")
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	cfg := &Config{Cookie: "SESSDATA=abc; bili_jct=def", RefreshToken: "token"}
+	cfg.OpenPlatform.AccessKeyID = "id"
+	cfg.OpenPlatform.AccessKeySecret = "shh"
+	cfg.OpenPlatform.IdentityCode = "CODE123"
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, plain := range []string{"SESSDATA", "token", "shh", "CODE123"} {
+		if strings.Contains(string(data), plain) {
+			t.Fatalf("配置文件里还能看到 %q:\n%s", plain, data)
+		}
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Fatalf("权限是 %v", info.Mode().Perm())
+	}
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Cookie != cfg.Cookie || loaded.RefreshToken != "token" || loaded.OpenPlatform.AccessKeySecret != "shh" || loaded.OpenPlatform.IdentityCode != "CODE123" || loaded.Sealed != nil {
+		t.Fatalf("读回来不对: %+v", loaded)
+	}
+	if cfg.Cookie == "" || cfg.Sealed != nil {
+		t.Fatal("SaveConfig 改了传进来的配置")
+	}
+}
+
+func TestConfigMigratesPlaintext(t *testing.T) {
+	t.Setenv(secret.PassphraseEnv, "hunter2")
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"cookie":"SESSDATA=old","overlay":{"enabled":true}}`), 0644)
+
+	cfg, err := LoadConfig(path)
+	if err != nil || cfg.Cookie != "SESSDATA=old" || !cfg.Overlay.Enabled {
+		t.Fatalf("老配置读不出来: %+v %v", cfg, err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "SESSDATA") || !strings.Contains(string(data), `"sealed"`) {
+		t.Fatalf("没有迁移成密文:\n%s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Fatalf("权限是 %v", info.Mode().Perm())
+	}
+}
+
+func TestConfigKeepsSealedWhenLocked(t *testing.T) {
+	t.Setenv(secret.PassphraseEnv, "hunter2")
+	path := filepath.Join(t.TempDir(), "config.json")
+	SaveConfig(path, &Config{Cookie: "SESSDATA=abc"})
+
+	// 没给口令：凭据拿不到，但改别的设置时也不能把密文冲掉
+	t.Setenv(secret.PassphraseEnv, "")
+	cfg, err := LoadConfig(path)
+	if err == nil || cfg == nil || cfg.Cookie != "" {
+		t.Fatalf("没口令也解开了: %+v %v", cfg, err)
+	}
+	cfg.Overlay.Enabled = true
+	SaveConfig(path, cfg)
+
+	t.Setenv(secret.PassphraseEnv, "hunter2")
+	cfg, err = LoadConfig(path)
+	if err != nil || cfg.Cookie != "SESSDATA=abc" || !cfg.Overlay.Enabled {
+		t.Fatalf("凭据丢了: %+v %v", cfg, err)
+	}
+}
+
+func TestConfigKeepsOldSealedWhenSealFails(t *testing.T) {
+	t.Setenv(secret.PassphraseEnv, "hunter2")
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := &Config{Cookie: "SESSDATA=abc"}
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// 口令和钥匙串都没了：这次存不进去，但原来的登录不能被冲掉
+	t.Setenv(secret.PassphraseEnv, "")
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	cfg.Cookie = "SESSDATA=new"
+	cfg.Overlay.Enabled = true
+	if err := SaveConfig(path, cfg); err == nil {
+		t.Skip("这台机器的钥匙串能用，测不到加密失败")
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "SESSDATA") || !strings.Contains(string(data), `"sealed"`) {
+		t.Fatalf("旧的密文被冲掉了:\n%s", data)
+	}
+
+	t.Setenv(secret.PassphraseEnv, "hunter2")
+	loaded, err := LoadConfig(path)
+	if err != nil || loaded.Cookie != "SESSDATA=abc" || !loaded.Overlay.Enabled {
+		t.Fatalf("凭据丢了: %+v %v", loaded, err)
+	}
+}
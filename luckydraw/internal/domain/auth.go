@@ -14,4 +14,10 @@ type AuthService interface {
 	IsLoggedIn() bool
 	GetAccountInfo() (string, error)
 	Logout() error
+	GetAccounts() (string, error)
+	SwitchAccount(uid int64) (string, error)
+	RemoveAccount(uid int64) error
+	RefreshCookie() (string, error)
+	GetOpenPlatformSettings() (string, error)
+	SaveOpenPlatformSettings(accessKeyID, accessKeySecret string, appID int64, identityCode string) (string, error)
 }
@@ -1,10 +1,25 @@
 package domain
 
+import "luckydraw/internal/config"
+
 type LiveLotteryService interface {
 	ConnectLiveRooms(roomIDs []int) error
-	StartLiveLottery(keyword string) error
+	ConnectReplay(path string, speed float64) error
+	ConnectOpenPlatform(settings config.OpenPlatformConfig) error
+	StartLiveLottery(keyword string, profile config.ProfileConfig) error
+	StartLotteryWindow(keyword string, profile config.ProfileConfig, window config.LotteryWindow) error
+	GetLotteryWindow() (string, error)
 	StopLiveLottery() error
 	DrawWinners(count int) (string, error)
+	DrawPrizes(prizes []config.PrizeTier) (string, error)
 	GetParticipantCount() int
+	GetParticipants() (string, error)
+	GetLastWinners() (string, error)
+	RedrawWinner(historyID string, uid int64) (string, error)
+	AnnounceWinners() (string, error)
+	GetSeedCommitment() string
+	GetRoomStatuses() (string, error)
+	GetRejectedUsers() (string, error)
+	GetUndecodedPacketCount() int64
 	IsLiveLotteryRunning() bool
 }
@@ -0,0 +1,5 @@
+package domain
+
+type NoticeService interface {
+	NotifyWinners(historyID string) (string, error)
+}
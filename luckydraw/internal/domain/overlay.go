@@ -0,0 +1,7 @@
+package domain
+
+type OverlayService interface {
+	GetOverlaySettings() (string, error)
+	SaveOverlaySettings(enabled bool, addr string) (string, error)
+	ResetOverlayToken() (string, error)
+}
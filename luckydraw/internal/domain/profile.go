@@ -9,16 +9,34 @@ type ProfileService interface {
 	DeleteProfile(id string) error
 	RenameProfile(id, name string) error
 	SaveProfileConfig(keyword string, winnerCount int) error
+	SaveKeywordMatch(match config.KeywordMatch) error
+	SaveEligibilityRules(rules config.EligibilityRules) error
+	SavePrizeTiers(prizes []config.PrizeTier) error
+	SaveGiftEntry(mode string, gift config.GiftEntryRules) error
+	SaveWeighting(weighting config.WeightingConfig) error
+	SaveExclusionPolicy(policy config.ExclusionPolicy) error
+	ExcludedUIDs(profileID string) map[int64]string
+	GetExcludedUsers(profileID string) (string, error)
+	SaveRecording(enabled bool) error
+	SaveAnnounce(enabled bool) error
+	SaveClaimNotice(claim config.ClaimNotice) error
+	BindAccount(profileID string, uid int64) error
+	GetRecordings() (string, error)
 	SetBackgroundImage(imagePath string) error
 	GetBackgroundImage() string
 	AddWatchedRoom(roomID int) error
 	RemoveWatchedRoom(roomID int) error
 	GetWatchedRooms() (string, error)
 	ActiveProfile() *config.ProfileConfig
-	AddHistory(profileID, keyword string, winnerCount int, winners []config.HistoryWinner) error
+	AddHistory(profileID string, record config.HistoryRecord, participants []config.Participant) (string, error)
 	GetHistory(profileID string) (string, error)
 	DeleteHistory(profileID, historyID string) error
 	DeleteAllHistory(profileID string) error
+	LoadHistory(historyID string) (string, config.HistoryRecord, *config.ParticipantSnapshot, error)
+	AmendHistory(profileID, historyID string, amend func(*config.HistoryRecord) error) error
+	GetHistorySnapshot(profileID, historyID string) (string, error)
+	VerifyHistory(profileID, historyID string) (string, error)
+	ExportDrawProof(profileID, historyID, path string) (string, error)
 	HistoryExportFilename(profileID, historyID string) (string, error)
 	ExportHistory(profileID, historyID, path string) (string, error)
 }
@@ -0,0 +1,120 @@
+package event
+
+import "time"
+
+// 后端会发出的所有事件。live:user_join / live:user_reject 的内容是
+// live.DanmakuUser / live.Rejection，profile:* 的内容是配置的 JSON 字符串，
+// 其余事件的内容都是下面对应的结构体。
+const (
+	LiveUserJoin       = "live:user_join"
+	LiveUserReject     = "live:user_reject"
+	LiveLotteryStarted = "live:lottery_started"
+	LiveLotteryStopped = "live:lottery_stopped"
+	LiveDrawCompleted  = "live:draw_completed"
+	LiveWinnerRedrawn  = "live:winner_redrawn"
+	LiveCountdown      = "live:countdown"
+	LiveAnnounce       = "live:announce"
+	LiveWinnerNotified = "live:winner_notified"
+
+	RoomConnected    = "room:connected"
+	RoomDisconnected = "room:disconnected"
+	RoomReconnecting = "room:reconnecting"
+	RoomAuthFailed   = "room:auth_failed"
+	RoomOnline       = "room:online"
+
+	ProfileSwitched = "profile:switched"
+	ProfileCreated  = "profile:created"
+)
+
+type LotteryStarted struct {
+	Keyword    string `json:"keyword"`
+	Rooms      []int  `json:"rooms"`
+	Commitment string `json:"commitment"`
+	Algorithm  string `json:"algorithm"`
+}
+
+type LotteryStopped struct {
+	Participants int `json:"participants"`
+}
+
+type Winner struct {
+	UID      int64   `json:"uid"`
+	Username string  `json:"username"`
+	Weight   float64 `json:"weight,omitempty"`
+	Prize    string  `json:"prize,omitempty"`
+}
+
+type DrawCompleted struct {
+	HistoryID    string   `json:"history_id,omitempty"`
+	Count        int      `json:"count"`
+	Participants int      `json:"participants"`
+	Round        int      `json:"round"`
+	Auto         bool     `json:"auto,omitempty"`
+	Winners      []Winner `json:"winners"`
+	// Error 是抽出来了但历史没存上之类的问题，这时 HistoryID 是空的
+	Error string `json:"error,omitempty"`
+}
+
+// Announcement 是往直播间发的每一条中奖弹幕，Index 从 1 数，Total 是这个房间一共几条
+type Announcement struct {
+	RoomID  int    `json:"room_id"`
+	Message string `json:"message"`
+	Index   int    `json:"index"`
+	Total   int    `json:"total"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// WinnerNotice 是私信通知一个中奖者的结果
+type WinnerNotice struct {
+	HistoryID string `json:"history_id"`
+	UID       int64  `json:"uid"`
+	Username  string `json:"username"`
+	Sent      bool   `json:"sent"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Countdown 定时抽奖每秒发一次，Remaining 是剩下的秒数，到点时发一次 0
+type Countdown struct {
+	EndsAt    time.Time `json:"ends_at"`
+	Remaining int64     `json:"remaining"`
+	AutoDraw  bool      `json:"auto_draw"`
+}
+
+type WinnerRedrawn struct {
+	HistoryID   string `json:"history_id"`
+	Forfeited   int64  `json:"forfeited"`
+	Replacement Winner `json:"replacement"`
+}
+
+type RoomConnection struct {
+	RoomID     int    `json:"room_id"`
+	RealRoomID int    `json:"real_room_id"`
+	Host       string `json:"host"`
+	Reconnect  bool   `json:"reconnect"`
+}
+
+type RoomDisconnection struct {
+	RoomID     int    `json:"room_id"`
+	RealRoomID int    `json:"real_room_id"`
+	Error      string `json:"error,omitempty"`
+}
+
+type RoomReconnect struct {
+	RoomID  int   `json:"room_id"`
+	Attempt int   `json:"attempt"`
+	DelayMS int64 `json:"delay_ms"`
+}
+
+type RoomAuthFailure struct {
+	RoomID int    `json:"room_id"`
+	Code   int    `json:"code,omitempty"`
+	Error  string `json:"error"`
+}
+
+type RoomOnlineCount struct {
+	RoomID     int   `json:"room_id"`
+	RealRoomID int   `json:"real_room_id"`
+	Online     int64 `json:"online"`
+}
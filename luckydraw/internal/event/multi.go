@@ -0,0 +1,14 @@
+package event
+
+// 同一个事件发给好几个地方，比如窗口和 OBS 叠加层
+type Multi []Emitter
+
+func (m Multi) Emit(name string, data ...any) bool {
+	ok := false
+	for _, e := range m {
+		if e != nil && e.Emit(name, data...) {
+			ok = true
+		}
+	}
+	return ok
+}
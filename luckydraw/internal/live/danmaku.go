@@ -2,22 +2,28 @@ package live
 
 import (
 	"bytes"
-	"compress/gzip"
 	"compress/zlib"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
-	"strings"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/gorilla/websocket"
 	"luckydraw/internal/bili"
+	"luckydraw/internal/event"
 )
 
-var httpClient = bili.DefaultHTTPClient
+var (
+	Dialer = websocket.DefaultDialer
+
+	ReconnectBackoff    = 1 * time.Second
+	MaxReconnectBackoff = 30 * time.Second
+)
 
 const (
 	PacketHeaderLength    = 16
@@ -29,24 +35,70 @@ const (
 	OperationWelcome      = 8
 )
 
+const (
+	ProtoverJSON       = 0
+	ProtoverPopularity = 1
+	ProtoverZlib       = 2
+	ProtoverBrotli     = 3
+)
+
 type DanmakuClient struct {
 	roomID      int
 	conn        *websocket.Conn
 	stop        chan struct{}
 	mu          sync.Mutex
+	writeMu     sync.Mutex
 	users       map[int64]*DanmakuUser
-	onMessage   func(*DanmakuMessage)
-	cookie      string
+	messages    chan *DanmakuMessage
+	api         *bili.Client
 	authSuccess bool
 	online      int64
 	uid         int64
-	buvid       string
+	realRoomID  int
+	anchorUID   int64
+	protover    int
+	undecoded   atomic.Int64
+	connects    int
+	emitter     event.Emitter
+	title       string
+	liveStatus  int
+	host        string
+	connected   bool
+	lastMessage time.Time
+	reconnects  int
+	lastError   string
+	recorder    *Recorder
+	dialer      *websocket.Dialer
+	apiBase     string
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	// 开放平台之类的源用这两个换掉房间信息的来源和消息格式
+	resolve func() (*RoomInfo, error)
+	convert func(*DanmakuMessage) (*DanmakuMessage, bool)
 }
 
 type DanmakuUser struct {
-	UID      int64  `json:"uid"`
-	Username string `json:"username"`
-	Count    int    `json:"count"`
+	UID        int64     `json:"uid"`
+	Username   string    `json:"username"`
+	Count      int       `json:"count"`
+	Action     string    `json:"action,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	Coin       int64     `json:"coin,omitempty"`
+	GuardLevel int       `json:"guard_level,omitempty"`
+	Weight     float64   `json:"weight,omitempty"`
+	RoomID     int       `json:"room_id,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	FirstSeen  time.Time `json:"first_seen"`
+	Excluded   string    `json:"excluded,omitempty"`
+	Medal      *FanMedal `json:"medal,omitempty"`
+	UserLevel  int       `json:"user_level,omitempty"`
+	Prize      string    `json:"prize,omitempty"`
+
+	// 奖项的资格到开奖时才查，粉丝牌是不是本房间的要用进场时的房间信息
+	anchorUID  int64
+	realRoomID int
+	// 消息里没带 UL 时 UserLevel 留 0 给前端看，这里记着其实不知道
+	levelKnown bool
 }
 
 type DanmakuMessage struct {
@@ -63,6 +115,22 @@ type RoomInfo struct {
 	LiveStatus   int    `json:"live_status"`
 	DanmakuToken string
 	HostList     []DanmakuHost
+	AuthBody     string
+}
+
+type RoomStatus struct {
+	RoomID            int       `json:"room_id"`
+	RealRoomID        int       `json:"real_room_id"`
+	Title             string    `json:"title"`
+	LiveStatus        int       `json:"live_status"`
+	Connected         bool      `json:"connected"`
+	Host              string    `json:"host,omitempty"`
+	LastMessage       time.Time `json:"last_message"`
+	ReconnectAttempts int       `json:"reconnect_attempts"`
+	Online            int64     `json:"online"`
+	LastError         string    `json:"last_error,omitempty"`
+	AnchorUID         int64     `json:"anchor_uid,omitempty"`
+	Undecoded         int64     `json:"undecoded,omitempty"`
 }
 
 type DanmakuHost struct {
@@ -71,48 +139,68 @@ type DanmakuHost struct {
 }
 
 type DanmakuInfo struct {
-	UID      int64
-	Username string
-	Message  string
+	UID        int64
+	Username   string
+	Message    string
+	Medal      *FanMedal
+	UserLevel  int
+	GuardLevel int
 }
 
 func NewDanmakuClient(roomID int, cookie string) *DanmakuClient {
-	uid, buvid := extractUIDAndBuvid(cookie)
-	return &DanmakuClient{
-		roomID: roomID,
-		stop:   make(chan struct{}),
-		users:  make(map[int64]*DanmakuUser),
-		cookie: cookie,
-		uid:    uid,
-		buvid:  buvid,
-	}
+	return newDanmakuClient(roomID, bili.NewClient(cookie))
 }
 
-func extractUIDAndBuvid(cookie string) (int64, string) {
-	var uid int64
-	var buvid string
-	parts := strings.Split(cookie, ";")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if strings.HasPrefix(part, "DedeUserID=") {
-			fmt.Sscanf(strings.TrimPrefix(part, "DedeUserID="), "%d", &uid)
-		} else if strings.HasPrefix(part, "buvid3=") {
-			buvid = strings.TrimPrefix(part, "buvid3=")
-		}
+// 同一场的几个房间共用一个 bili.Client，WBI key 和 buvid 只拿一次
+func newDanmakuClient(roomID int, api *bili.Client) *DanmakuClient {
+	uid, _ := strconv.ParseInt(api.CookieValue("DedeUserID"), 10, 64)
+	return &DanmakuClient{
+		roomID:   roomID,
+		stop:     make(chan struct{}),
+		users:    make(map[int64]*DanmakuUser),
+		api:      api,
+		uid:      uid,
+		protover: ProtoverBrotli,
+		messages: make(chan *DanmakuMessage, messageBuffer),
+		// 创建时就定下地址和连接方式，后台重连不再去读包级变量
+		dialer:     Dialer,
+		apiBase:    bili.LiveAPIBaseURL,
+		backoff:    ReconnectBackoff,
+		maxBackoff: MaxReconnectBackoff,
 	}
-	return uid, buvid
 }
 
 func (c *DanmakuClient) Connect() error {
-	return c.connectWithRetry(true)
+	err := c.connectWithRetry()
+	if err != nil {
+		// 第一次没连上也别放弃，状态里能看到在重连
+		c.setError(err)
+		c.emit(event.RoomDisconnected, event.RoomDisconnection{RoomID: c.roomID, Error: err.Error()})
+		go c.reconnect()
+	}
+	return err
 }
 
-func (c *DanmakuClient) connectWithRetry(isReconnect bool) error {
-	roomInfo, err := c.getRoomInfo()
+func (c *DanmakuClient) connectWithRetry() error {
+	resolve := c.resolve
+	if resolve == nil {
+		resolve = c.getRoomInfo
+	}
+	roomInfo, err := resolve()
 	if err != nil {
 		return fmt.Errorf("找不到直播间信息了喵: %v", err)
 	}
 
+	c.mu.Lock()
+	if c.roomID == 0 {
+		c.roomID = roomInfo.RoomID
+	}
+	c.realRoomID = roomInfo.RoomID
+	c.anchorUID = roomInfo.UID
+	c.title = roomInfo.Title
+	c.liveStatus = roomInfo.LiveStatus
+	c.mu.Unlock()
+
 	hosts := roomInfo.HostList
 	if len(hosts) == 0 {
 		hosts = []DanmakuHost{
@@ -125,8 +213,8 @@ func (c *DanmakuClient) connectWithRetry(isReconnect bool) error {
 		if port == 0 {
 			port = 443
 		}
-		wsURL := fmt.Sprintf("wss://%s:%d/sub", host.Host, port)
-		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		addr := fmt.Sprintf("%s:%d", host.Host, port)
+		conn, _, err := c.dialer.Dial("wss://"+addr+"/sub", nil)
 		if err != nil {
 			continue
 		}
@@ -139,8 +227,9 @@ func (c *DanmakuClient) connectWithRetry(isReconnect bool) error {
 		authChan := make(chan bool, 1)
 
 		go func() {
-			c.receiveMessagesWithAuth(authChan)
-			if !isReconnect {
+			authed, err := c.receiveMessagesWithAuth(authChan)
+			// 没认证上的连接由下面的循环换下一个地址，这里只管掉线重连
+			if !authed {
 				return
 			}
 			select {
@@ -148,27 +237,21 @@ func (c *DanmakuClient) connectWithRetry(isReconnect bool) error {
 				return
 			default:
 			}
-			backoff := 1 * time.Second
-			maxBackoff := 30 * time.Second
-			for {
-				select {
-				case <-c.stop:
-					return
-				case <-time.After(backoff):
-				}
-				if err := c.connectWithRetry(true); err == nil {
-					return
-				}
-				backoff *= 2
-				if backoff > maxBackoff {
-					backoff = maxBackoff
-				}
-			}
+			c.mu.Lock()
+			c.connected = false
+			c.mu.Unlock()
+			c.setError(err)
+			c.emit(event.RoomDisconnected, event.RoomDisconnection{
+				RoomID:     c.roomID,
+				RealRoomID: roomInfo.RoomID,
+				Error:      errString(err),
+			})
+			c.reconnect()
 		}()
 
 		time.Sleep(200 * time.Millisecond)
 
-		if err := c.sendAuth(roomInfo.RoomID, roomInfo.DanmakuToken); err != nil {
+		if err := c.sendAuth(roomInfo); err != nil {
 			conn.Close()
 			continue
 		}
@@ -176,11 +259,25 @@ func (c *DanmakuClient) connectWithRetry(isReconnect bool) error {
 		select {
 		case success := <-authChan:
 			if success {
+				c.mu.Lock()
+				reconnected := c.connects > 0
+				c.connects++
+				c.connected = true
+				c.host = addr
+				c.mu.Unlock()
+				c.emit(event.RoomConnected, event.RoomConnection{
+					RoomID:     c.roomID,
+					RealRoomID: roomInfo.RoomID,
+					Host:       addr,
+					Reconnect:  reconnected,
+				})
 				go c.heartbeat()
 				return nil
 			}
 			conn.Close()
 		case <-time.After(5 * time.Second):
+			c.setError(fmt.Errorf("认证超时"))
+			c.emit(event.RoomAuthFailed, event.RoomAuthFailure{RoomID: c.roomID, Error: "认证超时"})
 			conn.Close()
 			continue
 		}
@@ -189,35 +286,36 @@ func (c *DanmakuClient) connectWithRetry(isReconnect bool) error {
 	return fmt.Errorf("老大我们连接都失败了哎！")
 }
 
-func (c *DanmakuClient) getRoomInfo() (*RoomInfo, error) {
-	roomURL := fmt.Sprintf("https://api.live.bilibili.com/room/v1/Room/get_info?room_id=%d", c.roomID)
-	req1, err := http.NewRequest("GET", roomURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req1.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req1.Header.Set("Accept", "application/json, text/plain, */*")
-	req1.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
-	req1.Header.Set("Referer", "https://live.bilibili.com/")
-	req1.Header.Set("Origin", "https://live.bilibili.com")
-	req1.Header.Set("Connection", "close")
-	if c.cookie != "" {
-		req1.Header.Set("Cookie", c.cookie)
-	}
-
-	resp, err := httpClient.Do(req1)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		io.Copy(io.Discard, resp.Body)
-		return nil, fmt.Errorf("火星的网络有点意思: HTTP %d", resp.StatusCode)
+func (c *DanmakuClient) reconnect() {
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		c.emit(event.RoomReconnecting, event.RoomReconnect{
+			RoomID:  c.roomID,
+			Attempt: attempt,
+			DelayMS: backoff.Milliseconds(),
+		})
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(backoff):
+		}
+		c.mu.Lock()
+		c.reconnects++
+		c.mu.Unlock()
+		err := c.connectWithRetry()
+		if err == nil {
+			return
+		}
+		c.setError(err)
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
 	}
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (c *DanmakuClient) getRoomInfo() (*RoomInfo, error) {
+	body, err := c.api.Get(c.apiBase+"/room/v1/Room/get_info", map[string]string{"room_id": strconv.Itoa(c.roomID)})
 	if err != nil {
 		return nil, err
 	}
@@ -242,32 +340,16 @@ func (c *DanmakuClient) getRoomInfo() (*RoomInfo, error) {
 
 	realRoomID := roomData.RoomID
 	if realRoomID == 0 {
-		mobileURL := fmt.Sprintf("https://api.live.bilibili.com/room/v1/Room/mobileRoomInit?id=%d", c.roomID)
-		reqMobile, err := http.NewRequest("GET", mobileURL, nil)
+		bodyMobile, err := c.api.Get(c.apiBase+"/room/v1/Room/mobileRoomInit", map[string]string{"id": strconv.Itoa(c.roomID)})
 		if err == nil {
-			reqMobile.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-			reqMobile.Header.Set("Accept", "application/json, text/plain, */*")
-			reqMobile.Header.Set("Connection", "close")
-			if c.cookie != "" {
-				reqMobile.Header.Set("Cookie", c.cookie)
+			var mobileResult struct {
+				Code int `json:"code"`
+				Data struct {
+					RoomID int `json:"room_id"`
+				} `json:"data"`
 			}
-			respMobile, err := httpClient.Do(reqMobile)
-			if err == nil {
-				defer respMobile.Body.Close()
-				if respMobile.StatusCode == http.StatusOK {
-					bodyMobile, _ := io.ReadAll(respMobile.Body)
-					var mobileResult struct {
-						Code int `json:"code"`
-						Data struct {
-							RoomID int `json:"room_id"`
-						} `json:"data"`
-					}
-					if json.Unmarshal(bodyMobile, &mobileResult) == nil && mobileResult.Code == 0 && mobileResult.Data.RoomID > 0 {
-						realRoomID = mobileResult.Data.RoomID
-					}
-				} else {
-					io.Copy(io.Discard, respMobile.Body)
-				}
+			if json.Unmarshal(bodyMobile, &mobileResult) == nil && mobileResult.Code == 0 && mobileResult.Data.RoomID > 0 {
+				realRoomID = mobileResult.Data.RoomID
 			}
 		}
 		if realRoomID == 0 {
@@ -278,166 +360,130 @@ func (c *DanmakuClient) getRoomInfo() (*RoomInfo, error) {
 	roomInfo := &roomData
 	roomInfo.RoomID = realRoomID
 
-	danmakuURLs := []string{
-		fmt.Sprintf("https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?id=%d&type=0", realRoomID),
-		fmt.Sprintf("https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?id=%d", realRoomID),
-		fmt.Sprintf("https://api.live.bilibili.com/room/v1/Danmu/getConf?room_id=%d", realRoomID),
+	if hosts, token, err := c.getDanmuInfo(realRoomID); err == nil && len(hosts) > 0 {
+		roomInfo.DanmakuToken = token
+		roomInfo.HostList = hosts
+		return roomInfo, nil
+	}
+	if hosts, token, err := c.getDanmuConf(realRoomID); err == nil && len(hosts) > 0 {
+		roomInfo.DanmakuToken = token
+		roomInfo.HostList = hosts
+		return roomInfo, nil
 	}
 
-	for i, danmakuURL := range danmakuURLs {
-		req2, err := http.NewRequest("GET", danmakuURL, nil)
-		if err != nil {
-			continue
-		}
-
-		req2.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-		req2.Header.Set("Accept", "application/json, text/plain, */*")
-		req2.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
-		req2.Header.Set("Referer", fmt.Sprintf("https://live.bilibili.com/%d", realRoomID))
-		req2.Header.Set("Origin", "https://live.bilibili.com")
-		req2.Header.Set("Connection", "close")
-		req2.Header.Set("Sec-Fetch-Dest", "empty")
-		req2.Header.Set("Sec-Fetch-Mode", "cors")
-		req2.Header.Set("Sec-Fetch-Site", "same-site")
-		req2.Header.Set("Sec-Ch-Ua", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
-		req2.Header.Set("Sec-Ch-Ua-Mobile", "?0")
-		req2.Header.Set("Sec-Ch-Ua-Platform", `"Windows"`)
-
-		if c.cookie != "" {
-			req2.Header.Set("Cookie", c.cookie)
-			req2.Header.Set("X-Requested-With", "XMLHttpRequest")
-		}
+	roomInfo.DanmakuToken = ""
+	roomInfo.HostList = []DanmakuHost{
+		{Host: "broadcastlv.chat.bilibili.com", Port: 443},
+		{Host: "zj-cn-live-comet.chat.bilibili.com", Port: 443},
+	}
+	return roomInfo, nil
+}
 
-		resp2, err := httpClient.Do(req2)
+// getDanmuInfo 现在不签 WBI 会回 -352；碰上了就换一把 key 再试一次
+func (c *DanmakuClient) getDanmuInfo(realRoomID int) ([]DanmakuHost, string, error) {
+	params := map[string]string{
+		"id":           strconv.Itoa(realRoomID),
+		"type":         "0",
+		"web_location": "444.8",
+	}
+	var result struct {
+		Code int `json:"code"`
+		Data struct {
+			Token    string        `json:"token"`
+			HostList []DanmakuHost `json:"host_list"`
+		} `json:"data"`
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		body, err := c.api.GetWbi(c.apiBase+"/xlive/web-room/v1/index/getDanmuInfo", params)
 		if err != nil {
-			continue
+			return nil, "", err
 		}
-		defer resp2.Body.Close()
-
-		if resp2.StatusCode != http.StatusOK {
-			io.Copy(io.Discard, resp2.Body)
-			continue
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, "", err
 		}
-
-		body2, err := io.ReadAll(resp2.Body)
-		if err != nil {
-			continue
+		if result.Code != -352 {
+			break
 		}
+		c.api.InvalidateWbi()
+	}
+	if result.Code != 0 {
+		return nil, "", fmt.Errorf("getDanmuInfo: code=%d", result.Code)
+	}
 
-		contentEncoding := resp2.Header.Get("Content-Encoding")
-		if contentEncoding == "gzip" || (len(body2) > 2 && body2[0] == 0x1f && body2[1] == 0x8b) {
-			reader, err := gzip.NewReader(bytes.NewReader(body2))
-			if err == nil {
-				defer reader.Close()
-				body2, err = io.ReadAll(reader)
-				if err != nil {
-					continue
-				}
-			}
+	hosts := result.Data.HostList
+	for i := range hosts {
+		if hosts[i].Port == 2243 {
+			hosts[i].Port = 443
 		}
+	}
+	return hosts, result.Data.Token, nil
+}
 
-		if i == 2 {
-			var danmakuResult2 struct {
-				Code int `json:"code"`
-				Data struct {
-					Token          string `json:"token"`
-					Host           string `json:"host"`
-					Port           int    `json:"port"`
-					HostServerList []struct {
-						Host    string `json:"host"`
-						Port    int    `json:"port"`
-						WssPort int    `json:"wss_port"`
-					} `json:"host_server_list"`
-					ServerList []struct {
-						Host string `json:"host"`
-						Port int    `json:"port"`
-					} `json:"server_list"`
-				} `json:"data"`
-			}
-
-			if err := json.Unmarshal(body2, &danmakuResult2); err == nil && danmakuResult2.Code == 0 {
-				roomInfo.DanmakuToken = danmakuResult2.Data.Token
-				if len(danmakuResult2.Data.HostServerList) > 0 {
-					hostList := make([]DanmakuHost, 0, len(danmakuResult2.Data.HostServerList))
-					for _, host := range danmakuResult2.Data.HostServerList {
-						port := host.WssPort
-						if port == 0 {
-							port = host.Port
-						}
-						if port == 0 {
-							port = 443
-						}
-						hostList = append(hostList, DanmakuHost{
-							Host: host.Host,
-							Port: port,
-						})
-					}
-					roomInfo.HostList = hostList
-					return roomInfo, nil
-				} else if danmakuResult2.Data.Host != "" {
-					port := danmakuResult2.Data.Port
-					if port == 0 {
-						port = 443
-					}
-					roomInfo.HostList = []DanmakuHost{
-						{Host: danmakuResult2.Data.Host, Port: port},
-					}
-					return roomInfo, nil
-				}
-			}
-		} else {
-			var danmakuResult struct {
-				Code int `json:"code"`
-				Data struct {
-					Token    string        `json:"token"`
-					HostList []DanmakuHost `json:"host_list"`
-				} `json:"data"`
-			}
+func (c *DanmakuClient) getDanmuConf(realRoomID int) ([]DanmakuHost, string, error) {
+	body, err := c.api.Get(c.apiBase+"/room/v1/Danmu/getConf", map[string]string{"room_id": strconv.Itoa(realRoomID)})
+	if err != nil {
+		return nil, "", err
+	}
+	var result struct {
+		Code int `json:"code"`
+		Data struct {
+			Token          string `json:"token"`
+			Host           string `json:"host"`
+			Port           int    `json:"port"`
+			HostServerList []struct {
+				Host    string `json:"host"`
+				Port    int    `json:"port"`
+				WssPort int    `json:"wss_port"`
+			} `json:"host_server_list"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, "", err
+	}
+	if result.Code != 0 {
+		return nil, "", fmt.Errorf("getConf: code=%d", result.Code)
+	}
 
-			if err := json.Unmarshal(body2, &danmakuResult); err == nil && danmakuResult.Code == 0 {
-				roomInfo.DanmakuToken = danmakuResult.Data.Token
-				roomInfo.HostList = danmakuResult.Data.HostList
-				if len(roomInfo.HostList) > 0 {
-					for i := range roomInfo.HostList {
-						if roomInfo.HostList[i].Port == 2243 {
-							roomInfo.HostList[i].Port = 443
-						}
-					}
-					return roomInfo, nil
-				}
-			}
+	hosts := make([]DanmakuHost, 0, len(result.Data.HostServerList))
+	for _, host := range result.Data.HostServerList {
+		port := host.WssPort
+		if port == 0 {
+			port = host.Port
+		}
+		if port == 0 {
+			port = 443
 		}
+		hosts = append(hosts, DanmakuHost{Host: host.Host, Port: port})
 	}
-
-	if len(roomInfo.HostList) == 0 {
-		defaultHosts := []DanmakuHost{
-			{Host: "broadcastlv.chat.bilibili.com", Port: 443},
-			{Host: "zj-cn-live-comet.chat.bilibili.com", Port: 443},
+	if len(hosts) == 0 && result.Data.Host != "" {
+		port := result.Data.Port
+		if port == 0 {
+			port = 443
 		}
-		roomInfo.DanmakuToken = ""
-		roomInfo.HostList = defaultHosts
-		return roomInfo, nil
+		hosts = append(hosts, DanmakuHost{Host: result.Data.Host, Port: port})
 	}
-
-	return roomInfo, nil
+	return hosts, result.Data.Token, nil
 }
 
-func (c *DanmakuClient) sendAuth(roomID int, token string) error {
-	authData := map[string]interface{}{
-		"uid":      c.uid,
-		"roomid":   roomID,
-		"protover": 2,
-		"platform": "web",
-		"type":     2,
-	}
-	if token != "" {
-		authData["key"] = token
-	}
-	if c.buvid != "" {
-		authData["buvid"] = c.buvid
+func (c *DanmakuClient) sendAuth(roomInfo *RoomInfo) error {
+	// 开放平台直接给了整段认证包，不用再去拼，也不用问 buvid
+	data := []byte(roomInfo.AuthBody)
+	if roomInfo.AuthBody == "" {
+		authData := map[string]interface{}{
+			"uid":      c.uid,
+			"roomid":   roomInfo.RoomID,
+			"protover": c.Protover(),
+			"platform": "web",
+			"type":     2,
+		}
+		if roomInfo.DanmakuToken != "" {
+			authData["key"] = roomInfo.DanmakuToken
+		}
+		if buvid, err := c.api.Buvid(); err == nil {
+			authData["buvid"] = buvid.B3
+		}
+		data, _ = json.Marshal(authData)
 	}
-
-	data, _ := json.Marshal(authData)
 	packet := c.makePacket(data, OperationJoin)
 
 	c.mu.Lock()
@@ -448,6 +494,12 @@ func (c *DanmakuClient) sendAuth(roomID int, token string) error {
 		return fmt.Errorf("暂时还没对齐颗粒度……")
 	}
 
+	return c.write(conn, packet)
+}
+
+func (c *DanmakuClient) write(conn *websocket.Conn, packet []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 	return conn.WriteMessage(websocket.BinaryMessage, packet)
 }
 
@@ -482,25 +534,25 @@ func (c *DanmakuClient) heartbeat() {
 			}
 			heartbeatBody := []byte("[Object object]")
 			packet := c.makePacket(heartbeatBody, OperationHeartbeat)
-			if err := conn.WriteMessage(websocket.BinaryMessage, packet); err != nil {
+			if err := c.write(conn, packet); err != nil {
 				return
 			}
 		}
 	}
 }
 
-func (c *DanmakuClient) receiveMessagesWithAuth(authChan chan<- bool) {
+func (c *DanmakuClient) receiveMessagesWithAuth(authChan chan<- bool) (bool, error) {
 	authSent := false
 	for {
 		select {
 		case <-c.stop:
-			return
+			return authSent, nil
 		default:
 			c.mu.Lock()
 			conn := c.conn
 			c.mu.Unlock()
 			if conn == nil {
-				return
+				return authSent, nil
 			}
 
 			_, message, err := conn.ReadMessage()
@@ -511,7 +563,10 @@ func (c *DanmakuClient) receiveMessagesWithAuth(authChan chan<- bool) {
 					default:
 					}
 				}
-				return
+				c.mu.Lock()
+				authed := authSent && c.authSuccess && c.conn == conn
+				c.mu.Unlock()
+				return authed, err
 			}
 			c.parsePacket(message, authChan, &authSent)
 		}
@@ -556,20 +611,59 @@ func (c *DanmakuClient) parsePacket(data []byte, authChan chan<- bool, authSent
 		switch header.Operation {
 		case OperationMessage:
 			switch header.ProtocolVer {
-			case 2:
-				reader, err := zlib.NewReader(bytes.NewReader(bodyData))
-				if err == nil {
-					decompressed, _ := io.ReadAll(reader)
-					reader.Close()
-					c.parsePacket(decompressed, authChan, authSent)
+			case ProtoverZlib, ProtoverBrotli:
+				decompressed, err := c.decompress(header.ProtocolVer, bodyData)
+				if err != nil {
+					c.undecoded.Add(1)
+					continue
+				}
+				c.parsePacket(decompressed, authChan, authSent)
+			case ProtoverJSON:
+				if c.convert == nil {
+					c.record(bodyData)
 				}
-			case 0:
 				var msg DanmakuMessage
-				if err := json.Unmarshal(bodyData, &msg); err == nil {
+				if err := json.Unmarshal(bodyData, &msg); err != nil {
+					c.undecoded.Add(1)
+					continue
+				}
+				if c.convert == nil {
 					c.handleMessage(&msg)
+					continue
 				}
+				// 转换后再录，回放时就跟网页端的录像一样
+				converted, ok := c.convert(&msg)
+				if !ok {
+					c.undecoded.Add(1)
+					continue
+				}
+				if data, err := json.Marshal(converted); err == nil {
+					c.record(data)
+				}
+				c.handleMessage(converted)
+			default:
+				c.undecoded.Add(1)
 			}
 		case OperationWelcome:
+			var welcome struct {
+				Code int `json:"code"`
+			}
+			json.Unmarshal(bodyData, &welcome)
+			if welcome.Code != 0 {
+				authErr := fmt.Errorf("认证被拒绝了: code=%d", welcome.Code)
+				c.setError(authErr)
+				c.emit(event.RoomAuthFailed, event.RoomAuthFailure{
+					RoomID: c.roomID,
+					Code:   welcome.Code,
+					Error:  authErr.Error(),
+				})
+				select {
+				case authChan <- false:
+				default:
+				}
+				continue
+			}
+
 			c.mu.Lock()
 			c.authSuccess = true
 			conn := c.conn
@@ -583,57 +677,74 @@ func (c *DanmakuClient) parsePacket(data []byte, authChan chan<- bool, authSent
 			}
 			if conn != nil {
 				packet := c.makePacket([]byte{}, OperationHeartbeat)
-				conn.WriteMessage(websocket.BinaryMessage, packet)
+				c.write(conn, packet)
 			}
 		case OperationHeartbeatAck:
 			if len(bodyData) == 4 {
-				online := binary.BigEndian.Uint32(bodyData)
+				online := int64(binary.BigEndian.Uint32(bodyData))
 				c.mu.Lock()
-				c.online = int64(online)
+				changed := c.online != online
+				c.online = online
+				realRoomID := c.realRoomID
 				c.mu.Unlock()
+				if changed {
+					c.emit(event.RoomOnline, event.RoomOnlineCount{
+						RoomID:     c.roomID,
+						RealRoomID: realRoomID,
+						Online:     online,
+					})
+				}
 			}
 		}
 	}
 }
 
-func (c *DanmakuClient) handleMessage(msg *DanmakuMessage) {
-	if c.onMessage != nil {
-		c.onMessage(msg)
-	}
-
-	if msg.CMD == "DANMU_MSG" {
-		var info []interface{}
-		if err := json.Unmarshal(msg.Info, &info); err != nil {
-			return
+func (c *DanmakuClient) decompress(ver int16, body []byte) ([]byte, error) {
+	if ver == ProtoverBrotli {
+		data, err := io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+		if err == nil {
+			return data, nil
 		}
-
-		if len(info) < 3 {
-			return
+		data, zerr := inflate(body)
+		if zerr != nil {
+			return nil, err
 		}
+		c.mu.Lock()
+		c.protover = ProtoverZlib
+		c.mu.Unlock()
+		return data, nil
+	}
+	return inflate(body)
+}
 
-		userInfo, ok := info[2].([]interface{})
-		if !ok || len(userInfo) < 2 {
-			return
-		}
+func inflate(body []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
 
-		uidFloat, ok := userInfo[0].(float64)
-		if !ok {
-			return
-		}
-		uid := int64(uidFloat)
+func (c *DanmakuClient) handleMessage(msg *DanmakuMessage) {
+	c.mu.Lock()
+	c.lastMessage = time.Now()
+	c.mu.Unlock()
 
-		username, ok := userInfo[1].(string)
-		if !ok {
-			return
-		}
+	select {
+	case c.messages <- msg:
+	case <-c.stop:
+		return
+	}
 
+	if info, ok := ParseDanmaku(msg); ok {
 		c.mu.Lock()
-		if user, exists := c.users[uid]; exists {
+		if user, exists := c.users[info.UID]; exists {
 			user.Count++
 		} else {
-			c.users[uid] = &DanmakuUser{
-				UID:      uid,
-				Username: username,
+			c.users[info.UID] = &DanmakuUser{
+				UID:      info.UID,
+				Username: info.Username,
 				Count:    1,
 			}
 		}
@@ -660,11 +771,121 @@ func (c *DanmakuClient) Close() {
 		close(c.stop)
 	}
 
-	if c.conn != nil {
-		c.conn.Close()
+	c.mu.Lock()
+	conn := c.conn
+	c.connected = false
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func (c *DanmakuClient) RoomID() int {
+	return c.roomID
+}
+
+func (c *DanmakuClient) RealRoomID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.realRoomID == 0 {
+		return c.roomID
+	}
+	return c.realRoomID
+}
+
+func (c *DanmakuClient) AnchorUID() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.anchorUID
+}
+
+func (c *DanmakuClient) Protover() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.protover
+}
+
+func (c *DanmakuClient) SetProtover(protover int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.protover = protover
+}
+
+func (c *DanmakuClient) UndecodedPackets() int64 {
+	return c.undecoded.Load()
+}
+
+func (c *DanmakuClient) Status() RoomStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return RoomStatus{
+		RoomID:            c.roomID,
+		RealRoomID:        c.realRoomID,
+		Title:             c.title,
+		LiveStatus:        c.liveStatus,
+		Connected:         c.connected,
+		Host:              c.host,
+		LastMessage:       c.lastMessage,
+		ReconnectAttempts: c.reconnects,
+		Online:            c.online,
+		LastError:         c.lastError,
+		AnchorUID:         c.anchorUID,
+		Undecoded:         c.undecoded.Load(),
+	}
+}
+
+func (c *DanmakuClient) Messages() <-chan *DanmakuMessage {
+	return c.messages
+}
+
+func (c *DanmakuClient) SetRecorder(recorder *Recorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recorder = recorder
+}
+
+func (c *DanmakuClient) record(body []byte) {
+	c.mu.Lock()
+	recorder := c.recorder
+	msg := RecordedMessage{
+		Time:       time.Now(),
+		RoomID:     c.roomID,
+		RealRoomID: c.realRoomID,
+		AnchorUID:  c.anchorUID,
+		Message:    append(json.RawMessage(nil), body...),
+	}
+	c.mu.Unlock()
+	if recorder != nil {
+		recorder.Record(msg)
+	}
+}
+
+func (c *DanmakuClient) setError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.lastError = err.Error()
 	}
 }
 
-func (c *DanmakuClient) SetOnMessage(handler func(*DanmakuMessage)) {
-	c.onMessage = handler
+func (c *DanmakuClient) SetEmitter(emitter event.Emitter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.emitter = emitter
+}
+
+func (c *DanmakuClient) emit(name string, payload any) {
+	c.mu.Lock()
+	emitter := c.emitter
+	c.mu.Unlock()
+	if emitter != nil {
+		emitter.Emit(name, payload)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
 }
@@ -0,0 +1,189 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"luckydraw/internal/config"
+)
+
+const (
+	GuardNone     = 0
+	GuardGovernor = 1
+	GuardAdmiral  = 2
+	GuardCaptain  = 3
+)
+
+const (
+	RejectNoMedal       = "no_medal"
+	RejectMedalMismatch = "medal_mismatch"
+	RejectMedalLevel    = "medal_level"
+	RejectUserLevel     = "user_level"
+	RejectGuardLevel    = "guard_level"
+	RejectExcluded      = "excluded"
+)
+
+type FanMedal struct {
+	Name       string `json:"name"`
+	Level      int    `json:"level"`
+	AnchorUID  int64  `json:"anchor_uid"`
+	AnchorName string `json:"anchor_name"`
+	RoomID     int    `json:"room_id"`
+}
+
+type Rejection struct {
+	UID      int64  `json:"uid"`
+	Username string `json:"username"`
+	RoomID   int    `json:"room_id"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+}
+
+func ParseDanmaku(msg *DanmakuMessage) (*DanmakuInfo, bool) {
+	if msg.CMD != "DANMU_MSG" {
+		return nil, false
+	}
+
+	var info []json.RawMessage
+	if err := json.Unmarshal(msg.Info, &info); err != nil || len(info) < 3 {
+		return nil, false
+	}
+
+	var message string
+	if err := json.Unmarshal(info[1], &message); err != nil {
+		return nil, false
+	}
+
+	var userInfo []any
+	if err := json.Unmarshal(info[2], &userInfo); err != nil || len(userInfo) < 2 {
+		return nil, false
+	}
+	uidFloat, ok := userInfo[0].(float64)
+	if !ok {
+		return nil, false
+	}
+	username, ok := userInfo[1].(string)
+	if !ok {
+		return nil, false
+	}
+
+	d := &DanmakuInfo{
+		UID:      int64(uidFloat),
+		Username: username,
+		Message:  message,
+	}
+
+	if len(info) > 3 {
+		var medal []any
+		if json.Unmarshal(info[3], &medal) == nil && len(medal) >= 2 {
+			m := &FanMedal{
+				Level: intAt(medal, 0),
+				Name:  stringAt(medal, 1),
+			}
+			m.AnchorName = stringAt(medal, 2)
+			m.RoomID = intAt(medal, 3)
+			m.AnchorUID = int64(intAt(medal, 12))
+			if m.Name != "" {
+				d.Medal = m
+			}
+		}
+	}
+
+	if len(info) > 4 {
+		var level []any
+		if json.Unmarshal(info[4], &level) == nil {
+			d.UserLevel = intAt(level, 0)
+		}
+	}
+
+	if len(info) > 7 {
+		var guard int
+		if json.Unmarshal(info[7], &guard) == nil {
+			d.GuardLevel = guard
+		}
+	}
+
+	return d, true
+}
+
+func intAt(arr []any, i int) int {
+	if i >= len(arr) {
+		return 0
+	}
+	f, _ := arr[i].(float64)
+	return int(f)
+}
+
+func stringAt(arr []any, i int) string {
+	if i >= len(arr) {
+		return ""
+	}
+	s, _ := arr[i].(string)
+	return s
+}
+
+func (u *DanmakuUser) info() *DanmakuInfo {
+	level := u.UserLevel
+	if !u.levelKnown {
+		level = UnknownUserLevel
+	}
+	return &DanmakuInfo{
+		UID:        u.UID,
+		Username:   u.Username,
+		Message:    u.Message,
+		Medal:      u.Medal,
+		UserLevel:  level,
+		GuardLevel: u.GuardLevel,
+	}
+}
+
+func checkEligibility(rules config.EligibilityRules, d *DanmakuInfo, anchorUID int64, roomID int) (string, string) {
+	needMedal := rules.MedalName != "" || rules.MedalOwnRoom || rules.MinMedalLevel > 0
+	if needMedal {
+		if d.Medal == nil {
+			return RejectNoMedal, "没戴粉丝牌喵"
+		}
+		if rules.MedalName != "" && d.Medal.Name != rules.MedalName {
+			return RejectMedalMismatch, fmt.Sprintf("戴的是「%s」不是「%s」", d.Medal.Name, rules.MedalName)
+		}
+		if rules.MedalOwnRoom {
+			own := d.Medal.AnchorUID != 0 && d.Medal.AnchorUID == anchorUID
+			if anchorUID == 0 || d.Medal.AnchorUID == 0 {
+				own = d.Medal.RoomID != 0 && d.Medal.RoomID == roomID
+			}
+			if !own {
+				return RejectMedalMismatch, fmt.Sprintf("「%s」不是本直播间的粉丝牌", d.Medal.Name)
+			}
+		}
+		if d.Medal.Level < rules.MinMedalLevel {
+			return RejectMedalLevel, fmt.Sprintf("粉丝牌 %d 级，要 %d 级", d.Medal.Level, rules.MinMedalLevel)
+		}
+	}
+
+	// 礼物、上舰和开放平台的消息里没有 UL，要求了等级就没法放行
+	if rules.MinUserLevel > 0 && d.UserLevel == UnknownUserLevel {
+		return RejectUserLevel, fmt.Sprintf("这条消息看不出 UL 等级，要 %d 级", rules.MinUserLevel)
+	}
+	if rules.MinUserLevel > 0 && d.UserLevel < rules.MinUserLevel {
+		return RejectUserLevel, fmt.Sprintf("UL %d 级，要 %d 级", d.UserLevel, rules.MinUserLevel)
+	}
+
+	if rules.GuardLevel > 0 && (d.GuardLevel == GuardNone || d.GuardLevel > rules.GuardLevel) {
+		return RejectGuardLevel, fmt.Sprintf("要%s及以上才能参加", GuardName(rules.GuardLevel))
+	}
+
+	return "", ""
+}
+
+func GuardName(level int) string {
+	switch level {
+	case GuardGovernor:
+		return "总督"
+	case GuardAdmiral:
+		return "提督"
+	case GuardCaptain:
+		return "舰长"
+	default:
+		return "路人"
+	}
+}
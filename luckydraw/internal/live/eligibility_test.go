@@ -0,0 +1,75 @@
+package live_test
+
+import (
+	"testing"
+	"time"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/live"
+	"luckydraw/internal/live/livetest"
+)
+
+func TestEligibilityRules(t *testing.T) {
+	srv := startServer(t)
+
+	lottery := live.NewLiveLottery([]int{testRoom}, "")
+	lottery.SetRules(config.EligibilityRules{MedalOwnRoom: true, MinMedalLevel: 5, MinUserLevel: 10})
+	if err := lottery.Start("抽"); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	own := &live.FanMedal{Name: "测试", Level: 6, AnchorUID: 1, RoomID: testRoom}
+	srv.Send(
+		livetest.DanmakuFrom(livetest.Sender{UID: 1, Username: "ok", Medal: own, UserLevel: 20}, "抽"),
+		livetest.DanmakuFrom(livetest.Sender{UID: 2, Username: "nomedal", UserLevel: 20}, "抽"),
+		livetest.DanmakuFrom(livetest.Sender{UID: 3, Username: "other", Medal: &live.FanMedal{Name: "别家", Level: 20, AnchorUID: 99}, UserLevel: 20}, "抽"),
+		livetest.DanmakuFrom(livetest.Sender{UID: 4, Username: "low", Medal: &live.FanMedal{Name: "测试", Level: 2, AnchorUID: 1}, UserLevel: 20}, "抽"),
+		livetest.DanmakuFrom(livetest.Sender{UID: 5, Username: "newbie", Medal: own, UserLevel: 3}, "抽"),
+	)
+
+	waitFor(t, "rejections", func() bool { return len(lottery.Rejections()) == 4 })
+	if n := lottery.GetParticipantCount(); n != 1 {
+		t.Fatalf("participants = %d, want 1", n)
+	}
+
+	want := map[int64]string{
+		2: live.RejectNoMedal,
+		3: live.RejectMedalMismatch,
+		4: live.RejectMedalLevel,
+		5: live.RejectUserLevel,
+	}
+	for _, r := range lottery.Rejections() {
+		if r.Reason != want[r.UID] {
+			t.Errorf("uid %d rejected for %q, want %q", r.UID, r.Reason, want[r.UID])
+		}
+	}
+}
+
+func TestGuardOnlyRule(t *testing.T) {
+	srv := startServer(t)
+
+	lottery := live.NewLiveLottery([]int{testRoom}, "")
+	lottery.SetRules(config.EligibilityRules{GuardLevel: live.GuardCaptain})
+	if err := lottery.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Send(
+		livetest.DanmakuFrom(livetest.Sender{UID: 1, Username: "captain", GuardLevel: live.GuardCaptain}, "hi"),
+		livetest.DanmakuFrom(livetest.Sender{UID: 2, Username: "governor", GuardLevel: live.GuardGovernor}, "hi"),
+		livetest.DanmakuFrom(livetest.Sender{UID: 3, Username: "viewer"}, "hi"),
+	)
+
+	waitFor(t, "rejection", func() bool { return len(lottery.Rejections()) == 1 })
+	if n := lottery.GetParticipantCount(); n != 2 {
+		t.Fatalf("participants = %d, want 2", n)
+	}
+}
@@ -0,0 +1,104 @@
+package live_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"luckydraw/internal/event"
+	"luckydraw/internal/live"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []recorded
+}
+
+type recorded struct {
+	name    string
+	payload any
+}
+
+func (r *recorder) Emit(name string, data ...any) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, recorded{name: name, payload: data[0]})
+	return true
+}
+
+func (r *recorder) find(name string) []any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var payloads []any
+	for _, e := range r.events {
+		if e.name == name {
+			payloads = append(payloads, e.payload)
+		}
+	}
+	return payloads
+}
+
+func TestLiveLotteryEmitsConnectionEvents(t *testing.T) {
+	srv := startServer(t)
+	srv.Online = 1234
+
+	rec := &recorder{}
+	lottery := live.NewLiveLottery([]int{1}, "")
+	lottery.SetEmitter(rec)
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+
+	started := rec.find(event.LiveLotteryStarted)
+	if len(started) != 1 || started[0].(event.LotteryStarted).Commitment != lottery.Commitment() {
+		t.Fatalf("lottery_started = %+v", started)
+	}
+	connected := rec.find(event.RoomConnected)
+	if len(connected) != 1 || connected[0].(event.RoomConnection).RealRoomID != testRoom {
+		t.Fatalf("room:connected = %+v", connected)
+	}
+	waitFor(t, "online count", func() bool {
+		online := rec.find(event.RoomOnline)
+		return len(online) == 1 && online[0].(event.RoomOnlineCount).Online == 1234
+	})
+
+	srv.Disconnect()
+	waitFor(t, "reconnect", func() bool { return len(rec.find(event.RoomConnected)) == 2 })
+	if len(rec.find(event.RoomDisconnected)) != 1 || len(rec.find(event.RoomReconnecting)) == 0 {
+		t.Fatalf("events = %+v", rec.events)
+	}
+	if !rec.find(event.RoomConnected)[1].(event.RoomConnection).Reconnect {
+		t.Fatal("second connection not marked as reconnect")
+	}
+
+	lottery.Stop()
+	stopped := rec.find(event.LiveLotteryStopped)
+	if len(stopped) != 1 {
+		t.Fatalf("lottery_stopped = %+v", stopped)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(rec.find(event.RoomReconnecting)); n != 1 {
+		t.Fatalf("reconnecting after stop: %d events", n)
+	}
+}
+
+func TestDanmakuClientReportsAuthFailure(t *testing.T) {
+	srv := startServer(t)
+	srv.RejectAuth(-101)
+
+	rec := &recorder{}
+	client := live.NewDanmakuClient(1, "")
+	client.SetEmitter(rec)
+	defer client.Close()
+	if err := client.Connect(); err == nil {
+		t.Fatal("connect succeeded with rejected auth")
+	}
+
+	failures := rec.find(event.RoomAuthFailed)
+	if len(failures) == 0 || failures[0].(event.RoomAuthFailure).Code != -101 {
+		t.Fatalf("room:auth_failed = %+v", failures)
+	}
+	if len(rec.find(event.RoomConnected)) != 0 {
+		t.Fatal("rejected connection reported as connected")
+	}
+}
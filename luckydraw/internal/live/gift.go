@@ -0,0 +1,198 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"luckydraw/internal/config"
+)
+
+const (
+	ActionDanmaku   = "danmaku"
+	ActionGift      = "gift"
+	ActionGuard     = "guard"
+	ActionSuperChat = "super_chat"
+)
+
+// UnknownUserLevel 是消息里没带 UL 的用户，设了 MinUserLevel 的话会被拒；只在解析和查资格时用，不往外给
+const UnknownUserLevel = -1
+
+type GiftInfo struct {
+	DanmakuInfo
+	Action   string
+	GiftID   int
+	GiftName string
+	Num      int
+	Coin     int64
+}
+
+type giftMedal struct {
+	MedalName    string `json:"medal_name"`
+	MedalLevel   int    `json:"medal_level"`
+	TargetID     int64  `json:"target_id"`
+	AnchorUname  string `json:"anchor_uname"`
+	AnchorRoomID int    `json:"anchor_roomid"`
+}
+
+func (m *giftMedal) toFanMedal() *FanMedal {
+	if m == nil || m.MedalName == "" {
+		return nil
+	}
+	return &FanMedal{
+		Name:       m.MedalName,
+		Level:      m.MedalLevel,
+		AnchorUID:  m.TargetID,
+		AnchorName: m.AnchorUname,
+		RoomID:     m.AnchorRoomID,
+	}
+}
+
+func ParseGift(msg *DanmakuMessage) (*GiftInfo, bool) {
+	switch msg.CMD {
+	case "SEND_GIFT":
+		var data struct {
+			UID        int64      `json:"uid"`
+			Uname      string     `json:"uname"`
+			GiftID     int        `json:"giftId"`
+			GiftName   string     `json:"giftName"`
+			Num        int        `json:"num"`
+			Price      int64      `json:"price"`
+			TotalCoin  int64      `json:"total_coin"`
+			CoinType   string     `json:"coin_type"`
+			GuardLevel int        `json:"guard_level"`
+			MedalInfo  *giftMedal `json:"medal_info"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil || data.UID == 0 {
+			return nil, false
+		}
+		coin := data.TotalCoin
+		if coin == 0 {
+			coin = data.Price * int64(data.Num)
+		}
+		if data.CoinType != "gold" {
+			coin = 0
+		}
+		return &GiftInfo{
+			DanmakuInfo: DanmakuInfo{
+				UID:        data.UID,
+				Username:   data.Uname,
+				Medal:      data.MedalInfo.toFanMedal(),
+				UserLevel:  UnknownUserLevel,
+				GuardLevel: data.GuardLevel,
+			},
+			Action:   ActionGift,
+			GiftID:   data.GiftID,
+			GiftName: data.GiftName,
+			Num:      data.Num,
+			Coin:     coin,
+		}, true
+
+	case "GUARD_BUY":
+		var data struct {
+			UID        int64  `json:"uid"`
+			Username   string `json:"username"`
+			GuardLevel int    `json:"guard_level"`
+			Num        int    `json:"num"`
+			Price      int64  `json:"price"`
+			GiftID     int    `json:"gift_id"`
+			GiftName   string `json:"gift_name"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil || data.UID == 0 {
+			return nil, false
+		}
+		if data.Num == 0 {
+			data.Num = 1
+		}
+		return &GiftInfo{
+			DanmakuInfo: DanmakuInfo{
+				UID:        data.UID,
+				Username:   data.Username,
+				UserLevel:  UnknownUserLevel,
+				GuardLevel: data.GuardLevel,
+			},
+			Action:   ActionGuard,
+			GiftID:   data.GiftID,
+			GiftName: data.GiftName,
+			Num:      data.Num,
+			Coin:     data.Price * int64(data.Num),
+		}, true
+
+	case "SUPER_CHAT_MESSAGE":
+		var data struct {
+			UID      int64   `json:"uid"`
+			Price    float64 `json:"price"`
+			Message  string  `json:"message"`
+			UserInfo struct {
+				Uname      string `json:"uname"`
+				GuardLevel int    `json:"guard_level"`
+				UserLevel  int    `json:"user_level"`
+			} `json:"user_info"`
+			MedalInfo *giftMedal `json:"medal_info"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil || data.UID == 0 {
+			return nil, false
+		}
+		return &GiftInfo{
+			DanmakuInfo: DanmakuInfo{
+				UID:        data.UID,
+				Username:   data.UserInfo.Uname,
+				Message:    data.Message,
+				Medal:      data.MedalInfo.toFanMedal(),
+				UserLevel:  data.UserInfo.UserLevel,
+				GuardLevel: data.UserInfo.GuardLevel,
+			},
+			Action:   ActionSuperChat,
+			GiftName: "醒目留言",
+			Num:      1,
+			Coin:     int64(data.Price * 1000),
+		}, true
+	}
+	return nil, false
+}
+
+type giftProgress struct {
+	num  int
+	coin int64
+}
+
+func giftMatches(rules config.GiftEntryRules, g *GiftInfo) bool {
+	switch g.Action {
+	case ActionGuard:
+		return rules.AcceptGuard
+	case ActionSuperChat:
+		return rules.AcceptSuperChat && g.Coin >= rules.MinSuperChatPrice*1000
+	case ActionGift:
+		if len(rules.GiftIDs) == 0 && len(rules.GiftNames) == 0 {
+			return true
+		}
+		for _, id := range rules.GiftIDs {
+			if id == g.GiftID {
+				return true
+			}
+		}
+		for _, name := range rules.GiftNames {
+			if name == g.GiftName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func giftQualifies(rules config.GiftEntryRules, p *giftProgress) bool {
+	if rules.MinNum <= 0 && rules.MinCoin <= 0 {
+		return true
+	}
+	return (rules.MinNum > 0 && p.num >= rules.MinNum) || (rules.MinCoin > 0 && p.coin >= rules.MinCoin)
+}
+
+func giftDetail(g *GiftInfo) string {
+	switch g.Action {
+	case ActionGuard:
+		return fmt.Sprintf("%s x%d", GuardName(g.GuardLevel), g.Num)
+	case ActionSuperChat:
+		return fmt.Sprintf("醒目留言 ¥%d", g.Coin/1000)
+	default:
+		return fmt.Sprintf("%s x%d", g.GiftName, g.Num)
+	}
+}
@@ -0,0 +1,84 @@
+package live_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/live"
+	"luckydraw/internal/live/livetest"
+)
+
+func TestGiftEntryMode(t *testing.T) {
+	srv := startServer(t)
+
+	lottery := live.NewLiveLottery([]int{testRoom}, "")
+	lottery.SetEntryMode(config.EntryModeGift, config.GiftEntryRules{
+		GiftNames:       []string{"小花花"},
+		MinNum:          10,
+		AcceptGuard:     true,
+		AcceptSuperChat: true,
+	})
+	joined := make(chan *live.DanmakuUser, 8)
+	lottery.OnUserJoin = func(u *live.DanmakuUser) { joined <- u }
+	if err := lottery.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Send(
+		livetest.Danmaku(1, "talker", "抽我"),
+		livetest.Gift(2, "flower", 31036, "小花花", 6, 100),
+		livetest.Gift(3, "wrong", 1, "辣条", 99, 100),
+		livetest.Gift(2, "flower", 31036, "小花花", 4, 100),
+		livetest.GuardBuy(4, "captain", live.GuardCaptain, 1, 198000),
+		livetest.SuperChat(5, "sc", 30, "冲"),
+	)
+
+	want := map[int64]string{2: live.ActionGift, 4: live.ActionGuard, 5: live.ActionSuperChat}
+	for range want {
+		select {
+		case u := <-joined:
+			if want[u.UID] != u.Action {
+				t.Fatalf("uid %d joined via %q, want %q", u.UID, u.Action, want[u.UID])
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("missing join event")
+		}
+	}
+	if n := lottery.GetParticipantCount(); n != 3 {
+		t.Fatalf("participants = %d, want 3", n)
+	}
+	// 礼物和上舰看不出 UL，给前端的名单里不能冒出 -1 级
+	data, _ := json.Marshal(lottery.Participants())
+	if strings.Contains(string(data), `"user_level":-1`) {
+		t.Fatalf("participants = %s", data)
+	}
+}
+
+func TestGiftEntryRejectedByUserLevel(t *testing.T) {
+	srv := startServer(t)
+
+	lottery := live.NewLiveLottery([]int{testRoom}, "")
+	lottery.SetEntryMode(config.EntryModeGift, config.GiftEntryRules{GiftNames: []string{"小花花"}, MinNum: 1})
+	lottery.SetRules(config.EligibilityRules{MinUserLevel: 5})
+	if err := lottery.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 送礼的消息里没有 UL，看不出够不够就不放进来
+	srv.Send(livetest.Gift(2, "flower", 31036, "小花花", 1, 100))
+	waitFor(t, "rejection", func() bool { return len(lottery.Rejections()) == 1 })
+	if r := lottery.Rejections()[0]; r.Reason != live.RejectUserLevel || lottery.GetParticipantCount() != 0 {
+		t.Fatalf("rejection = %+v", r)
+	}
+}
@@ -0,0 +1,142 @@
+package livetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"luckydraw/internal/bili"
+)
+
+type SentDanmaku struct {
+	RoomID  int
+	Message string
+}
+
+type PrivateMessage struct {
+	Receiver int64
+	Content  string
+}
+
+type chat struct {
+	limit       int
+	tooFast     int
+	sent        []SentDanmaku
+	messages    []PrivateMessage
+	failMessage int
+	failCode    int
+}
+
+// SetDanmakuLimit 改 getInfoByUser 回的弹幕字数，超过的弹幕会发送失败
+func (s *Server) SetDanmakuLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chat.limit = n
+}
+
+// SendTooFast 让接下来 n 条弹幕回“发送频率过快”
+func (s *Server) SendTooFast(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chat.tooFast = n
+}
+
+// SentDanmaku 是发成功的弹幕
+func (s *Server) SentDanmaku() []SentDanmaku {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SentDanmaku(nil), s.chat.sent...)
+}
+
+func (s *Server) danmakuLimit() int {
+	if s.chat.limit > 0 {
+		return s.chat.limit
+	}
+	return bili.DefaultDanmakuLimit
+}
+
+func (s *Server) handleInfoByUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	limit := s.danmakuLimit()
+	s.mu.Unlock()
+	writeJSON(w, 0, map[string]any{
+		"property": map[string]any{"danmu": map[string]any{"length": limit}},
+	})
+}
+
+func (s *Server) handleMsgSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, -400, nil)
+		return
+	}
+	cookie, _ := r.Cookie("bili_jct")
+	if cookie == nil || cookie.Value == "" || r.PostForm.Get("csrf") != cookie.Value {
+		writeJSON(w, -111, nil)
+		return
+	}
+	roomID, _ := strconv.Atoi(r.PostForm.Get("roomid"))
+	msg := r.PostForm.Get("msg")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		writeJSON(w, -400, nil)
+		return
+	}
+	if s.chat.tooFast > 0 {
+		s.chat.tooFast--
+		writeJSON(w, bili.CodeSendTooFast, nil)
+		return
+	}
+	if msg == "" || utf8.RuneCountInString(msg) > s.danmakuLimit() {
+		writeJSON(w, 1003, nil)
+		return
+	}
+	s.chat.sent = append(s.chat.sent, SentDanmaku{RoomID: roomID, Message: msg})
+	writeJSON(w, 0, map[string]any{})
+}
+
+// FailMessages 让接下来 n 条私信回 code
+func (s *Server) FailMessages(n, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chat.failMessage, s.chat.failCode = n, code
+}
+
+// PrivateMessages 是发成功的私信
+func (s *Server) PrivateMessages() []PrivateMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PrivateMessage(nil), s.chat.messages...)
+}
+
+func (s *Server) handleSendMsg(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.URL.Query().Get("w_rid") == "" {
+		writeJSON(w, -400, nil)
+		return
+	}
+	cookie, _ := r.Cookie("bili_jct")
+	if cookie == nil || cookie.Value == "" || r.PostForm.Get("csrf") != cookie.Value {
+		writeJSON(w, -111, nil)
+		return
+	}
+	receiver, _ := strconv.ParseInt(r.PostForm.Get("msg[receiver_id]"), 10, 64)
+	var content struct {
+		Content string `json:"content"`
+	}
+	if receiver == 0 || json.Unmarshal([]byte(r.PostForm.Get("msg[content]")), &content) != nil {
+		writeJSON(w, -400, nil)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.chat.failMessage > 0 {
+		s.chat.failMessage--
+		writeJSON(w, s.chat.failCode, nil)
+		return
+	}
+	s.chat.messages = append(s.chat.messages, PrivateMessage{Receiver: receiver, Content: content.Content})
+	writeJSON(w, 0, map[string]any{"msg_key": len(s.chat.messages)})
+}
@@ -0,0 +1,188 @@
+package livetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"luckydraw/internal/bili"
+)
+
+type openPlatform struct {
+	code       string
+	secret     string
+	room       Room
+	games      int
+	active     string
+	heartbeats int
+	ends       []string
+}
+
+// EnableOpen 打开开放平台的假接口：只认这个身份码，签名用 secret 校验，开局后主播是 room
+func (s *Server) EnableOpen(code, secret string, room Room) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.open = openPlatform{code: code, secret: secret, room: room}
+}
+
+// OpenHeartbeats 是收到的游戏心跳次数
+func (s *Server) OpenHeartbeats() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.open.heartbeats
+}
+
+// OpenEnds 是被结束掉的 game_id
+func (s *Server) OpenEnds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.open.ends...)
+}
+
+// ExpireGame 让当前这局作废，下一次心跳会失败
+func (s *Server) ExpireGame() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.open.active = ""
+}
+
+func (s *Server) openRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, 4000, nil)
+		return false
+	}
+	headers := make(map[string]string)
+	for k := range r.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-bili-") {
+			headers[k] = r.Header.Get(k)
+		}
+	}
+
+	s.mu.Lock()
+	secret := s.open.secret
+	s.mu.Unlock()
+	if r.Header.Get("Authorization") != bili.OpenSignature(headers, secret) {
+		writeJSON(w, 4003, nil)
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		writeJSON(w, 4000, nil)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleAppStart(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code  string `json:"code"`
+		AppID int64  `json:"app_id"`
+	}
+	if !s.openRequest(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	if req.Code != s.open.code {
+		s.mu.Unlock()
+		writeJSON(w, 7007, nil)
+		return
+	}
+	s.open.games++
+	gameID := fmt.Sprintf("game-%d", s.open.games)
+	s.open.active = gameID
+	room := s.open.room
+	s.mu.Unlock()
+
+	wss := "wss" + strings.TrimPrefix(s.URL, "https") + "/sub"
+	writeJSON(w, 0, map[string]any{
+		"game_info": map[string]any{"game_id": gameID},
+		"websocket_info": map[string]any{
+			"auth_body": fmt.Sprintf(`{"roomid":%d,"protoover":2,"key":"open"}`, room.RoomID),
+			"wss_link":  []string{wss},
+		},
+		"anchor_info": map[string]any{
+			"room_id": room.RoomID,
+			"uname":   room.Title,
+			"uid":     room.UID,
+			"open_id": "anchor-open-id",
+		},
+	})
+}
+
+func (s *Server) handleAppHeartbeat(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GameID string `json:"game_id"`
+	}
+	if !s.openRequest(w, r, &req) {
+		return
+	}
+	s.mu.Lock()
+	s.open.heartbeats++
+	ok := req.GameID != "" && req.GameID == s.open.active
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, 7003, nil)
+		return
+	}
+	writeJSON(w, 0, map[string]any{})
+}
+
+func (s *Server) handleAppEnd(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GameID string `json:"game_id"`
+	}
+	if !s.openRequest(w, r, &req) {
+		return
+	}
+	s.mu.Lock()
+	s.open.ends = append(s.open.ends, req.GameID)
+	if s.open.active == req.GameID {
+		s.open.active = ""
+	}
+	s.mu.Unlock()
+	writeJSON(w, 0, map[string]any{})
+}
+
+type OpenSender struct {
+	UID        int64
+	OpenID     string
+	Username   string
+	MedalName  string
+	MedalLevel int
+	GuardLevel int
+}
+
+func openUser(sender OpenSender) map[string]any {
+	return map[string]any{
+		"uid":                       sender.UID,
+		"open_id":                   sender.OpenID,
+		"uname":                     sender.Username,
+		"uface":                     "",
+		"guard_level":               sender.GuardLevel,
+		"fans_medal_level":          sender.MedalLevel,
+		"fans_medal_name":           sender.MedalName,
+		"fans_medal_wearing_status": sender.MedalName != "",
+		"timestamp":                 time.Now().Unix(),
+	}
+}
+
+func OpenDanmaku(sender OpenSender, message string) map[string]any {
+	data := openUser(sender)
+	data["msg"] = message
+	data["msg_id"] = fmt.Sprintf("dm-%d", time.Now().UnixNano())
+	return map[string]any{"cmd": "LIVE_OPEN_PLATFORM_DM", "data": data}
+}
+
+func OpenGift(sender OpenSender, giftID int, giftName string, num int, price int64) map[string]any {
+	data := openUser(sender)
+	data["gift_id"] = giftID
+	data["gift_name"] = giftName
+	data["gift_num"] = num
+	data["price"] = price
+	data["paid"] = price > 0
+	return map[string]any{"cmd": "LIVE_OPEN_PLATFORM_SEND_GIFT", "data": data}
+}
@@ -0,0 +1,496 @@
+package livetest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/live"
+)
+
+type Room struct {
+	RoomID     int
+	ShortID    int
+	UID        int64
+	Title      string
+	LiveStatus int
+}
+
+type Server struct {
+	*httptest.Server
+
+	Token    string
+	Online   uint32
+	Protover int
+
+	mu         sync.Mutex
+	rooms      map[int]Room
+	conns      map[*conn]struct{}
+	auths      []json.RawMessage
+	accepted   int
+	failDials  int
+	silentAuth bool
+	authCode   int
+	upgrader   websocket.Upgrader
+	open       openPlatform
+	web        webDevice
+	chat       chat
+}
+
+type conn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *conn) write(packet []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ws.WriteMessage(websocket.BinaryMessage, packet)
+}
+
+func NewServer(rooms ...Room) *Server {
+	s := &Server{
+		Token:    "fake-token",
+		Online:   1,
+		Protover: live.ProtoverZlib,
+		rooms:    make(map[int]Room),
+		conns:    make(map[*conn]struct{}),
+		web:      webDevice{imgKey: "7cd084941338484aae1ad9425b84077c", subKey: "4932caff0ff746eab6f01bf08b70ac45"},
+	}
+	for _, r := range rooms {
+		s.AddRoom(r)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/room/v1/Room/get_info", s.handleRoomInfo)
+	mux.HandleFunc("/room/v1/Room/mobileRoomInit", s.handleMobileRoomInit)
+	mux.HandleFunc("/xlive/web-room/v1/index/getDanmuInfo", s.handleDanmuInfo)
+	mux.HandleFunc("/sub", s.handleSub)
+	mux.HandleFunc("/x/web-interface/nav", s.handleNav)
+	mux.HandleFunc("/x/frontend/finger/spi", s.handleSpi)
+	mux.HandleFunc("/bapis/bilibili.api.ticket.v1.Ticket/GenWebTicket", s.handleTicket)
+	mux.HandleFunc("/xlive/web-room/v1/index/getInfoByUser", s.handleInfoByUser)
+	mux.HandleFunc("/msg/send", s.handleMsgSend)
+	mux.HandleFunc("/web_im/v1/web_im/send_msg", s.handleSendMsg)
+	mux.HandleFunc("/v2/app/start", s.handleAppStart)
+	mux.HandleFunc("/v2/app/heartbeat", s.handleAppHeartbeat)
+	mux.HandleFunc("/v2/app/end", s.handleAppEnd)
+	s.Server = httptest.NewTLSServer(mux)
+	return s
+}
+
+func (s *Server) AddRoom(r Room) {
+	if r.LiveStatus == 0 {
+		r.LiveStatus = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rooms[r.RoomID] = r
+	if r.ShortID != 0 {
+		s.rooms[r.ShortID] = r
+	}
+}
+
+// Install 把 bili / live 的地址和拨号器指向本服务，返回的函数用来还原
+func (s *Server) Install() func() {
+	oldAPI, oldLive, oldOpen, oldVC := bili.APIBaseURL, bili.LiveAPIBaseURL, bili.OpenAPIBaseURL, bili.VCBaseURL
+	oldBiliHTTP, oldDialer := bili.DefaultHTTPClient, live.Dialer
+
+	client := s.Client()
+	tlsConfig := client.Transport.(*http.Transport).TLSClientConfig
+	bili.APIBaseURL = s.URL
+	bili.LiveAPIBaseURL = s.URL
+	bili.OpenAPIBaseURL = s.URL
+	bili.VCBaseURL = s.URL
+	bili.DefaultHTTPClient = client
+	live.Dialer = &websocket.Dialer{
+		TLSClientConfig:  tlsConfig.Clone(),
+		HandshakeTimeout: 5 * time.Second,
+	}
+
+	return func() {
+		bili.APIBaseURL, bili.LiveAPIBaseURL, bili.OpenAPIBaseURL, bili.VCBaseURL = oldAPI, oldLive, oldOpen, oldVC
+		bili.DefaultHTTPClient, live.Dialer = oldBiliHTTP, oldDialer
+	}
+}
+
+func (s *Server) lookup(r *http.Request, key string) (Room, bool) {
+	id, _ := strconv.Atoi(r.URL.Query().Get(key))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room, ok := s.rooms[id]
+	return room, ok
+}
+
+func writeJSON(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"code": code, "message": "0", "data": data})
+}
+
+func (s *Server) handleRoomInfo(w http.ResponseWriter, r *http.Request) {
+	room, ok := s.lookup(r, "room_id")
+	if !ok {
+		writeJSON(w, 1, nil)
+		return
+	}
+	writeJSON(w, 0, map[string]any{
+		"room_id":     room.RoomID,
+		"uid":         room.UID,
+		"short_id":    room.ShortID,
+		"title":       room.Title,
+		"live_status": room.LiveStatus,
+	})
+}
+
+func (s *Server) handleMobileRoomInit(w http.ResponseWriter, r *http.Request) {
+	room, ok := s.lookup(r, "id")
+	if !ok {
+		writeJSON(w, 1, nil)
+		return
+	}
+	writeJSON(w, 0, map[string]any{"room_id": room.RoomID})
+}
+
+func (s *Server) handleDanmuInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.web.danmuCookie = r.Header.Get("Cookie")
+	s.mu.Unlock()
+	if !s.checkWbi(r) {
+		writeJSON(w, -352, nil)
+		return
+	}
+	if _, ok := s.lookup(r, "id"); !ok {
+		writeJSON(w, 1, nil)
+		return
+	}
+	u, _ := url.Parse(s.URL)
+	port, _ := strconv.Atoi(u.Port())
+	writeJSON(w, 0, map[string]any{
+		"token":     s.Token,
+		"host_list": []live.DanmakuHost{{Host: u.Hostname(), Port: port}},
+	})
+}
+
+func (s *Server) handleSub(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.failDials > 0 {
+		s.failDials--
+		s.mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	s.mu.Unlock()
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{ws: ws}
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		for len(data) >= live.PacketHeaderLength {
+			packetLen := int(binary.BigEndian.Uint32(data[0:4]))
+			headerLen := int(binary.BigEndian.Uint16(data[4:6]))
+			op := binary.BigEndian.Uint32(data[8:12])
+			if packetLen < headerLen || packetLen > len(data) {
+				break
+			}
+			body := data[headerLen:packetLen]
+			data = data[packetLen:]
+
+			switch op {
+			case live.OperationJoin:
+				s.mu.Lock()
+				s.auths = append(s.auths, append(json.RawMessage(nil), body...))
+				silent := s.silentAuth
+				if !silent {
+					s.conns[c] = struct{}{}
+					s.accepted++
+				}
+				s.mu.Unlock()
+				if silent {
+					continue
+				}
+				s.mu.Lock()
+				code := s.authCode
+				s.mu.Unlock()
+				c.write(Packet(live.OperationWelcome, live.ProtoverPopularity, []byte(fmt.Sprintf(`{"code":%d}`, code))))
+			case live.OperationHeartbeat:
+				s.mu.Lock()
+				online := s.Online
+				s.mu.Unlock()
+				body := make([]byte, 4)
+				binary.BigEndian.PutUint32(body, online)
+				c.write(Packet(live.OperationHeartbeatAck, live.ProtoverPopularity, body))
+			}
+		}
+	}
+}
+
+// FailDials 让接下来 n 次 WebSocket 握手直接失败，用来测重连退避
+func (s *Server) FailDials(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failDials = n
+}
+
+// SilentAuth 开启后收到认证包不回 Welcome，客户端会在超时后放弃
+func (s *Server) SilentAuth(silent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silentAuth = silent
+}
+
+// RejectAuth 让认证回包带上非 0 的 code，模拟 token 失效
+func (s *Server) RejectAuth(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authCode = code
+}
+
+// Disconnect 掐断当前所有已认证的连接
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.conns = make(map[*conn]struct{})
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.ws.Close()
+	}
+}
+
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+func (s *Server) ActiveConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+func (s *Server) Auths() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]json.RawMessage(nil), s.auths...)
+}
+
+func (s *Server) WaitAccepted(n int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if s.Accepted() >= n {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("livetest: waited %s for %d connections, got %d", timeout, n, s.Accepted())
+}
+
+// Send 把若干条命令按 s.Protover 打成一个压缩批次广播给所有连接
+func (s *Server) Send(msgs ...any) error {
+	var inner bytes.Buffer
+	for _, m := range msgs {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		inner.Write(Packet(live.OperationMessage, live.ProtoverJSON, data))
+	}
+
+	s.mu.Lock()
+	protover := s.Protover
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	var packet []byte
+	switch protover {
+	case live.ProtoverJSON:
+		packet = inner.Bytes()
+	default:
+		body, err := Compress(protover, inner.Bytes())
+		if err != nil {
+			return err
+		}
+		packet = Packet(live.OperationMessage, int16(protover), body)
+	}
+
+	for _, c := range conns {
+		if err := c.write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) SendDanmaku(uid int64, username, message string) error {
+	return s.Send(Danmaku(uid, username, message))
+}
+
+// SendRaw 原样广播一个包，用来塞坏包
+func (s *Server) SendRaw(packet []byte) error {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		if err := c.write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Sender struct {
+	UID        int64
+	Username   string
+	Medal      *live.FanMedal
+	UserLevel  int
+	GuardLevel int
+}
+
+func Danmaku(uid int64, username, message string) map[string]any {
+	return DanmakuFrom(Sender{UID: uid, Username: username}, message)
+}
+
+func DanmakuFrom(sender Sender, message string) map[string]any {
+	medal := []any{}
+	if m := sender.Medal; m != nil {
+		medal = []any{m.Level, m.Name, m.AnchorName, m.RoomID, 6067854, "", 0, 6067854, 6067854, 6067854, sender.GuardLevel, 1, m.AnchorUID}
+	}
+	return map[string]any{
+		"cmd": "DANMU_MSG",
+		"info": []any{
+			[]any{0, 1, 25, 16777215, time.Now().UnixMilli(), 0, 0, "", 0, 0, 0, "", 0, "{}", "{}"},
+			message,
+			[]any{sender.UID, sender.Username, 0, 0, 0, 10000, 1, ""},
+			medal,
+			[]any{sender.UserLevel, 0, 9868950, ">50000", 0},
+			[]any{"", ""},
+			0,
+			sender.GuardLevel,
+			nil,
+			map[string]any{"ts": time.Now().Unix(), "ct": ""},
+			0,
+			0,
+		},
+	}
+}
+
+func Gift(uid int64, username string, giftID int, giftName string, num int, price int64) map[string]any {
+	return map[string]any{
+		"cmd": "SEND_GIFT",
+		"data": map[string]any{
+			"uid":        uid,
+			"uname":      username,
+			"giftId":     giftID,
+			"giftName":   giftName,
+			"num":        num,
+			"price":      price,
+			"total_coin": price * int64(num),
+			"coin_type":  "gold",
+			"action":     "投喂",
+			"timestamp":  time.Now().Unix(),
+		},
+	}
+}
+
+func GuardBuy(uid int64, username string, guardLevel, num int, price int64) map[string]any {
+	return map[string]any{
+		"cmd": "GUARD_BUY",
+		"data": map[string]any{
+			"uid":         uid,
+			"username":    username,
+			"guard_level": guardLevel,
+			"num":         num,
+			"price":       price,
+			"gift_id":     10003,
+			"gift_name":   "舰长",
+		},
+	}
+}
+
+func SuperChat(uid int64, username string, price int, message string) map[string]any {
+	return map[string]any{
+		"cmd": "SUPER_CHAT_MESSAGE",
+		"data": map[string]any{
+			"uid":     uid,
+			"price":   price,
+			"message": message,
+			"user_info": map[string]any{
+				"uname":       username,
+				"guard_level": 0,
+				"user_level":  10,
+			},
+		},
+	}
+}
+
+func Packet(op int32, protover int16, body []byte) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, int32(len(body)+live.PacketHeaderLength))
+	binary.Write(buf, binary.BigEndian, int16(live.PacketHeaderLength))
+	binary.Write(buf, binary.BigEndian, protover)
+	binary.Write(buf, binary.BigEndian, op)
+	binary.Write(buf, binary.BigEndian, int32(1))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func Compress(protover int, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch protover {
+	case live.ProtoverZlib:
+		w := zlib.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case live.ProtoverBrotli:
+		w := brotli.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("livetest: unsupported protover %d", protover)
+	}
+	return buf.Bytes(), nil
+}
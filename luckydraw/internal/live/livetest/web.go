@@ -0,0 +1,107 @@
+package livetest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"luckydraw/internal/bili"
+)
+
+const (
+	FakeBuvid3 = "fake-buvid3"
+	FakeBuvid4 = "fake-buvid4"
+	FakeTicket = "fake-ticket"
+)
+
+type webDevice struct {
+	imgKey      string
+	subKey      string
+	navCalls    int
+	spiCalls    int
+	danmuCookie string
+}
+
+func (s *Server) handleNav(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.web.navCalls++
+	img, sub := s.web.imgKey, s.web.subKey
+	s.mu.Unlock()
+	// 没登录也照样给 wbi_img
+	writeJSON(w, -101, map[string]any{
+		"isLogin": false,
+		"wbi_img": map[string]any{
+			"img_url": "https://i0.hdslb.com/bfs/wbi/" + img + ".png",
+			"sub_url": "https://i0.hdslb.com/bfs/wbi/" + sub + ".png",
+		},
+	})
+}
+
+func (s *Server) handleSpi(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.web.spiCalls++
+	s.mu.Unlock()
+	writeJSON(w, 0, map[string]any{"b_3": FakeBuvid3, "b_4": FakeBuvid4})
+}
+
+func (s *Server) handleTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Query().Get("key_id") != "ec02" {
+		writeJSON(w, 400, nil)
+		return
+	}
+	writeJSON(w, 0, map[string]any{
+		"ticket":     FakeTicket,
+		"created_at": time.Now().Unix(),
+		"ttl":        259200,
+	})
+}
+
+// checkWbi 按现在的 key 重新算一遍 w_rid
+func (s *Server) checkWbi(r *http.Request) bool {
+	q := r.URL.Query()
+	wts, err := strconv.ParseInt(q.Get("wts"), 10, 64)
+	if err != nil || q.Get("w_rid") == "" {
+		return false
+	}
+	params := make(map[string]string)
+	for k := range q {
+		if k != "wts" && k != "w_rid" {
+			params[k] = q.Get(k)
+		}
+	}
+
+	s.mu.Lock()
+	key := bili.MixinKey(s.web.imgKey, s.web.subKey)
+	s.mu.Unlock()
+	want := bili.SignWbi(params, key, wts)
+	return want[len(want)-32:] == q.Get("w_rid")
+}
+
+// RotateWbi 换一对 WBI key，客户端缓存的就作废了
+func (s *Server) RotateWbi() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.web.imgKey, s.web.subKey = s.web.subKey, fmt.Sprintf("%032x", time.Now().UnixNano())
+}
+
+// NavCalls 是 nav 被请求的次数，用来看 key 有没有缓存
+func (s *Server) NavCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.web.navCalls
+}
+
+// SpiCalls 是要 buvid 的次数
+func (s *Server) SpiCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.web.spiCalls
+}
+
+// DanmuInfoCookie 是最近一次 getDanmuInfo 带的 Cookie
+func (s *Server) DanmuInfoCookie() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.web.danmuCookie
+}
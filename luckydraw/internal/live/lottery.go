@@ -1,141 +1,528 @@
 package live
 
 import (
-	"encoding/json"
 	"fmt"
-	"math/rand"
-	"strings"
+	"sort"
 	"sync"
 	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
+	"luckydraw/internal/event"
 )
 
 type LiveLottery struct {
-	clients    []*DanmakuClient
-	keyword    string
-	mu         sync.Mutex
-	users      map[int64]*DanmakuUser
-	isRunning  bool
-	OnUserJoin func(*DanmakuUser)
+	sources           []MessageSource
+	configuredMatcher *Matcher
+	activeMatcher     *Matcher
+	rules             config.EligibilityRules
+	entryMode         string
+	giftRules         config.GiftEntryRules
+	gifts             map[int64]*giftProgress
+	spent             map[int64]int64
+	weighting         WeightStrategy
+	excluded          map[int64]string
+	seed              string
+	commitment        string
+	round             int
+	mu                sync.Mutex
+	users             map[int64]*DanmakuUser
+	rejected          map[int64]*Rejection
+	isRunning         bool
+	emitter           event.Emitter
+	stop              chan struct{}
+	OnUserJoin        func(*DanmakuUser)
+	OnUserReject      func(*Rejection)
 }
 
 func NewLiveLottery(roomIDs []int, cookie string) *LiveLottery {
-	clients := make([]*DanmakuClient, 0, len(roomIDs))
+	return NewClientLottery(roomIDs, bili.NewClient(cookie))
+}
+
+// NewClientLottery 让所有房间的 HTTP 都走同一个 bili.Client
+func NewClientLottery(roomIDs []int, client *bili.Client) *LiveLottery {
+	sources := make([]MessageSource, 0, len(roomIDs))
 	for _, roomID := range roomIDs {
-		clients = append(clients, NewDanmakuClient(roomID, cookie))
+		sources = append(sources, newDanmakuClient(roomID, client))
 	}
+	return NewSourceLottery(sources...)
+}
+
+// 用录像代替直播间，房间号、主播 UID 都从录像里来
+func NewReplayLottery(replay *Replay) *LiveLottery {
+	return NewSourceLottery(replay.Sources()...)
+}
+
+func NewSourceLottery(sources ...MessageSource) *LiveLottery {
 	return &LiveLottery{
-		clients: clients,
-		users:   make(map[int64]*DanmakuUser),
+		sources:  sources,
+		users:    make(map[int64]*DanmakuUser),
+		rejected: make(map[int64]*Rejection),
+		gifts:    make(map[int64]*giftProgress),
+		spent:    make(map[int64]int64),
 	}
 }
 
+// Start 开始收人；没 SetMatcher 过的话就按 keyword 包含匹配
 func (l *LiveLottery) Start(keyword string) error {
 	l.mu.Lock()
 	if l.isRunning {
 		l.mu.Unlock()
 		return fmt.Errorf("在抽了，我有自己的节奏……")
 	}
-	l.keyword = keyword
+	seed, commitment, err := NewSeed()
+	if err != nil {
+		l.mu.Unlock()
+		return fmt.Errorf("骰子丢了: %v", err)
+	}
+	l.seed, l.commitment, l.round = seed, commitment, 0
+	l.activeMatcher = l.configuredMatcher
+	if l.activeMatcher == nil {
+		l.activeMatcher = KeywordMatcher(keyword)
+	}
+	label := l.activeMatcher.String()
 	l.isRunning = true
 	l.users = make(map[int64]*DanmakuUser)
+	l.rejected = make(map[int64]*Rejection)
+	l.gifts = make(map[int64]*giftProgress)
+	l.spent = make(map[int64]int64)
+	stop := make(chan struct{})
+	l.stop = stop
 	l.mu.Unlock()
 
-	for _, client := range l.clients {
-		client.SetOnMessage(func(msg *DanmakuMessage) {
-			l.handleDanmaku(msg)
-		})
+	rooms := make([]int, 0, len(l.sources))
+	for _, src := range l.sources {
+		go l.consume(src, stop)
+		// 连不上的源会自己报错、重连，这里不拦着其他房间
+		src.Connect()
+		rooms = append(rooms, src.Status().RoomID)
+	}
 
-		if err := client.Connect(); err != nil {
-			fmt.Printf("想看 %d 直播，驳回: %v\n", client.roomID, err)
-			continue
+	l.emit(event.LiveLotteryStarted, event.LotteryStarted{
+		Keyword:    label,
+		Rooms:      rooms,
+		Commitment: commitment,
+		Algorithm:  DrawAlgorithm,
+	})
+	return nil
+}
+
+func (l *LiveLottery) consume(src MessageSource, stop <-chan struct{}) {
+	messages := src.Messages()
+	for {
+		select {
+		case <-stop:
+			return
+		case msg := <-messages:
+			l.handleDanmaku(src, msg)
 		}
 	}
+}
 
-	return nil
+func (l *LiveLottery) SetRecorder(recorder *Recorder) {
+	for _, src := range l.sources {
+		if r, ok := src.(recorderSetter); ok {
+			r.SetRecorder(recorder)
+		}
+	}
 }
 
-func (l *LiveLottery) handleDanmaku(msg *DanmakuMessage) {
-	if msg.CMD != "DANMU_MSG" {
-		return
+func (l *LiveLottery) RoomStatuses() []RoomStatus {
+	statuses := make([]RoomStatus, 0, len(l.sources))
+	for _, src := range l.sources {
+		statuses = append(statuses, src.Status())
 	}
+	return statuses
+}
 
-	var info []interface{}
-	if err := json.Unmarshal(msg.Info, &info); err != nil {
-		return
+func (l *LiveLottery) SetEmitter(emitter event.Emitter) {
+	l.mu.Lock()
+	l.emitter = emitter
+	l.mu.Unlock()
+
+	for _, src := range l.sources {
+		if e, ok := src.(emitterSetter); ok {
+			e.SetEmitter(emitter)
+		}
 	}
+}
 
-	if len(info) < 3 {
-		return
+func (l *LiveLottery) emit(name string, payload any) {
+	l.mu.Lock()
+	emitter := l.emitter
+	l.mu.Unlock()
+	if emitter != nil {
+		emitter.Emit(name, payload)
 	}
+}
 
-	userInfo, ok := info[2].([]interface{})
-	if !ok || len(userInfo) < 2 {
-		return
+func (l *LiveLottery) SetRules(rules config.EligibilityRules) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = rules
+}
+
+func (l *LiveLottery) SetEntryMode(mode string, gift config.GiftEntryRules) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entryMode = mode
+	l.giftRules = gift
+}
+
+func (l *LiveLottery) SetWeightStrategy(strategy WeightStrategy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.weighting = strategy
+}
+
+// SetMatcher 存成 configuredMatcher，下一次 Start 才定成这一轮用的 activeMatcher
+func (l *LiveLottery) SetMatcher(matcher *Matcher) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.configuredMatcher = matcher
+}
+
+func (l *LiveLottery) SetExclusions(excluded map[int64]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.excluded = excluded
+}
+
+func (l *LiveLottery) accepts(action string) bool {
+	switch l.entryMode {
+	case config.EntryModeAny:
+		return true
+	case config.EntryModeGift:
+		return action != ActionDanmaku
+	default:
+		return action == ActionDanmaku
 	}
+}
 
-	uidFloat, ok := userInfo[0].(float64)
-	if !ok {
+func (l *LiveLottery) handleDanmaku(src MessageSource, msg *DanmakuMessage) {
+	if info, ok := ParseDanmaku(msg); ok {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if !l.accepts(ActionDanmaku) {
+			return
+		}
+		if !l.activeMatcher.Match(info.Message) {
+			return
+		}
+		if user, exists := l.users[info.UID]; exists {
+			user.Count++
+			user.GuardLevel = higherGuard(user.GuardLevel, info.GuardLevel)
+			return
+		}
+		l.admit(src, info, ActionDanmaku, "")
 		return
 	}
-	uid := int64(uidFloat)
 
-	username, ok := userInfo[1].(string)
-	if !ok {
+	if gift, ok := ParseGift(msg); ok {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.spent[gift.UID] += gift.Coin
+		if user, exists := l.users[gift.UID]; exists {
+			user.Coin = l.spent[gift.UID]
+			user.GuardLevel = higherGuard(user.GuardLevel, gift.GuardLevel)
+			return
+		}
+		if !l.accepts(gift.Action) || !giftMatches(l.giftRules, gift) {
+			return
+		}
+		progress, ok := l.gifts[gift.UID]
+		if !ok {
+			progress = &giftProgress{}
+			l.gifts[gift.UID] = progress
+		}
+		progress.num += gift.Num
+		progress.coin += gift.Coin
+		if gift.Action == ActionGift && !giftQualifies(l.giftRules, progress) {
+			return
+		}
+		l.admit(src, &gift.DanmakuInfo, gift.Action, giftDetail(gift))
+	}
+}
+
+func (l *LiveLottery) admit(src MessageSource, info *DanmakuInfo, action, detail string) {
+	if _, exists := l.users[info.UID]; exists {
 		return
 	}
 
-	message, ok := info[1].(string)
-	if !ok {
+	room := src.Status()
+	reason, message := checkEligibility(l.rules, info, room.AnchorUID, room.RealRoomID)
+	if why, ok := l.excluded[info.UID]; ok {
+		reason, message = RejectExcluded, why
+	}
+	if reason != "" {
+		rejection := &Rejection{
+			UID:      info.UID,
+			Username: info.Username,
+			RoomID:   room.RoomID,
+			Reason:   reason,
+			Message:  message,
+		}
+		l.rejected[info.UID] = rejection
+		if l.OnUserReject != nil {
+			l.OnUserReject(rejection)
+		}
 		return
 	}
 
+	delete(l.rejected, info.UID)
+	user := &DanmakuUser{
+		UID:        info.UID,
+		Username:   info.Username,
+		Count:      1,
+		Action:     action,
+		Detail:     detail,
+		Coin:       l.spent[info.UID],
+		GuardLevel: info.GuardLevel,
+		RoomID:     room.RoomID,
+		Message:    info.Message,
+		FirstSeen:  time.Now(),
+		Medal:      info.Medal,
+		UserLevel:  max(info.UserLevel, 0),
+		anchorUID:  room.AnchorUID,
+		realRoomID: room.RealRoomID,
+		levelKnown: info.UserLevel != UnknownUserLevel,
+	}
+	l.users[info.UID] = user
+	if l.OnUserJoin != nil {
+		joined := *user
+		l.OnUserJoin(&joined)
+	}
+}
+
+func higherGuard(current, next int) int {
+	if next == GuardNone {
+		return current
+	}
+	if current == GuardNone || next < current {
+		return next
+	}
+	return current
+}
+
+func (l *LiveLottery) Stop() {
+	l.mu.Lock()
+	wasRunning := l.isRunning
+	l.isRunning = false
+	participants := len(l.users)
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	l.mu.Unlock()
+
+	for _, src := range l.sources {
+		src.Close()
+	}
+	if wasRunning {
+		l.emit(event.LiveLotteryStopped, event.LotteryStopped{Participants: participants})
+	}
+}
+
+func (l *LiveLottery) Commitment() string {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.commitment
+}
 
-	if l.keyword == "" || strings.Contains(message, l.keyword) {
-		if _, exists := l.users[uid]; !exists {
-			user := &DanmakuUser{
-				UID:      uid,
-				Username: username,
-				Count:    1,
-			}
-			l.users[uid] = user
-			if l.OnUserJoin != nil {
-				l.OnUserJoin(user)
+// DrawResult 分奖项开的时候 Proof 是整份名单的，每个奖项自己那一轮在 Tiers 里
+type DrawResult struct {
+	Winners      []*DanmakuUser
+	Participants []*DanmakuUser
+	Proof        config.DrawProof
+	Tiers        []TierResult
+}
+
+type TierResult struct {
+	Name       string
+	Quantity   int
+	Winners    []*DanmakuUser
+	Proof      config.DrawProof
+	ineligible map[int64]bool
+}
+
+func (r *DrawResult) HistoryWinners() []config.HistoryWinner {
+	winners := make([]config.HistoryWinner, 0, len(r.Winners))
+	for _, w := range r.Winners {
+		winners = append(winners, config.HistoryWinner{
+			UID:      w.UID,
+			Username: w.Username,
+			Count:    w.Count,
+			Weight:   w.Weight,
+			Prize:    w.Prize,
+		})
+	}
+	return winners
+}
+
+func (r *DrawResult) TierRecords() []config.TierRecord {
+	if len(r.Tiers) == 0 {
+		return nil
+	}
+	tiers := make([]config.TierRecord, 0, len(r.Tiers))
+	for _, t := range r.Tiers {
+		proof := t.Proof
+		tiers = append(tiers, config.TierRecord{Name: t.Name, Quantity: t.Quantity, Proof: &proof})
+	}
+	return tiers
+}
+
+func (r *DrawResult) Snapshot() []config.Participant {
+	participants := make([]config.Participant, 0, len(r.Participants))
+	for _, p := range r.Participants {
+		var ineligible []int
+		for i, t := range r.Tiers {
+			if t.ineligible[p.UID] {
+				ineligible = append(ineligible, i)
 			}
 		}
+		participants = append(participants, config.Participant{
+			UID:        p.UID,
+			Username:   p.Username,
+			RoomID:     p.RoomID,
+			FirstSeen:  p.FirstSeen,
+			Message:    p.Message,
+			Action:     p.Action,
+			Detail:     p.Detail,
+			Count:      p.Count,
+			Weight:     p.Weight,
+			Excluded:   p.Excluded,
+			Ineligible: ineligible,
+		})
 	}
+	return participants
 }
 
-func (l *LiveLottery) Stop() {
+func (l *LiveLottery) Draw(count int) (*DrawResult, error) {
 	l.mu.Lock()
-	l.isRunning = false
-	l.mu.Unlock()
+	defer l.mu.Unlock()
 
-	for _, client := range l.clients {
-		client.Close()
+	if err := l.committed(); err != nil {
+		return nil, err
+	}
+	allUsers, participants := l.candidates()
+	if count <= 0 || count > len(allUsers) {
+		count = len(allUsers)
 	}
+	strategy := l.strategy()
+	l.round++
+	proof := l.proof(l.entries(allUsers, strategy), l.round)
+
+	stream := newHashStream(proof.Seed, proof.SnapshotHash, proof.Round)
+	return &DrawResult{
+		Winners:      pickWeighted(stream, allUsers, strategy, count),
+		Participants: participants,
+		Proof:        proof,
+	}, nil
 }
 
-func (l *LiveLottery) Draw(count int) []*DanmakuUser {
+// DrawTiers 按顺序一个奖项开一轮：名单去掉前面奖项中过的和这个奖项不够格的，
+// 每轮都是普通的一次开奖，单拿出来也能用 VerifyDraw 复验
+func (l *LiveLottery) DrawTiers(tiers []config.PrizeTier) (*DrawResult, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if err := l.committed(); err != nil {
+		return nil, err
+	}
+	allUsers, participants := l.candidates()
+	strategy := l.strategy()
+	result := &DrawResult{Participants: participants}
+	taken := make(map[int64]bool)
+	for _, tier := range tiers {
+		t := TierResult{Name: tier.Name, Quantity: tier.Quantity, ineligible: make(map[int64]bool)}
+		pool := make([]*DanmakuUser, 0, len(allUsers))
+		for _, u := range allUsers {
+			if tier.Rules != nil {
+				if reason, _ := checkEligibility(*tier.Rules, u.info(), u.anchorUID, u.realRoomID); reason != "" {
+					t.ineligible[u.UID] = true
+					continue
+				}
+			}
+			if !taken[u.UID] {
+				pool = append(pool, u)
+			}
+		}
+
+		l.round++
+		t.Proof = l.proof(l.entries(pool, strategy), l.round)
+		count := min(max(tier.Quantity, 0), len(pool))
+		stream := newHashStream(t.Proof.Seed, t.Proof.SnapshotHash, t.Proof.Round)
+		t.Winners = pickWeighted(stream, pool, strategy, count)
+		for _, w := range t.Winners {
+			w.Prize = tier.Name
+			taken[w.UID] = true
+		}
+		result.Winners = append(result.Winners, t.Winners...)
+		result.Tiers = append(result.Tiers, t)
+	}
+	result.Proof = l.proof(l.entries(allUsers, strategy), l.round)
+	return result, nil
+}
+
+// candidates 返回按 UID 排好的能抽的人，和带上被排除的人的完整名单。调用方持锁
+func (l *LiveLottery) candidates() ([]*DanmakuUser, []*DanmakuUser) {
 	allUsers := make([]*DanmakuUser, 0, len(l.users))
+	excluded := make([]*DanmakuUser, 0)
 	for _, user := range l.users {
+		if why, ok := l.excluded[user.UID]; ok {
+			u := *user
+			u.Excluded = why
+			excluded = append(excluded, &u)
+			continue
+		}
 		allUsers = append(allUsers, user)
 	}
+	sort.Slice(allUsers, func(i, j int) bool { return allUsers[i].UID < allUsers[j].UID })
 
-	if count <= 0 || count > len(allUsers) {
-		count = len(allUsers)
+	strategy := l.strategy()
+	participants := make([]*DanmakuUser, 0, len(allUsers)+len(excluded))
+	for _, u := range allUsers {
+		p := *u
+		p.Weight = strategy.Weight(u)
+		participants = append(participants, &p)
 	}
+	return allUsers, append(participants, excluded...)
+}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	r.Shuffle(len(allUsers), func(i, j int) {
-		allUsers[i], allUsers[j] = allUsers[j], allUsers[i]
-	})
+func (l *LiveLottery) strategy() WeightStrategy {
+	if l.weighting == nil {
+		return uniformWeight{}
+	}
+	return l.weighting
+}
+
+func (l *LiveLottery) entries(users []*DanmakuUser, strategy WeightStrategy) []SnapshotEntry {
+	entries := make([]SnapshotEntry, len(users))
+	for i, u := range users {
+		entries[i] = SnapshotEntry{UID: u.UID, Weight: strategy.Weight(u)}
+	}
+	return entries
+}
+
+// committed 承诺是 Start 时公布的，没 Start 过就临时生成等于没承诺，不给抽。调用方持锁
+func (l *LiveLottery) committed() error {
+	if l.commitment == "" {
+		return fmt.Errorf("还没公布种子承诺，不能开奖喵")
+	}
+	return nil
+}
 
-	return allUsers[:count]
+func (l *LiveLottery) proof(entries []SnapshotEntry, round int) config.DrawProof {
+	return config.DrawProof{
+		Algorithm:    DrawAlgorithm,
+		Commitment:   l.commitment,
+		Seed:         l.seed,
+		SnapshotHash: SnapshotHash(entries),
+		Round:        round,
+		Participants: len(entries),
+	}
 }
 
 func (l *LiveLottery) GetParticipantCount() int {
@@ -144,6 +531,38 @@ func (l *LiveLottery) GetParticipantCount() int {
 	return len(l.users)
 }
 
+func (l *LiveLottery) Participants() []*DanmakuUser {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	users := make([]*DanmakuUser, 0, len(l.users))
+	for _, user := range l.users {
+		u := *user
+		users = append(users, &u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].FirstSeen.Before(users[j].FirstSeen) })
+	return users
+}
+
+func (l *LiveLottery) Rejections() []*Rejection {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rejections := make([]*Rejection, 0, len(l.rejected))
+	for _, r := range l.rejected {
+		rejections = append(rejections, r)
+	}
+	return rejections
+}
+
+func (l *LiveLottery) UndecodedPackets() int64 {
+	var total int64
+	for _, src := range l.sources {
+		total += src.Status().Undecoded
+	}
+	return total
+}
+
 func (l *LiveLottery) IsRunning() bool {
 	l.mu.Lock()
 	defer l.mu.Unlock()
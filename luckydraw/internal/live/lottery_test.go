@@ -0,0 +1,205 @@
+package live_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/live"
+	"luckydraw/internal/live/livetest"
+)
+
+const testRoom = 21452505
+
+func startServer(t *testing.T) *livetest.Server {
+	t.Helper()
+	srv := livetest.NewServer(livetest.Room{RoomID: testRoom, ShortID: 1, UID: 1, Title: "test"})
+	restore := srv.Install()
+
+	oldBackoff, oldMax := live.ReconnectBackoff, live.MaxReconnectBackoff
+	live.ReconnectBackoff = 20 * time.Millisecond
+	live.MaxReconnectBackoff = 100 * time.Millisecond
+
+	t.Cleanup(func() {
+		live.ReconnectBackoff, live.MaxReconnectBackoff = oldBackoff, oldMax
+		restore()
+		srv.Close()
+	})
+	return srv
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestLiveLotteryKeywordMatching(t *testing.T) {
+	srv := startServer(t)
+
+	lottery := live.NewLiveLottery([]int{1}, "DedeUserID=42; buvid3=abc")
+	joined := make(chan *live.DanmakuUser, 8)
+	lottery.OnUserJoin = func(u *live.DanmakuUser) { joined <- u }
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Send(
+		livetest.Danmaku(100, "alice", "抽我抽我"),
+		livetest.Danmaku(200, "bob", "路过"),
+		livetest.Danmaku(100, "alice", "再来一次抽我"),
+		livetest.Danmaku(300, "carol", "抽我"),
+	)
+
+	waitFor(t, "participants", func() bool { return lottery.GetParticipantCount() == 2 })
+	for _, want := range []int64{100, 300} {
+		select {
+		case u := <-joined:
+			if u.UID != want {
+				t.Fatalf("joined uid = %d, want %d", u.UID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no join event")
+		}
+	}
+
+	auths := srv.Auths()
+	if len(auths) == 0 {
+		t.Fatal("no auth packet")
+	}
+	if got := string(auths[0]); !strings.Contains(got, `"roomid":21452505`) || !strings.Contains(got, `"key":"fake-token"`) {
+		t.Fatalf("auth body = %s", got)
+	}
+}
+
+func TestDanmakuClientDecodesBrotli(t *testing.T) {
+	srv := startServer(t)
+	srv.Protover = live.ProtoverBrotli
+
+	lottery := live.NewLiveLottery([]int{testRoom}, "")
+	if err := lottery.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SendDanmaku(1, "a", "hi")
+	srv.SendRaw(livetest.Packet(live.OperationMessage, live.ProtoverBrotli, []byte("not brotli")))
+	srv.SendDanmaku(2, "b", "hi")
+
+	waitFor(t, "participants", func() bool { return lottery.GetParticipantCount() == 2 })
+	waitFor(t, "undecoded counter", func() bool { return lottery.UndecodedPackets() == 1 })
+}
+
+func TestDanmakuClientReconnects(t *testing.T) {
+	srv := startServer(t)
+
+	lottery := live.NewLiveLottery([]int{testRoom}, "")
+	if err := lottery.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.FailDials(2)
+	srv.Disconnect()
+	if err := srv.WaitAccepted(2, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SendDanmaku(7, "after", "reconnected")
+	waitFor(t, "participant after reconnect", func() bool { return lottery.GetParticipantCount() == 1 })
+}
+
+func TestLiveLotteryRoomStatuses(t *testing.T) {
+	srv := startServer(t)
+	srv.Online = 88
+
+	lottery := live.NewLiveLottery([]int{1, 404}, "")
+	if err := lottery.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+
+	srv.SendDanmaku(5, "viewer", "hi")
+	waitFor(t, "room status", func() bool {
+		statuses := lottery.RoomStatuses()
+		return statuses[0].Online == 88 && !statuses[0].LastMessage.IsZero() && statuses[1].ReconnectAttempts > 0
+	})
+
+	statuses := lottery.RoomStatuses()
+	ok := statuses[0]
+	if !ok.Connected || ok.RealRoomID != testRoom || ok.Title != "test" || ok.LiveStatus != 1 || ok.Host == "" {
+		t.Fatalf("connected room status = %+v", ok)
+	}
+	missing := statuses[1]
+	if missing.Connected || missing.LastError == "" {
+		t.Fatalf("missing room status = %+v", missing)
+	}
+}
+
+func TestDanmakuClientFetchesBuvidAndSignsWbi(t *testing.T) {
+	srv := startServer(t)
+
+	// Cookie 里没有 buvid3，要从 spi 拿；几个房间共用一次 nav
+	lottery := live.NewClientLottery([]int{1, testRoom}, bili.NewClient("DedeUserID=42"))
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+	if err := srv.WaitAccepted(2, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := srv.DanmuInfoCookie(); !strings.Contains(got, "buvid3="+livetest.FakeBuvid3) ||
+		!strings.Contains(got, "buvid4="+livetest.FakeBuvid4) || !strings.Contains(got, "bili_ticket="+livetest.FakeTicket) {
+		t.Fatalf("getDanmuInfo cookie = %q", got)
+	}
+	if got := string(srv.Auths()[0]); !strings.Contains(got, `"buvid":"`+livetest.FakeBuvid3+`"`) || !strings.Contains(got, `"uid":42`) {
+		t.Fatalf("auth body = %s", got)
+	}
+	if n := srv.NavCalls(); n != 1 {
+		t.Fatalf("nav fetched %d times, want 1", n)
+	}
+}
+
+func TestDanmakuClientRefreshesRotatedWbiKey(t *testing.T) {
+	srv := startServer(t)
+	client := bili.NewClient("")
+	if _, err := client.WbiKey(); err != nil {
+		t.Fatal(err)
+	}
+	srv.RotateWbi()
+
+	lottery := live.NewClientLottery([]int{testRoom}, client)
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// 旧 key 签的被 -352 打回来，换新 key 以后拿到了真 token
+	if got := string(srv.Auths()[0]); !strings.Contains(got, `"key":"fake-token"`) {
+		t.Fatalf("auth body = %s", got)
+	}
+	if n := srv.NavCalls(); n != 2 {
+		t.Fatalf("nav fetched %d times, want 2", n)
+	}
+}
@@ -0,0 +1,175 @@
+package live
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+
+	"luckydraw/internal/config"
+)
+
+const (
+	MatchAny   = "any"
+	MatchAll   = "all"
+	MatchExact = "exact"
+	MatchRegex = "regex"
+)
+
+// Matcher 判断一条弹幕算不算参与。关键词、排除词和弹幕都先按同样的规则归一化再比
+type Matcher struct {
+	cfg      config.KeywordMatch
+	keywords []string
+	exclude  []string
+	pattern  *regexp.Regexp
+}
+
+func NewMatcher(cfg config.KeywordMatch) (*Matcher, error) {
+	m := &Matcher{cfg: cfg}
+	switch cfg.Mode {
+	case "", MatchAny, MatchAll, MatchExact:
+		if cfg.Pattern != "" {
+			return nil, fmt.Errorf("正则要把匹配方式选成 regex")
+		}
+	case MatchRegex:
+		if cfg.Pattern == "" {
+			return nil, fmt.Errorf("正则是空的")
+		}
+		pattern := cfg.Pattern
+		if cfg.IgnoreScript {
+			pattern = toSimplified(pattern)
+		}
+		if cfg.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("正则写错了: %v", err)
+		}
+		m.pattern = re
+	default:
+		return nil, fmt.Errorf("不认识的匹配方式: %s", cfg.Mode)
+	}
+
+	for _, kw := range cfg.Keywords {
+		if kw = m.normalize(kw); kw != "" {
+			m.keywords = append(m.keywords, kw)
+		}
+	}
+	for _, kw := range cfg.Exclude {
+		if kw = m.normalize(kw); kw != "" {
+			m.exclude = append(m.exclude, kw)
+		}
+	}
+	return m, nil
+}
+
+// KeywordMatcher 是老的单个关键词：原样包含就算
+func KeywordMatcher(keyword string) *Matcher {
+	m, _ := NewMatcher(config.KeywordMatch{Keywords: []string{keyword}})
+	return m
+}
+
+// Match 没配关键词也没配正则的话谁都算，排除词照样生效
+func (m *Matcher) Match(message string) bool {
+	if m == nil {
+		return true
+	}
+	msg := m.normalize(message)
+	for _, kw := range m.exclude {
+		if strings.Contains(msg, kw) {
+			return false
+		}
+	}
+
+	if m.pattern != nil {
+		// 大小写交给 (?i)，正则里写的大写字母才不会白写
+		return m.pattern.MatchString(m.fold(message, false))
+	}
+	if len(m.keywords) == 0 {
+		return true
+	}
+	switch m.cfg.Mode {
+	case MatchAll:
+		for _, kw := range m.keywords {
+			if !strings.Contains(msg, kw) {
+				return false
+			}
+		}
+		return true
+	case MatchExact:
+		for _, kw := range m.keywords {
+			if msg == kw {
+				return true
+			}
+		}
+		return false
+	default:
+		for _, kw := range m.keywords {
+			if strings.Contains(msg, kw) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// String 给历史记录和事件看的，说清楚按什么抽的
+func (m *Matcher) String() string {
+	if m == nil {
+		return ""
+	}
+	switch {
+	case m.pattern != nil:
+		return "/" + m.cfg.Pattern + "/"
+	case m.cfg.Mode == MatchAll:
+		return strings.Join(m.cfg.Keywords, " + ")
+	case m.cfg.Mode == MatchExact:
+		return "=" + strings.Join(m.cfg.Keywords, " / =")
+	default:
+		return strings.Join(m.cfg.Keywords, " / ")
+	}
+}
+
+func (m *Matcher) normalize(s string) string {
+	return m.fold(s, m.cfg.IgnoreCase)
+}
+
+func (m *Matcher) fold(s string, lower bool) string {
+	if m.cfg.IgnoreWidth {
+		s = width.Fold.String(s)
+	}
+	if m.cfg.IgnoreScript {
+		s = toSimplified(s)
+	}
+	if m.cfg.IgnoreEmoji {
+		s = strings.Map(func(r rune) rune {
+			if isEmoji(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if lower {
+		s = strings.ToLower(s)
+	}
+	// 多打的空格不算数
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// isEmoji 连带肤色、变体选择符和零宽连接符一起算，拼出来的 emoji 才能去干净
+func isEmoji(r rune) bool {
+	switch {
+	case r == 0x200D, r == 0x20E3:
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F:
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF:
+		return true
+	case r >= 0xE0020 && r <= 0xE007F:
+		return true
+	}
+	return unicode.Is(unicode.So, r)
+}
@@ -0,0 +1,71 @@
+package live
+
+import (
+	"testing"
+
+	"luckydraw/internal/config"
+)
+
+func TestMatcher(t *testing.T) {
+	normalized := config.KeywordMatch{IgnoreCase: true, IgnoreWidth: true, IgnoreEmoji: true, IgnoreScript: true}
+	with := func(cfg config.KeywordMatch) config.KeywordMatch {
+		cfg.IgnoreCase, cfg.IgnoreWidth, cfg.IgnoreEmoji, cfg.IgnoreScript = true, true, true, true
+		return cfg
+	}
+
+	cases := []struct {
+		name    string
+		cfg     config.KeywordMatch
+		message string
+		want    bool
+	}{
+		{"空的谁都算", config.KeywordMatch{}, "随便说点", true},
+		{"老的包含", config.KeywordMatch{Keywords: []string{"抽我"}}, "别抽我", true},
+		{"排除词", config.KeywordMatch{Keywords: []string{"抽我"}, Exclude: []string{"别抽"}}, "别抽我", false},
+		{"只有排除词", config.KeywordMatch{Exclude: []string{"广告"}}, "看广告", false},
+		{"任一", config.KeywordMatch{Mode: MatchAny, Keywords: []string{"抽我", "冲"}}, "冲冲冲", true},
+		{"全部缺一个", config.KeywordMatch{Mode: MatchAll, Keywords: []string{"抽我", "冲"}}, "抽我", false},
+		{"全部", config.KeywordMatch{Mode: MatchAll, Keywords: []string{"抽我", "冲"}}, "冲！抽我", true},
+		{"整句", config.KeywordMatch{Mode: MatchExact, Keywords: []string{"抽我"}}, "别抽我", false},
+		{"整句去掉空格", config.KeywordMatch{Mode: MatchExact, Keywords: []string{"抽我"}}, "  抽我 ", true},
+		{"不忽略大小写", config.KeywordMatch{Keywords: []string{"GO"}}, "go", false},
+		{"忽略大小写", with(config.KeywordMatch{Keywords: []string{"GO"}}), "go", true},
+		{"全角半角", with(config.KeywordMatch{Keywords: []string{"abc1"}}), "ＡＢＣ１", true},
+		{"emoji", with(config.KeywordMatch{Mode: MatchExact, Keywords: []string{"抽我"}}), "抽🎉我👍🏻", true},
+		{"拼起来的 emoji", with(config.KeywordMatch{Mode: MatchExact, Keywords: []string{"抽我"}}), "抽我👨‍👩‍👧", true},
+		{"繁体", with(config.KeywordMatch{Mode: MatchExact, Keywords: []string{"抽奖"}}), "抽獎", true},
+		{"繁体关键词", with(config.KeywordMatch{Keywords: []string{"參與抽獎"}}), "我要参与抽奖", true},
+		{"不折繁简", config.KeywordMatch{Keywords: []string{"抽奖"}}, "抽獎", false},
+		{"正则繁体", config.KeywordMatch{Mode: MatchRegex, Pattern: `^抽獎\d*$`, IgnoreScript: true}, "抽奖1", true},
+		{"繁体排除词", with(config.KeywordMatch{Keywords: []string{"抽奖"}, Exclude: []string{"廣告"}}), "广告 抽奖", false},
+		{"不去 emoji", config.KeywordMatch{Mode: MatchExact, Keywords: []string{"抽我"}}, "抽我🎉", false},
+		{"正则", config.KeywordMatch{Mode: MatchRegex, Pattern: `^抽我\d+$`}, "抽我123", true},
+		{"正则不中", config.KeywordMatch{Mode: MatchRegex, Pattern: `^抽我\d+$`}, "别抽我123", false},
+		{"正则忽略大小写", config.KeywordMatch{Mode: MatchRegex, Pattern: `^GO$`, IgnoreCase: true}, "Go", true},
+		{"正则全角", config.KeywordMatch{Mode: MatchRegex, Pattern: `^\d+$`, IgnoreWidth: true}, "１２３", true},
+		{"归一化后的排除词", with(config.KeywordMatch{Keywords: []string{"抽我"}, Exclude: []string{"ＮＯ"}}), "no 抽我", false},
+		{"默认归一化", normalized, "什么都行", true},
+	}
+	for _, c := range cases {
+		m, err := NewMatcher(c.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := m.Match(c.message); got != c.want {
+			t.Errorf("%s: Match(%q) = %v, want %v", c.name, c.message, got, c.want)
+		}
+	}
+}
+
+func TestNewMatcherRejectsBadConfig(t *testing.T) {
+	for _, cfg := range []config.KeywordMatch{
+		{Mode: "fuzzy"},
+		{Mode: MatchRegex},
+		{Mode: MatchRegex, Pattern: "("},
+		{Mode: MatchAny, Pattern: "抽我"},
+	} {
+		if _, err := NewMatcher(cfg); err == nil {
+			t.Errorf("NewMatcher(%+v) 应该报错", cfg)
+		}
+	}
+}
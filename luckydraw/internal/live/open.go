@@ -0,0 +1,332 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/event"
+)
+
+var OpenHeartbeatInterval = 20 * time.Second
+
+// OpenPlatformSource 走开放平台的互动玩法：主播身份码开局、定时续命，
+// 长连收到的 LIVE_OPEN_PLATFORM_* 消息转成网页端的格式，抽奖那边不用管是哪来的
+type OpenPlatformSource struct {
+	client   *DanmakuClient
+	api      *bili.OpenClient
+	appID    int64
+	code     string
+	interval time.Duration
+	once     sync.Once
+
+	mu   sync.Mutex
+	game *bili.OpenGame
+}
+
+var _ MessageSource = (*OpenPlatformSource)(nil)
+
+func NewOpenPlatformSource(api *bili.OpenClient, appID int64, code string) *OpenPlatformSource {
+	s := &OpenPlatformSource{
+		api:      api,
+		appID:    appID,
+		code:     code,
+		interval: OpenHeartbeatInterval,
+	}
+	// 房间号要等开局以后才知道
+	s.client = NewDanmakuClient(0, "")
+	s.client.resolve = s.resolve
+	s.client.convert = s.convert
+	return s
+}
+
+func (s *OpenPlatformSource) Connect() error {
+	s.once.Do(func() { go s.heartbeat() })
+	return s.client.Connect()
+}
+
+func (s *OpenPlatformSource) Close() {
+	s.client.Close()
+
+	s.mu.Lock()
+	game := s.game
+	s.game = nil
+	s.mu.Unlock()
+	if game != nil {
+		s.api.AppEnd(s.appID, game.GameInfo.GameID)
+	}
+}
+
+func (s *OpenPlatformSource) Messages() <-chan *DanmakuMessage {
+	return s.client.Messages()
+}
+
+func (s *OpenPlatformSource) Status() RoomStatus {
+	status := s.client.Status()
+	if status.RoomID == 0 {
+		status.RoomID = status.RealRoomID
+	}
+	return status
+}
+
+func (s *OpenPlatformSource) SetEmitter(emitter event.Emitter) {
+	s.client.SetEmitter(emitter)
+}
+
+func (s *OpenPlatformSource) SetRecorder(recorder *Recorder) {
+	s.client.SetRecorder(recorder)
+}
+
+// GameID 是当前这一局的 ID，还没开局就是空的
+func (s *OpenPlatformSource) GameID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.game == nil {
+		return ""
+	}
+	return s.game.GameInfo.GameID
+}
+
+// resolve 在每次（重）连之前调用，这局没了就重新开一局
+func (s *OpenPlatformSource) resolve() (*RoomInfo, error) {
+	s.mu.Lock()
+	game := s.game
+	s.mu.Unlock()
+
+	if game == nil {
+		started, err := s.api.AppStart(s.code, s.appID)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.game = started
+		s.mu.Unlock()
+		game = started
+	}
+
+	hosts := make([]DanmakuHost, 0, len(game.WebsocketInfo.WssLink))
+	for _, link := range game.WebsocketInfo.WssLink {
+		u, err := url.Parse(link)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		port, _ := strconv.Atoi(u.Port())
+		hosts = append(hosts, DanmakuHost{Host: u.Hostname(), Port: port})
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("开放平台给的长连地址都不对")
+	}
+
+	anchor := game.AnchorInfo
+	return &RoomInfo{
+		RoomID:     anchor.RoomID,
+		UID:        anchor.UID,
+		Title:      "互动玩法 · " + anchor.Uname,
+		LiveStatus: 1,
+		HostList:   hosts,
+		AuthBody:   game.WebsocketInfo.AuthBody,
+	}, nil
+}
+
+func (s *OpenPlatformSource) heartbeat() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.client.stop:
+			return
+		case <-ticker.C:
+		}
+		gameID := s.GameID()
+		if gameID == "" {
+			continue
+		}
+		if err := s.api.AppHeartbeat(gameID); err != nil {
+			// 心跳断了这局就作废，下次重连时重新开局
+			s.client.setError(err)
+			s.mu.Lock()
+			if s.game != nil && s.game.GameInfo.GameID == gameID {
+				s.game = nil
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// OpenUID 把开放平台的用户换成抽奖用的 UID。新版接口 uid 给 0，只给 open_id，
+// 这时用 open_id 的哈希落在 [2^52, 2^53)：比现在的 UID 都大，又不会在 float64 里丢精度
+func OpenUID(uid int64, openID string) int64 {
+	if uid != 0 || openID == "" {
+		return uid
+	}
+	h := fnv.New64a()
+	h.Write([]byte(openID))
+	return int64(h.Sum64()&(1<<52-1)) | 1<<52
+}
+
+// IsOpenUID 是不是 OpenUID 编出来的 UID，这种不是真的 B 站账号
+func IsOpenUID(uid int64) bool {
+	return uid&(1<<52) != 0
+}
+
+type openUser struct {
+	UID    int64  `json:"uid"`
+	OpenID string `json:"open_id"`
+	Uname  string `json:"uname"`
+}
+
+type openMedal struct {
+	GuardLevel    int    `json:"guard_level"`
+	MedalLevel    int    `json:"fans_medal_level"`
+	MedalName     string `json:"fans_medal_name"`
+	WearingStatus bool   `json:"fans_medal_wearing_status"`
+}
+
+func (s *OpenPlatformSource) convert(msg *DanmakuMessage) (*DanmakuMessage, bool) {
+	switch msg.CMD {
+	case "LIVE_OPEN_PLATFORM_DM":
+		var data struct {
+			openUser
+			openMedal
+			Msg string `json:"msg"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			return nil, false
+		}
+		medal := []any{}
+		if m := s.medal(data.openMedal); m != nil {
+			medal = []any{m.Level, m.Name, m.AnchorName, m.RoomID, 0, "", 0, 0, 0, 0, data.GuardLevel, 1, m.AnchorUID}
+		}
+		info, err := json.Marshal([]any{
+			[]any{},
+			data.Msg,
+			[]any{OpenUID(data.UID, data.OpenID), data.Uname},
+			medal,
+			[]any{UnknownUserLevel},
+			[]any{},
+			0,
+			data.GuardLevel,
+		})
+		if err != nil {
+			return nil, false
+		}
+		return &DanmakuMessage{CMD: "DANMU_MSG", Info: info}, true
+
+	case "LIVE_OPEN_PLATFORM_SEND_GIFT":
+		var data struct {
+			openUser
+			openMedal
+			GiftID   int    `json:"gift_id"`
+			GiftName string `json:"gift_name"`
+			GiftNum  int    `json:"gift_num"`
+			Price    int64  `json:"price"`
+			Paid     bool   `json:"paid"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			return nil, false
+		}
+		coinType := "silver"
+		if data.Paid {
+			coinType = "gold"
+		}
+		return s.web("SEND_GIFT", map[string]any{
+			"uid":         OpenUID(data.UID, data.OpenID),
+			"uname":       data.Uname,
+			"giftId":      data.GiftID,
+			"giftName":    data.GiftName,
+			"num":         data.GiftNum,
+			"price":       data.Price,
+			"total_coin":  data.Price * int64(data.GiftNum),
+			"coin_type":   coinType,
+			"guard_level": data.GuardLevel,
+			"medal_info":  s.giftMedal(data.openMedal),
+		})
+
+	case "LIVE_OPEN_PLATFORM_GUARD":
+		var data struct {
+			openMedal
+			UserInfo openUser `json:"user_info"`
+			GuardNum int      `json:"guard_num"`
+			Price    int64    `json:"price"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			return nil, false
+		}
+		return s.web("GUARD_BUY", map[string]any{
+			"uid":         OpenUID(data.UserInfo.UID, data.UserInfo.OpenID),
+			"username":    data.UserInfo.Uname,
+			"guard_level": data.GuardLevel,
+			"num":         data.GuardNum,
+			"price":       data.Price,
+			"gift_name":   GuardName(data.GuardLevel),
+		})
+
+	case "LIVE_OPEN_PLATFORM_SUPER_CHAT":
+		var data struct {
+			openUser
+			openMedal
+			RMB     float64 `json:"rmb"`
+			Message string  `json:"message"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			return nil, false
+		}
+		return s.web("SUPER_CHAT_MESSAGE", map[string]any{
+			"uid":     OpenUID(data.UID, data.OpenID),
+			"price":   data.RMB,
+			"message": data.Message,
+			"user_info": map[string]any{
+				"uname":       data.Uname,
+				"guard_level": data.GuardLevel,
+				"user_level":  UnknownUserLevel,
+			},
+			"medal_info": s.giftMedal(data.openMedal),
+		})
+	}
+	// 点赞、下播之类的原样放过去，抽奖那边不认识就不管
+	return msg, true
+}
+
+func (s *OpenPlatformSource) web(cmd string, data map[string]any) (*DanmakuMessage, bool) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, false
+	}
+	return &DanmakuMessage{CMD: cmd, Data: raw}, true
+}
+
+// 开放平台只给本直播间的粉丝牌，主播信息从开局结果里补
+func (s *OpenPlatformSource) medal(m openMedal) *FanMedal {
+	if !m.WearingStatus || m.MedalName == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	medal := &FanMedal{Name: m.MedalName, Level: m.MedalLevel}
+	if s.game != nil {
+		medal.AnchorUID = s.game.AnchorInfo.UID
+		medal.AnchorName = s.game.AnchorInfo.Uname
+		medal.RoomID = s.game.AnchorInfo.RoomID
+	}
+	return medal
+}
+
+func (s *OpenPlatformSource) giftMedal(m openMedal) *giftMedal {
+	medal := s.medal(m)
+	if medal == nil {
+		return nil
+	}
+	return &giftMedal{
+		MedalName:    medal.Name,
+		MedalLevel:   medal.Level,
+		TargetID:     medal.AnchorUID,
+		AnchorUname:  medal.AnchorName,
+		AnchorRoomID: medal.RoomID,
+	}
+}
@@ -0,0 +1,100 @@
+package live_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
+	"luckydraw/internal/live"
+	"luckydraw/internal/live/livetest"
+)
+
+func startOpenServer(t *testing.T) *livetest.Server {
+	t.Helper()
+	srv := startServer(t)
+	srv.EnableOpen("CODE", "secret", livetest.Room{RoomID: testRoom, Title: "主播"})
+
+	old := live.OpenHeartbeatInterval
+	live.OpenHeartbeatInterval = 20 * time.Millisecond
+	t.Cleanup(func() { live.OpenHeartbeatInterval = old })
+	return srv
+}
+
+func TestOpenPlatformSource(t *testing.T) {
+	srv := startOpenServer(t)
+
+	src := live.NewOpenPlatformSource(bili.NewOpenClient("key", "secret"), 1, "CODE")
+	lottery := live.NewSourceLottery(src)
+	lottery.SetRules(config.EligibilityRules{MedalOwnRoom: true})
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if auth := string(srv.Auths()[0]); !strings.Contains(auth, `"key":"open"`) {
+		t.Fatalf("auth body = %s, want the one from app/start", auth)
+	}
+	if n := srv.SpiCalls(); n != 0 {
+		t.Fatalf("asked spi for a buvid %d times, the auth body already has everything", n)
+	}
+
+	srv.Send(
+		livetest.OpenDanmaku(livetest.OpenSender{OpenID: "o1", Username: "a", MedalName: "牌子", MedalLevel: 3}, "抽我"),
+		livetest.OpenDanmaku(livetest.OpenSender{OpenID: "o2", Username: "b"}, "抽我"),
+		livetest.OpenGift(livetest.OpenSender{OpenID: "o3", Username: "c"}, 1, "辣条", 1, 0),
+	)
+	waitFor(t, "open participants", func() bool {
+		return lottery.GetParticipantCount() == 1 && len(lottery.Rejections()) == 1
+	})
+	users := lottery.Participants()
+	if uid := users[0].UID; uid != live.OpenUID(0, "o1") || uid < 1<<52 {
+		t.Fatalf("participant uid = %d", uid)
+	}
+	if status := src.Status(); status.RoomID != testRoom || !status.Connected {
+		t.Fatalf("open source status = %+v", status)
+	}
+	waitFor(t, "game heartbeats", func() bool { return srv.OpenHeartbeats() >= 2 })
+
+	lottery.Stop()
+	if ends := srv.OpenEnds(); len(ends) != 1 || ends[0] != "game-1" {
+		t.Fatalf("ended games = %v", ends)
+	}
+}
+
+func TestOpenPlatformRestartsExpiredGame(t *testing.T) {
+	srv := startOpenServer(t)
+
+	src := live.NewOpenPlatformSource(bili.NewOpenClient("key", "secret"), 1, "CODE")
+	if err := src.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if src.GameID() != "game-1" {
+		t.Fatalf("game id = %q", src.GameID())
+	}
+
+	srv.ExpireGame()
+	waitFor(t, "expired heartbeat", func() bool { return src.GameID() == "" })
+	srv.Disconnect()
+	waitFor(t, "new game", func() bool { return src.GameID() == "game-2" && src.Status().Connected })
+}
+
+func TestOpenPlatformRejectsBadCode(t *testing.T) {
+	startOpenServer(t)
+
+	src := live.NewOpenPlatformSource(bili.NewOpenClient("key", "secret"), 1, "WRONG")
+	defer src.Close()
+	err := src.Connect()
+	if err == nil || !strings.Contains(err.Error(), "7007") {
+		t.Fatalf("Connect() error = %v, want 7007", err)
+	}
+
+	wrongKey := live.NewOpenPlatformSource(bili.NewOpenClient("key", "nope"), 1, "CODE")
+	defer wrongKey.Close()
+	if err := wrongKey.Connect(); err == nil || !strings.Contains(err.Error(), "4003") {
+		t.Fatalf("Connect() with bad signature error = %v", err)
+	}
+}
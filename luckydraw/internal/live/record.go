@@ -0,0 +1,227 @@
+package live
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 录制文件是 gzip 压缩的 JSONL，一行一条房间里收到的原始消息
+type RecordedMessage struct {
+	Time       time.Time       `json:"time"`
+	RoomID     int             `json:"room_id"`
+	RealRoomID int             `json:"real_room_id,omitempty"`
+	AnchorUID  int64           `json:"anchor_uid,omitempty"`
+	Message    json.RawMessage `json:"message"`
+}
+
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+	path string
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &Recorder{file: file, gz: gz, enc: json.NewEncoder(gz), path: path}, nil
+}
+
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+func (r *Recorder) Record(msg RecordedMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.enc == nil {
+		return fmt.Errorf("录像已经停了")
+	}
+	if err := r.enc.Encode(msg); err != nil {
+		return err
+	}
+	// 每条都刷到文件里，程序崩了录像也只丢最后一点
+	return r.gz.Flush()
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.enc == nil {
+		return nil
+	}
+	r.enc = nil
+	if err := r.gz.Close(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+type Replay struct {
+	Messages []RecordedMessage
+	// Speed 是回放倍速，1 是原速，0 表示不等待一口气放完
+	Speed float64
+}
+
+func LoadReplay(path string, speed float64) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("这不是录像文件吧: %v", err)
+	}
+	defer gz.Close()
+
+	replay := &Replay{Speed: speed}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var msg RecordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			// 录的时候崩了，文件停在半行上：前面的照样能用
+			if !scanner.Scan() && errors.Is(scanner.Err(), io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, fmt.Errorf("录像第 %d 行坏了: %v", len(replay.Messages)+1, err)
+		}
+		replay.Messages = append(replay.Messages, msg)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	sort.SliceStable(replay.Messages, func(i, j int) bool {
+		return replay.Messages[i].Time.Before(replay.Messages[j].Time)
+	})
+	return replay, nil
+}
+
+func (r *Replay) Rooms() []int {
+	seen := make(map[int]bool)
+	var rooms []int
+	for _, msg := range r.Messages {
+		if !seen[msg.RoomID] {
+			seen[msg.RoomID] = true
+			rooms = append(rooms, msg.RoomID)
+		}
+	}
+	return rooms
+}
+
+// 每个房间一个源，共用录像开头作为时间零点，多房间回放时先后顺序不乱
+func (r *Replay) Sources() []MessageSource {
+	var base time.Time
+	if len(r.Messages) > 0 {
+		base = r.Messages[0].Time
+	}
+	var sources []MessageSource
+	for _, roomID := range r.Rooms() {
+		src := &ReplaySource{
+			speed:    r.Speed,
+			base:     base,
+			messages: make(chan *DanmakuMessage, messageBuffer),
+			stop:     make(chan struct{}),
+			status:   RoomStatus{RoomID: roomID, Title: "录像回放", Host: "replay"},
+		}
+		for _, msg := range r.Messages {
+			if msg.RoomID != roomID {
+				continue
+			}
+			if src.status.RealRoomID == 0 {
+				src.status.RealRoomID, src.status.AnchorUID = msg.RealRoomID, msg.AnchorUID
+			}
+			src.recorded = append(src.recorded, msg)
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+type ReplaySource struct {
+	speed    float64
+	base     time.Time
+	recorded []RecordedMessage
+	messages chan *DanmakuMessage
+	stop     chan struct{}
+	once     sync.Once
+
+	mu     sync.Mutex
+	status RoomStatus
+}
+
+func (r *ReplaySource) Connect() error {
+	r.mu.Lock()
+	r.status.Connected = true
+	r.mu.Unlock()
+	go r.play(time.Now())
+	return nil
+}
+
+// 按录制时的间隔放消息，Speed 为 0 就不等
+func (r *ReplaySource) play(start time.Time) {
+	for _, recorded := range r.recorded {
+		if r.speed > 0 {
+			due := start.Add(time.Duration(float64(recorded.Time.Sub(r.base)) / r.speed))
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-r.stop:
+					return
+				case <-time.After(wait):
+				}
+			}
+		}
+
+		var msg DanmakuMessage
+		r.mu.Lock()
+		if err := json.Unmarshal(recorded.Message, &msg); err != nil {
+			r.status.Undecoded++
+			r.mu.Unlock()
+			continue
+		}
+		r.status.LastMessage = time.Now()
+		r.mu.Unlock()
+
+		select {
+		case r.messages <- &msg:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *ReplaySource) Close() {
+	r.once.Do(func() { close(r.stop) })
+	r.mu.Lock()
+	r.status.Connected = false
+	r.mu.Unlock()
+}
+
+func (r *ReplaySource) Messages() <-chan *DanmakuMessage {
+	return r.messages
+}
+
+func (r *ReplaySource) Status() RoomStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
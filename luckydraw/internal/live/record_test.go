@@ -0,0 +1,118 @@
+package live_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/live"
+	"luckydraw/internal/live/livetest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := startServer(t)
+	path := filepath.Join(t.TempDir(), "session.jsonl.gz")
+
+	recorder, err := live.NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lottery := live.NewLiveLottery([]int{1}, "")
+	lottery.SetRecorder(recorder)
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Send(
+		livetest.Danmaku(1, "a", "抽我"),
+		livetest.Danmaku(2, "b", "路过"),
+		livetest.DanmakuFrom(livetest.Sender{UID: 3, Username: "c", UserLevel: 5}, "抽我"),
+	)
+	waitFor(t, "live participants", func() bool { return lottery.GetParticipantCount() == 2 })
+	lottery.Stop()
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := live.LoadReplay(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replay.Messages) != 3 || replay.Messages[0].RealRoomID != testRoom {
+		t.Fatalf("recorded %d messages: %+v", len(replay.Messages), replay.Messages)
+	}
+
+	// 换一套更严的规则重跑同一场
+	rerun := live.NewReplayLottery(replay)
+	rerun.SetRules(config.EligibilityRules{MinUserLevel: 3})
+	if err := rerun.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+	defer rerun.Stop()
+	waitFor(t, "replayed participants", func() bool {
+		return rerun.GetParticipantCount() == 1 && len(rerun.Rejections()) == 1
+	})
+	if status := rerun.RoomStatuses()[0]; status.RoomID != 1 || status.RealRoomID != testRoom {
+		t.Fatalf("replay room status = %+v", status)
+	}
+}
+
+func TestLoadReplayKeepsTruncatedRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crashed.jsonl.gz")
+	recorder, err := live.NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+	for uid := 1; uid <= 3; uid++ {
+		msg := fmt.Sprintf(`{"cmd":"DANMU_MSG","info":[[],"抽我",[%d,"u"]]}`, uid)
+		if err := recorder.Record(live.RecordedMessage{Time: time.Now(), RoomID: 1, Message: []byte(msg)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 没 Close 就是崩了的样子：没有 gzip 结尾
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed := filepath.Join(t.TempDir(), "copy.jsonl.gz")
+	os.WriteFile(crashed, data, 0o644)
+	replay, err := live.LoadReplay(crashed, 0)
+	if err != nil || len(replay.Messages) != 3 {
+		t.Fatalf("replay = %+v, %v; want all 3 flushed messages", replay, err)
+	}
+
+	// 最后一条只写了一半
+	os.WriteFile(crashed, data[:len(data)-12], 0o644)
+	replay, err = live.LoadReplay(crashed, 0)
+	if err != nil || len(replay.Messages) != 2 {
+		t.Fatalf("replay = %+v, %v; want the 2 complete messages", replay, err)
+	}
+}
+
+func TestReplayHonoursSpeed(t *testing.T) {
+	start := time.Now()
+	replay := &live.Replay{Speed: 10, Messages: []live.RecordedMessage{
+		{Time: start, RoomID: 1, Message: []byte(`{"cmd":"DANMU_MSG","info":[[],"抽我",[1,"a"]]}`)},
+		{Time: start.Add(time.Second), RoomID: 1, Message: []byte(`{"cmd":"DANMU_MSG","info":[[],"抽我",[2,"b"]]}`)},
+	}}
+
+	lottery := live.NewReplayLottery(replay)
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+
+	waitFor(t, "first message", func() bool { return lottery.GetParticipantCount() == 1 })
+	time.Sleep(30 * time.Millisecond)
+	if n := lottery.GetParticipantCount(); n != 1 {
+		t.Fatalf("second message arrived too early: %d participants", n)
+	}
+	waitFor(t, "second message", func() bool { return lottery.GetParticipantCount() == 2 })
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("replay finished in %v, want about 100ms at 10x", elapsed)
+	}
+}
@@ -0,0 +1,65 @@
+package live
+
+import "strings"
+
+// hantPairs 是繁体字和对应的简体字两两挨着排的，只收了弹幕里常见的字，
+// 一简对多繁（臺/颱/檯→台）的都折成同一个简体
+const hantPairs = "" +
+	"丟丢並并亂乱亞亚佔占來来係系個个們们偉伟側侧傘伞備备傳传傷伤僅仅價价儀仪億亿優优" +
+	"儲储兌兑兒儿內内兩两冊册凍冻則则剛刚創创劃划劉刘劍剑勁劲動动務务勝胜勢势勵励勸劝" +
+	"匯汇區区協协卻却厭厌厲厉參参叢丛員员問问啟启喚唤單单嗎吗嘆叹嘗尝噴喷嚇吓嚴严囉啰" +
+	"國国圍围園园圓圆圖图團团堅坚報报場场塊块塵尘壓压壞坏壯壮壺壶壽寿夠够夢梦夾夹奧奥" +
+	"奪夺奮奋妝妆婦妇媽妈嬌娇嬰婴孫孙學学孿孪實实寧宁審审寫写寬宽寵宠寶宝將将專专尋寻" +
+	"對对導导尷尴屆届層层屬属島岛嶺岭嶼屿巔巅帥帅師师帳帐帶带幣币幫帮幹干幾几庫库廢废" +
+	"廣广廬庐廳厅弔吊強强彈弹彎弯彙汇後后徑径從从復复徹彻悅悦惱恼愛爱愜惬慘惨慣惯慮虑" +
+	"慶庆憂忧憐怜憑凭憶忆懇恳應应懶懒懷怀懼惧戀恋戰战戲戏戶户拋抛捨舍掃扫掛挂採采揚扬" +
+	"換换損损搖摇搶抢撥拨擁拥擇择擊击擋挡擔担據据擠挤擬拟擴扩擺摆擾扰攔拦攜携攝摄攤摊" +
+	"敗败敘叙敵敌數数斂敛斷断於于時时暈晕暫暂曆历曉晓曠旷曬晒書书會会朮术東东桿杆條条" +
+	"梟枭棄弃棧栈椏桠楊杨楓枫業业極极榮荣構构槍枪槓杠樂乐樓楼標标樣样樸朴樹树橋桥機机" +
+	"橫横檢检檯台櫃柜櫻樱欄栏權权歎叹歐欧歡欢歲岁歷历歸归殘残殺杀殼壳毀毁氈毡氣气汙污" +
+	"決决沒没況况涼凉淒凄淚泪淨净淺浅減减渦涡測测渾浑湧涌湯汤準准溝沟溫温溼湿滅灭滾滚" +
+	"滿满漁渔漢汉漸渐潑泼潔洁潛潜澀涩澤泽濃浓濕湿濟济濾滤瀟潇瀨濑灑洒灣湾災灾為为烏乌" +
+	"烴烃無无煉炼煙烟煩烦熱热燈灯燒烧燦灿燭烛爐炉爛烂爭争爺爷牆墙犧牺狀状狹狭猶犹獄狱" +
+	"獅狮獎奖獨独獲获獻献玀猡現现環环璽玺甕瓮產产畝亩畢毕畫画異异當当疊叠痺痹瘋疯瘡疮" +
+	"療疗癢痒癮瘾發发皺皱盜盗盡尽監监盤盘眾众睏困矯矫碩硕確确碼码磚砖礎础礦矿祿禄禍祸" +
+	"禪禅禮礼稅税種种稱称穀谷穩稳窩窝窮穷窯窑竊窃競竞筆笔筍笋箏筝節节範范築筑篩筛簡简" +
+	"簽签簾帘籃篮籠笼籤签糧粮糾纠紀纪紅红紋纹納纳純纯紙纸級级紡纺細细紳绅紹绍終终組组" +
+	"結结絕绝絡络給给統统絲丝綁绑經经綜综綠绿綢绸維维網网緊紧緒绪線线緣缘編编緩缓練练" +
+	"縣县縫缝縮缩總总績绩織织繞绕繩绳繪绘繼继續续罈坛罰罚罷罢羅罗羨羡習习翹翘聖圣聞闻" +
+	"聯联聲声聳耸職职聽听腦脑腳脚膚肤膽胆臉脸臟脏臺台與与舊旧艙舱艱艰莊庄莖茎華华萬万" +
+	"葉叶蒼苍蓋盖蓮莲蔣蒋蔥葱蕭萧薑姜薦荐藍蓝藝艺藥药蘆芦蘇苏蘋苹蘭兰處处號号蝦虾蟲虫" +
+	"蠅蝇衆众術术衛卫衝冲袞衮裏里補补裝装裡里製制複复褲裤襪袜襯衬見见規规覓觅視视親亲" +
+	"覺觉覽览觀观觸触訂订計计訊讯討讨訓训託托記记訝讶訪访設设許许詐诈評评詞词詢询試试" +
+	"詩诗話话該该詳详誇夸誌志認认誕诞語语誠诚誤误說说誰谁課课誼谊調调談谈請请諒谅論论" +
+	"諸诸謀谋謎谜謙谦講讲謝谢謠谣證证譏讥識识譯译議议護护讀读變变讓让讚赞豎竖豐丰豬猪" +
+	"貓猫貝贝負负貨货販贩貪贪貫贯責责貴贵貶贬買买貸贷費费貼贴賀贺資资賊贼賜赐賞赏賠赔" +
+	"賢贤賣卖質质賬账賴赖賺赚購购賽赛贈赠贊赞贏赢贖赎趕赶趙赵趨趋跡迹踐践蹟迹蹤踪躍跃" +
+	"車车軌轨軍军軟软較较載载輔辅輕轻輛辆輩辈輪轮輸输轉转轟轰辦办辭辞農农逕迳這这連连" +
+	"週周進进遊游運运過过達达違违遙遥遞递遠远遲迟遷迁選选遺遗還还邊边鄉乡鄰邻醜丑醫医" +
+	"醬酱釀酿釋释針针釣钓鈔钞鈕钮鈴铃鉛铅銀银銅铜銳锐銷销鋒锋鋪铺鋼钢錄录錘锤錢钱錦锦" +
+	"錯错錶表鍊炼鍋锅鍛锻鍵键鎖锁鎮镇鏈链鏟铲鏡镜鐘钟鐵铁鑰钥鑽钻長长門门閃闪閉闭開开" +
+	"閒闲間间閘闸閣阁閱阅闆板闊阔闖闯關关陣阵陰阴陳陈陸陆陽阳隊队隕陨際际隨随險险隱隐" +
+	"隻只雋隽雖虽雙双雜杂雞鸡離离難难雲云電电霧雾靂雳靈灵靜静韌韧韓韩韻韵響响頁页頂顶" +
+	"項项順顺須须頌颂預预頓顿領领頭头頸颈頻频顆颗題题額额顏颜願愿顛颠顧顾顯显風风颱台" +
+	"颳刮飄飘飛飞飢饥飯饭飲饮飽饱餃饺餅饼養养餓饿餘余館馆饅馒馬马駐驻駕驾騎骑騙骗騰腾" +
+	"驅驱驗验驚惊驢驴骯肮髒脏體体髮发鬆松鬍胡鬥斗鬧闹鬱郁魚鱼魯鲁鮮鲜鯨鲸鳥鸟鳳凤鳴鸣" +
+	"鴨鸭鵝鹅鷹鹰鹹咸鹽盐麗丽麥麦麵面麼么黃黄點点黨党黴霉齊齐齋斋齒齿齡龄龍龙龔龚龜龟"
+
+var hantToHans = func() map[rune]rune {
+	runes := []rune(hantPairs)
+	m := make(map[rune]rune, len(runes)/2)
+	for i := 0; i+1 < len(runes); i += 2 {
+		m[runes[i]] = runes[i+1]
+	}
+	return m
+}()
+
+// toSimplified 逐字把繁体换成简体，不认识的字原样留着
+func toSimplified(s string) string {
+	return strings.Map(func(r rune) rune {
+		if hans, ok := hantToHans[r]; ok {
+			return hans
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,124 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"luckydraw/internal/event"
+)
+
+const messageBuffer = 256
+
+// MessageSource 是抽奖的消息来源：直播间、录像、压测用的假弹幕都可以
+type MessageSource interface {
+	// Connect 第一次连不上就返回错误，能重试的源自己在后台接着连，直到 Close
+	Connect() error
+	Close()
+	Messages() <-chan *DanmakuMessage
+	Status() RoomStatus
+}
+
+// 下面几个是可选能力，源支持就用上
+type emitterSetter interface {
+	SetEmitter(event.Emitter)
+}
+
+type recorderSetter interface {
+	SetRecorder(*Recorder)
+}
+
+var (
+	_ MessageSource = (*DanmakuClient)(nil)
+	_ MessageSource = (*ReplaySource)(nil)
+	_ MessageSource = (*GeneratorSource)(nil)
+)
+
+// GeneratorSource 按固定速率造假弹幕，压测和没开播时演示用
+type GeneratorSource struct {
+	roomID   int
+	users    int
+	interval time.Duration
+	message  string
+	messages chan *DanmakuMessage
+	stop     chan struct{}
+	once     sync.Once
+
+	mu     sync.Mutex
+	status RoomStatus
+}
+
+func NewGeneratorSource(roomID, users int, perSecond float64, message string) *GeneratorSource {
+	if users <= 0 {
+		users = 1
+	}
+	interval := time.Second
+	if perSecond > 0 {
+		interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return &GeneratorSource{
+		roomID:   roomID,
+		users:    users,
+		interval: interval,
+		message:  message,
+		messages: make(chan *DanmakuMessage, messageBuffer),
+		stop:     make(chan struct{}),
+		status:   RoomStatus{RoomID: roomID, RealRoomID: roomID, Title: "假弹幕", LiveStatus: 1, Host: "generator"},
+	}
+}
+
+func (g *GeneratorSource) Connect() error {
+	g.mu.Lock()
+	g.status.Connected = true
+	g.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(g.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-ticker.C:
+			}
+			uid := int64(rand.Intn(g.users) + 1)
+			info, _ := json.Marshal([]any{
+				[]any{},
+				g.message,
+				[]any{uid, fmt.Sprintf("用户%d", uid)},
+				[]any{},
+				[]any{rand.Intn(60)},
+			})
+			msg := &DanmakuMessage{CMD: "DANMU_MSG", Info: info}
+
+			g.mu.Lock()
+			g.status.LastMessage = time.Now()
+			g.mu.Unlock()
+			select {
+			case g.messages <- msg:
+			case <-g.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (g *GeneratorSource) Close() {
+	g.once.Do(func() { close(g.stop) })
+	g.mu.Lock()
+	g.status.Connected = false
+	g.mu.Unlock()
+}
+
+func (g *GeneratorSource) Messages() <-chan *DanmakuMessage {
+	return g.messages
+}
+
+func (g *GeneratorSource) Status() RoomStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status
+}
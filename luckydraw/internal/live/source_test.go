@@ -0,0 +1,65 @@
+package live_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"luckydraw/internal/live"
+)
+
+type chanSource struct {
+	status   live.RoomStatus
+	messages chan *live.DanmakuMessage
+	closed   bool
+}
+
+func (c *chanSource) Connect() error                        { c.status.Connected = true; return nil }
+func (c *chanSource) Close()                                { c.closed = true }
+func (c *chanSource) Messages() <-chan *live.DanmakuMessage { return c.messages }
+func (c *chanSource) Status() live.RoomStatus               { return c.status }
+
+func danmakuMessage(uid int64, name, text string) *live.DanmakuMessage {
+	info, _ := json.Marshal([]any{[]any{}, text, []any{uid, name}})
+	return &live.DanmakuMessage{CMD: "DANMU_MSG", Info: info}
+}
+
+func TestLiveLotteryConsumesAnySource(t *testing.T) {
+	src := &chanSource{
+		status:   live.RoomStatus{RoomID: 7, RealRoomID: 7007},
+		messages: make(chan *live.DanmakuMessage, 4),
+	}
+	joined := make(chan *live.DanmakuUser, 4)
+	lottery := live.NewSourceLottery(src)
+	lottery.OnUserJoin = func(u *live.DanmakuUser) { joined <- u }
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+
+	src.messages <- danmakuMessage(1, "a", "抽我")
+	src.messages <- danmakuMessage(2, "b", "不抽")
+	if u := <-joined; u.UID != 1 || u.RoomID != 7 {
+		t.Fatalf("joined = %+v", u)
+	}
+	if !lottery.RoomStatuses()[0].Connected {
+		t.Fatal("source not connected on start")
+	}
+
+	lottery.Stop()
+	if !src.closed {
+		t.Fatal("source not closed on stop")
+	}
+}
+
+func TestGeneratorSource(t *testing.T) {
+	gen := live.NewGeneratorSource(1, 50, 1000, "抽我")
+	lottery := live.NewSourceLottery(gen)
+	if err := lottery.Start("抽我"); err != nil {
+		t.Fatal(err)
+	}
+	defer lottery.Stop()
+
+	waitFor(t, "generated participants", func() bool { return lottery.GetParticipantCount() >= 10 })
+	if n := lottery.GetParticipantCount(); n > 50 {
+		t.Fatalf("%d participants from a 50-user generator", n)
+	}
+}
@@ -0,0 +1,251 @@
+package live
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"luckydraw/internal/config"
+)
+
+// DrawAlgorithm 任何会改变开奖结果的改动都必须换一个版本号，老记录才能按老算法复验
+const DrawAlgorithm = "sha256-ctr-weighted/v1"
+
+type SnapshotEntry struct {
+	UID    int64   `json:"uid"`
+	Weight float64 `json:"weight"`
+}
+
+func NewSeed() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	seed := hex.EncodeToString(buf)
+	return seed, Commitment(seed), nil
+}
+
+func Commitment(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+func SnapshotHash(entries []SnapshotEntry) string {
+	sorted := sortedEntries(entries)
+
+	var b strings.Builder
+	for _, e := range sorted {
+		b.WriteString(strconv.FormatInt(e.UID, 10))
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatFloat(e.Weight, 'g', -1, 64))
+		b.WriteByte('\n')
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashStream 是开奖用的确定性随机数：第 n 个 64 位数取自
+// sha256(seed ":" snapshotHash ":" round ":" n) 的前 8 字节
+type hashStream struct {
+	key     string
+	counter uint64
+}
+
+func newHashStream(seed, snapshotHash string, round int) *hashStream {
+	return &hashStream{key: fmt.Sprintf("%s:%s:%d:", seed, snapshotHash, round)}
+}
+
+// 补抽用独立的流，第 attempt 次补抽不会和主抽或其它补抽撞号
+func newRedrawStream(seed, poolHash string, round, attempt int) *hashStream {
+	return &hashStream{key: fmt.Sprintf("%s:%s:%d:redraw-%d:", seed, poolHash, round, attempt)}
+}
+
+func (h *hashStream) Uint64() uint64 {
+	sum := sha256.Sum256([]byte(h.key + strconv.FormatUint(h.counter, 10)))
+	h.counter++
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func (h *hashStream) Float64() float64 {
+	return float64(h.Uint64()>>11) / (1 << 53)
+}
+
+func (h *hashStream) Intn(n int) int {
+	return int(h.Uint64() % uint64(n))
+}
+
+func drawSnapshot(proof config.DrawProof, entries []SnapshotEntry, count int) []int64 {
+	sorted := sortedEntries(entries)
+
+	weights := make([]float64, len(sorted))
+	for i, e := range sorted {
+		weights[i] = e.Weight
+	}
+
+	if count <= 0 || count > len(sorted) {
+		count = len(sorted)
+	}
+	stream := newHashStream(proof.Seed, proof.SnapshotHash, proof.Round)
+	winners := make([]int64, 0, count)
+	for _, idx := range pickIndices(stream, weights, count) {
+		winners = append(winners, sorted[idx].UID)
+	}
+	return winners
+}
+
+func sortedEntries(entries []SnapshotEntry) []SnapshotEntry {
+	sorted := make([]SnapshotEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].UID < sorted[j].UID })
+	return sorted
+}
+
+func RedrawOne(proof config.DrawProof, pool []SnapshotEntry, attempt int) (int64, string, bool) {
+	if len(pool) == 0 {
+		return 0, "", false
+	}
+	sorted := sortedEntries(pool)
+	poolHash := SnapshotHash(sorted)
+
+	weights := make([]float64, len(sorted))
+	for i, e := range sorted {
+		weights[i] = e.Weight
+	}
+	stream := newRedrawStream(proof.Seed, poolHash, proof.Round, attempt)
+	picked := pickIndices(stream, weights, 1)
+	return sorted[picked[0]].UID, poolHash, true
+}
+
+func RemainingPool(entries []SnapshotEntry, taken map[int64]bool) []SnapshotEntry {
+	pool := make([]SnapshotEntry, 0, len(entries))
+	for _, e := range entries {
+		if !taken[e.UID] {
+			pool = append(pool, e)
+		}
+	}
+	return pool
+}
+
+func VerifyDraw(proof config.DrawProof, entries []SnapshotEntry, count int) ([]int64, error) {
+	if proof.Algorithm != DrawAlgorithm {
+		return nil, fmt.Errorf("不认识的开奖算法: %s", proof.Algorithm)
+	}
+	if Commitment(proof.Seed) != proof.Commitment {
+		return nil, fmt.Errorf("种子和开奖前公布的承诺对不上")
+	}
+	if hash := SnapshotHash(entries); hash != proof.SnapshotHash {
+		return nil, fmt.Errorf("参与名单被动过了: %s != %s", hash, proof.SnapshotHash)
+	}
+	return drawSnapshot(proof, entries, count), nil
+}
+
+// VerifyBundle 分奖项开的时候 Participants 是整份名单，每个奖项一份自己的 bundle 放在 Tiers 里，
+// 补抽都记在最外层，按 Prize 找回是哪个奖项的
+type VerifyBundle struct {
+	Name         string                `json:"name,omitempty"`
+	Proof        config.DrawProof      `json:"proof"`
+	Count        int                   `json:"count"`
+	Participants []SnapshotEntry       `json:"participants"`
+	Winners      []int64               `json:"winners,omitempty"`
+	Redraws      []config.RedrawRecord `json:"redraws,omitempty"`
+	Tiers        []VerifyBundle        `json:"tiers,omitempty"`
+}
+
+func (b *VerifyBundle) Verify() ([]int64, error) {
+	if len(b.Tiers) > 0 {
+		return b.verifyTiers()
+	}
+	winners, err := b.verifyWinners()
+	if err != nil || len(b.Winners) == 0 {
+		return winners, err
+	}
+
+	taken := make(map[int64]bool, len(winners))
+	for _, uid := range winners {
+		taken[uid] = true
+	}
+	for _, r := range b.Redraws {
+		uid, err := replayRedraw(b.Proof, b.Participants, taken, r)
+		if err != nil {
+			return winners, err
+		}
+		winners = append(winners, uid)
+	}
+	return winners, nil
+}
+
+func (b *VerifyBundle) verifyWinners() ([]int64, error) {
+	winners, err := VerifyDraw(b.Proof, b.Participants, b.Count)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Winners) == 0 {
+		return winners, nil
+	}
+	if len(b.Winners) != len(winners) {
+		return winners, fmt.Errorf("中奖人数对不上: 记录 %d 人，复算 %d 人", len(b.Winners), len(winners))
+	}
+	for i := range winners {
+		if winners[i] != b.Winners[i] {
+			return winners, fmt.Errorf("第 %d 位中奖者对不上: 记录 %d，复算 %d", i+1, b.Winners[i], winners[i])
+		}
+	}
+	return winners, nil
+}
+
+// verifyTiers 每个奖项单独复验，还要确认名单里没混进前面奖项已经中了的人
+func (b *VerifyBundle) verifyTiers() ([]int64, error) {
+	var winners []int64
+	taken := make(map[int64]bool)
+	tiers := make(map[string]*VerifyBundle, len(b.Tiers))
+	for i := range b.Tiers {
+		t := &b.Tiers[i]
+		if t.Proof.Commitment != b.Proof.Commitment {
+			return winners, fmt.Errorf("「%s」用的不是开奖前公布的种子", t.Name)
+		}
+		for _, e := range t.Participants {
+			if taken[e.UID] {
+				return winners, fmt.Errorf("「%s」的名单里混进了前面已经中奖的 %d", t.Name, e.UID)
+			}
+		}
+		tierWinners, err := t.verifyWinners()
+		winners = append(winners, tierWinners...)
+		if err != nil {
+			return winners, fmt.Errorf("「%s」: %v", t.Name, err)
+		}
+		for _, uid := range tierWinners {
+			taken[uid] = true
+		}
+		tiers[t.Name] = t
+	}
+
+	for _, r := range b.Redraws {
+		t, ok := tiers[r.Prize]
+		if !ok {
+			return winners, fmt.Errorf("第 %d 次补抽的奖项「%s」不存在", r.Attempt, r.Prize)
+		}
+		uid, err := replayRedraw(t.Proof, t.Participants, taken, r)
+		if err != nil {
+			return winners, err
+		}
+		winners = append(winners, uid)
+	}
+	return winners, nil
+}
+
+func replayRedraw(proof config.DrawProof, participants []SnapshotEntry, taken map[int64]bool, r config.RedrawRecord) (int64, error) {
+	if !taken[r.ForfeitedUID] {
+		return 0, fmt.Errorf("第 %d 次补抽放弃的 %d 根本没中奖", r.Attempt, r.ForfeitedUID)
+	}
+	uid, poolHash, ok := RedrawOne(proof, RemainingPool(participants, taken), r.Attempt)
+	if !ok || uid != r.ReplacementUID || poolHash != r.PoolHash {
+		return uid, fmt.Errorf("第 %d 次补抽对不上: 记录 %d，复算 %d", r.Attempt, r.ReplacementUID, uid)
+	}
+	taken[uid] = true
+	return uid, nil
+}
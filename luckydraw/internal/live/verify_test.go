@@ -0,0 +1,140 @@
+package live
+
+import (
+	"slices"
+	"testing"
+
+	"luckydraw/internal/config"
+)
+
+func TestDrawIsReproducible(t *testing.T) {
+	l := NewLiveLottery(nil, "")
+	if err := l.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	for uid := int64(1); uid <= 50; uid++ {
+		l.users[uid] = &DanmakuUser{UID: uid, Count: int(uid%5) + 1}
+	}
+	l.SetWeightStrategy(countWeight{})
+
+	result, err := l.Draw(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	winners, proof := result.Winners, result.Proof
+	if Commitment(proof.Seed) != l.Commitment() {
+		t.Fatal("proof seed does not match the published commitment")
+	}
+
+	entries := make([]SnapshotEntry, 0, len(result.Participants))
+	for _, p := range result.Snapshot() {
+		entries = append(entries, SnapshotEntry{UID: p.UID, Weight: p.Weight})
+	}
+	bundle := VerifyBundle{Proof: proof, Count: 5, Participants: entries}
+	for _, w := range winners {
+		bundle.Winners = append(bundle.Winners, w.UID)
+	}
+	if _, err := bundle.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := l.Draw(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := second.Winners
+	same := true
+	for i := range again {
+		same = same && again[i].UID == winners[i].UID
+	}
+	if same {
+		t.Fatal("second round repeated the first round")
+	}
+
+	entries[0].Weight++
+	if _, err := VerifyDraw(proof, entries, 5); err == nil {
+		t.Fatal("tampered snapshot passed verification")
+	}
+}
+
+func TestDrawNeedsCommitment(t *testing.T) {
+	l := NewLiveLottery(nil, "")
+	l.users[1] = &DanmakuUser{UID: 1, Count: 1}
+	if _, err := l.Draw(1); err == nil {
+		t.Fatal("draw without a published commitment should fail")
+	}
+	if _, err := l.DrawTiers([]config.PrizeTier{{Name: "一等奖", Quantity: 1}}); err == nil {
+		t.Fatal("tier draw without a published commitment should fail")
+	}
+	if l.Commitment() != "" {
+		t.Fatal("failed draw should not make up a commitment")
+	}
+}
+
+func TestDrawTiersVerifiesPerTier(t *testing.T) {
+	l := NewLiveLottery(nil, "")
+	if err := l.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	for uid := int64(1); uid <= 30; uid++ {
+		u := &DanmakuUser{UID: uid, Count: 1}
+		if uid%10 == 0 {
+			u.GuardLevel = GuardCaptain
+		}
+		l.users[uid] = u
+	}
+
+	tiers := []config.PrizeTier{
+		{Name: "一等奖", Quantity: 1, Rules: &config.EligibilityRules{GuardLevel: GuardCaptain}},
+		{Name: "二等奖", Quantity: 3},
+		{Name: "三等奖", Quantity: 10},
+	}
+	result, err := l.DrawTiers(tiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tiers) != 3 || len(result.Winners) != 14 {
+		t.Fatalf("tiers = %d, winners = %d", len(result.Tiers), len(result.Winners))
+	}
+	if w := result.Tiers[0].Winners[0]; w.GuardLevel != GuardCaptain || w.Prize != "一等奖" {
+		t.Fatalf("first prize winner = %+v", w)
+	}
+	if result.Tiers[0].Proof.Participants != 3 {
+		t.Fatalf("first prize pool = %d, want the 3 captains", result.Tiers[0].Proof.Participants)
+	}
+	seen := make(map[int64]bool)
+	for _, w := range result.Winners {
+		if seen[w.UID] {
+			t.Fatalf("%d won twice", w.UID)
+		}
+		seen[w.UID] = true
+	}
+
+	// 按快照里记下的资格还原每个奖项的名单
+	snapshot := result.Snapshot()
+	bundle := VerifyBundle{Proof: result.Proof}
+	taken := make(map[int64]bool)
+	for i, tr := range result.Tiers {
+		tier := VerifyBundle{Name: tr.Name, Proof: tr.Proof, Count: tiers[i].Quantity}
+		for _, p := range snapshot {
+			if !taken[p.UID] && !slices.Contains(p.Ineligible, i) {
+				tier.Participants = append(tier.Participants, SnapshotEntry{UID: p.UID, Weight: p.Weight})
+			}
+		}
+		for _, w := range tr.Winners {
+			tier.Winners = append(tier.Winners, w.UID)
+			taken[w.UID] = true
+		}
+		bundle.Tiers = append(bundle.Tiers, tier)
+	}
+	if _, err := bundle.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 前面中过的人混进后面奖项的名单
+	first := bundle.Tiers[0].Winners[0]
+	bundle.Tiers[1].Participants = append(bundle.Tiers[1].Participants, SnapshotEntry{UID: first, Weight: 1})
+	if _, err := bundle.Verify(); err == nil {
+		t.Fatal("repeat winner passed verification")
+	}
+}
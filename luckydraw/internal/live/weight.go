@@ -0,0 +1,139 @@
+package live
+
+import (
+	"fmt"
+
+	"luckydraw/internal/config"
+)
+
+const (
+	WeightUniform = "uniform"
+	WeightCount   = "count"
+	WeightGift    = "gift"
+	WeightGuard   = "guard"
+)
+
+type WeightStrategy interface {
+	Name() string
+	Weight(u *DanmakuUser) float64
+}
+
+type uniformWeight struct{}
+
+func (uniformWeight) Name() string                  { return WeightUniform }
+func (uniformWeight) Weight(u *DanmakuUser) float64 { return 1 }
+
+type countWeight struct{}
+
+func (countWeight) Name() string { return WeightCount }
+func (countWeight) Weight(u *DanmakuUser) float64 {
+	if u.Count < 1 {
+		return 1
+	}
+	return float64(u.Count)
+}
+
+// 每人保底一份，每花一块电池（100 金瓜子）多一份
+type giftWeight struct{}
+
+func (giftWeight) Name() string { return WeightGift }
+func (giftWeight) Weight(u *DanmakuUser) float64 {
+	return 1 + float64(u.Coin)/100
+}
+
+type guardWeight struct {
+	multipliers map[int]float64
+}
+
+func (guardWeight) Name() string { return WeightGuard }
+func (g guardWeight) Weight(u *DanmakuUser) float64 {
+	if m, ok := g.multipliers[u.GuardLevel]; ok && m > 0 {
+		return m
+	}
+	return 1
+}
+
+func NewWeightStrategy(cfg config.WeightingConfig) (WeightStrategy, error) {
+	switch cfg.Strategy {
+	case "", WeightUniform:
+		return uniformWeight{}, nil
+	case WeightCount:
+		return countWeight{}, nil
+	case WeightGift:
+		return giftWeight{}, nil
+	case WeightGuard:
+		g := guardWeight{multipliers: map[int]float64{
+			GuardGovernor: 10,
+			GuardAdmiral:  5,
+			GuardCaptain:  3,
+		}}
+		if cfg.GovernorMultiplier > 0 {
+			g.multipliers[GuardGovernor] = cfg.GovernorMultiplier
+		}
+		if cfg.AdmiralMultiplier > 0 {
+			g.multipliers[GuardAdmiral] = cfg.AdmiralMultiplier
+		}
+		if cfg.CaptainMultiplier > 0 {
+			g.multipliers[GuardCaptain] = cfg.CaptainMultiplier
+		}
+		return g, nil
+	}
+	return nil, fmt.Errorf("不认识的权重方式: %s", cfg.Strategy)
+}
+
+type randSource interface {
+	Float64() float64
+	Intn(n int) int
+}
+
+func pickWeighted(r randSource, users []*DanmakuUser, strategy WeightStrategy, count int) []*DanmakuUser {
+	weights := make([]float64, len(users))
+	for i, u := range users {
+		weights[i] = strategy.Weight(u)
+	}
+
+	winners := make([]*DanmakuUser, 0, count)
+	for _, idx := range pickIndices(r, weights, count) {
+		winner := *users[idx]
+		winner.Weight = weights[idx]
+		winners = append(winners, &winner)
+	}
+	return winners
+}
+
+func pickIndices(r randSource, weights []float64, count int) []int {
+	pool := make([]int, len(weights))
+	remaining := make([]float64, len(weights))
+	total := 0.0
+	for i, w := range weights {
+		pool[i] = i
+		if w < 0 {
+			w = 0
+		}
+		remaining[i] = w
+		total += w
+	}
+
+	picked := make([]int, 0, count)
+	for len(picked) < count && len(pool) > 0 {
+		idx := len(pool) - 1
+		if total > 0 {
+			target := r.Float64() * total
+			for i, w := range remaining {
+				if target < w {
+					idx = i
+					break
+				}
+				target -= w
+			}
+		} else {
+			idx = r.Intn(len(pool))
+		}
+
+		picked = append(picked, pool[idx])
+		total -= remaining[idx]
+		pool = append(pool[:idx], pool[idx+1:]...)
+		remaining = append(remaining[:idx], remaining[idx+1:]...)
+	}
+	return picked
+}
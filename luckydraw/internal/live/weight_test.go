@@ -0,0 +1,69 @@
+package live
+
+import (
+	"math/rand"
+	"testing"
+
+	"luckydraw/internal/config"
+)
+
+func TestPickWeightedFavoursHeavyUsers(t *testing.T) {
+	users := []*DanmakuUser{
+		{UID: 1, Count: 1},
+		{UID: 2, Count: 9},
+	}
+	strategy, err := NewWeightStrategy(config.WeightingConfig{Strategy: WeightCount})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	heavy := 0
+	for i := 0; i < 5000; i++ {
+		winners := pickWeighted(r, users, strategy, 1)
+		if winners[0].UID == 2 {
+			heavy++
+			if winners[0].Weight != 9 {
+				t.Fatalf("weight = %v, want 9", winners[0].Weight)
+			}
+		}
+	}
+	if ratio := float64(heavy) / 5000; ratio < 0.85 || ratio > 0.95 {
+		t.Fatalf("heavy user won %.2f of draws, want ~0.9", ratio)
+	}
+}
+
+func TestPickWeightedNoRepeats(t *testing.T) {
+	users := []*DanmakuUser{
+		{UID: 1, GuardLevel: GuardGovernor},
+		{UID: 2, GuardLevel: GuardCaptain},
+		{UID: 3},
+		{UID: 4},
+	}
+	strategy, err := NewWeightStrategy(config.WeightingConfig{Strategy: WeightGuard, CaptainMultiplier: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	winners := pickWeighted(rand.New(rand.NewSource(7)), users, strategy, 4)
+	seen := map[int64]bool{}
+	for _, w := range winners {
+		if seen[w.UID] {
+			t.Fatalf("uid %d drawn twice", w.UID)
+		}
+		seen[w.UID] = true
+		want := map[int64]float64{1: 10, 2: 2, 3: 1, 4: 1}[w.UID]
+		if w.Weight != want {
+			t.Fatalf("uid %d weight = %v, want %v", w.UID, w.Weight, want)
+		}
+	}
+	if len(winners) != 4 || users[0].Weight != 0 {
+		t.Fatalf("winners = %d, source mutated = %v", len(winners), users[0].Weight != 0)
+	}
+}
+
+func TestNewWeightStrategyRejectsUnknown(t *testing.T) {
+	if _, err := NewWeightStrategy(config.WeightingConfig{Strategy: "vip"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -40,7 +40,7 @@ type QRCodeStatus struct {
 }
 
 func (q *QRLogin) GetQRCode() (*QRCodeInfo, error) {
-	resp, err := q.client.Get("https://passport.bilibili.com/x/passport-login/web/qrcode/generate")
+	resp, err := q.client.Get(bili.PassportBaseURL + "/x/passport-login/web/qrcode/generate")
 	if err != nil {
 		return nil, fmt.Errorf("你码不理我: %v", err)
 	}
@@ -82,7 +82,7 @@ func (q *QRLogin) CheckQRCodeStatus(qrcodeKey string) (*QRCodeStatus, error) {
 	params := url.Values{}
 	params.Set("qrcode_key", qrcodeKey)
 
-	req, err := http.NewRequest("GET", "https://passport.bilibili.com/x/passport-login/web/qrcode/poll?"+params.Encode(), nil)
+	req, err := http.NewRequest("GET", bili.PassportBaseURL+"/x/passport-login/web/qrcode/poll?"+params.Encode(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("你码不理我: %v", err)
 	}
@@ -105,15 +105,15 @@ func (q *QRLogin) CheckQRCodeStatus(qrcodeKey string) (*QRCodeStatus, error) {
 	}
 
 	if status.Code == 0 && status.Data.Code == 0 {
-		status.Cookie = collectSetCookies(resp)
+		status.Cookie = collectSetCookies(resp.Header)
 	}
 
 	return &status, nil
 }
 
-func collectSetCookies(resp *http.Response) string {
+func collectSetCookies(header http.Header) string {
 	var parts []string
-	for _, h := range resp.Header["Set-Cookie"] {
+	for _, h := range header["Set-Cookie"] {
 		if idx := strings.IndexByte(h, ';'); idx > 0 {
 			parts = append(parts, strings.TrimSpace(h[:idx]))
 		} else {
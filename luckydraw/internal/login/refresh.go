@@ -0,0 +1,151 @@
+package login
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"luckydraw/internal/bili"
+)
+
+// 网页端换 Cookie 用的公钥，拿它加密 refresh_<毫秒时间戳> 得到 correspondPath
+const correspondPublicKey = `-----BEGIN PUBLIC KEY-----
+MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDLgd2OAkcGVtoE3ThUREbio0Eg
+Uc/prcajMKXvkCKFCWhJYJcLkcM2DKKcSeFpD/j6Boy538YXnR6VhcuUJOhH2x71
+nzPjfdTcqMz7djHum0qSZA0AyCBDABUqCrfNgCiJ00Ra7GmRj+YCK1NJEuewlb40
+JNrRuoEUXpabUzGB8QIDAQAB
+-----END PUBLIC KEY-----`
+
+var refreshCSRFPattern = regexp.MustCompile(`<div id="1-name">\s*([^<\s]+)\s*</div>`)
+
+// CookieRefresher 借用这个号的 bili.Client 发请求，换到的新 Cookie 也直接换进这个 Client
+type CookieRefresher struct {
+	client *bili.Client
+}
+
+func NewCookieRefresher(client *bili.Client) *CookieRefresher {
+	return &CookieRefresher{client: client}
+}
+
+// NeedsRefresh 问一下 cookie/info 这套 Cookie 要不要换了
+func (r *CookieRefresher) NeedsRefresh() (bool, error) {
+	body, err := r.client.GetPlain(bili.PassportBaseURL+"/x/passport-login/web/cookie/info", map[string]string{
+		"csrf": r.client.CookieValue("bili_jct"),
+	})
+	if err != nil {
+		return false, err
+	}
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Refresh bool `json:"refresh"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return false, fmt.Errorf("解析一败涂地: %v", err)
+	}
+	if result.Code != 0 {
+		return false, &bili.APIError{Code: result.Code, Message: result.Message}
+	}
+	return result.Data.Refresh, nil
+}
+
+// Refresh 走完整套流程：correspondPath 换 refresh_csrf，cookie/refresh 拿新 Cookie，
+// 再用新 Cookie 去 confirm/refresh 把旧的作废。新 Cookie 会换进 Client 里，返回它和新 refresh_token
+func (r *CookieRefresher) Refresh(refreshToken string) (string, string, error) {
+	if refreshToken == "" {
+		return "", "", fmt.Errorf("没有 refresh_token，只能重新扫码了")
+	}
+
+	path, err := CorrespondPath(time.Now().UnixMilli())
+	if err != nil {
+		return "", "", err
+	}
+	page, err := r.client.GetPlain(bili.WWWBaseURL+"/correspond/1/"+path, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("refresh_csrf 拿不到: %v", err)
+	}
+	match := refreshCSRFPattern.FindSubmatch(page)
+	if match == nil {
+		return "", "", fmt.Errorf("refresh_csrf 拿不到: 页面里没有")
+	}
+
+	form := url.Values{}
+	form.Set("csrf", r.client.CookieValue("bili_jct"))
+	form.Set("refresh_csrf", string(match[1]))
+	form.Set("source", "main_web")
+	form.Set("refresh_token", refreshToken)
+	body, header, err := r.client.PostForm(bili.PassportBaseURL+"/x/passport-login/web/cookie/refresh", form)
+	if err != nil {
+		return "", "", err
+	}
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			RefreshToken string `json:"refresh_token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", "", fmt.Errorf("解析一败涂地: %v", err)
+	}
+	if result.Code != 0 {
+		return "", "", &bili.APIError{Code: result.Code, Message: result.Message}
+	}
+	newCookie := mergeCookies(r.client.GetCookie(), collectSetCookies(header))
+	r.client.SetCookie(newCookie)
+
+	// 确认失败也不影响新 Cookie 能用，只是旧的要晚点才失效
+	confirm := url.Values{}
+	confirm.Set("csrf", r.client.CookieValue("bili_jct"))
+	confirm.Set("refresh_token", refreshToken)
+	r.client.PostForm(bili.PassportBaseURL+"/x/passport-login/web/confirm/refresh", confirm)
+
+	return newCookie, result.Data.RefreshToken, nil
+}
+
+func CorrespondPath(ts int64) (string, error) {
+	block, _ := pem.Decode([]byte(correspondPublicKey))
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub.(*rsa.PublicKey), []byte(fmt.Sprintf("refresh_%d", ts)), nil)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(encrypted), nil
+}
+
+// mergeCookies 用新下发的项盖掉旧的，buvid 之类没变的留着
+func mergeCookies(old, fresh string) string {
+	var names []string
+	values := make(map[string]string)
+	for _, cookie := range []string{old, fresh} {
+		for _, part := range strings.Split(cookie, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok || name == "" {
+				continue
+			}
+			if _, seen := values[name]; !seen {
+				names = append(names, name)
+			}
+			values[name] = value
+		}
+	}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+values[name])
+	}
+	return strings.Join(parts, "; ")
+}
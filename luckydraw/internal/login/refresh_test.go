@@ -0,0 +1,98 @@
+package login
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"luckydraw/internal/bili"
+)
+
+type fakePassport struct {
+	*httptest.Server
+	mu       sync.Mutex
+	confirms []string
+}
+
+func newFakePassport(t *testing.T) *fakePassport {
+	f := &fakePassport{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/x/passport-login/web/cookie/info", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":0,"data":{"refresh":true,"timestamp":1}}`)
+	})
+	mux.HandleFunc("/correspond/1/", func(w http.ResponseWriter, r *http.Request) {
+		// 1024 位公钥加密出来是 128 字节
+		if len(strings.TrimPrefix(r.URL.Path, "/correspond/1/")) != 256 || !strings.Contains(r.Header.Get("Cookie"), "SESSDATA=old") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><div id="1-name">csrf-from-page</div></html>`)
+	})
+	mux.HandleFunc("/x/passport-login/web/cookie/refresh", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("refresh_csrf") != "csrf-from-page" || r.PostForm.Get("refresh_token") != "old-token" || r.PostForm.Get("csrf") != "old-jct" {
+			fmt.Fprint(w, `{"code":86095,"message":"refresh_csrf 错误"}`)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "SESSDATA", Value: "new"})
+		http.SetCookie(w, &http.Cookie{Name: "bili_jct", Value: "new-jct"})
+		fmt.Fprint(w, `{"code":0,"data":{"refresh_token":"new-token"}}`)
+	})
+	mux.HandleFunc("/x/passport-login/web/confirm/refresh", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		f.confirms = append(f.confirms, r.PostForm.Get("csrf")+"/"+r.PostForm.Get("refresh_token"))
+		f.mu.Unlock()
+		fmt.Fprint(w, `{"code":0}`)
+	})
+	f.Server = httptest.NewServer(mux)
+
+	oldPassport, oldWWW := bili.PassportBaseURL, bili.WWWBaseURL
+	bili.PassportBaseURL, bili.WWWBaseURL = f.URL, f.URL
+	t.Cleanup(func() {
+		bili.PassportBaseURL, bili.WWWBaseURL = oldPassport, oldWWW
+		f.Close()
+	})
+	return f
+}
+
+func TestCookieRefresh(t *testing.T) {
+	f := newFakePassport(t)
+	client := bili.NewClient("SESSDATA=old; bili_jct=old-jct; buvid3=keep")
+	r := NewCookieRefresher(client)
+
+	need, err := r.NeedsRefresh()
+	if err != nil || !need {
+		t.Fatalf("NeedsRefresh() = %v, %v", need, err)
+	}
+
+	cookie, token, err := r.Refresh("old-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie != "SESSDATA=new; bili_jct=new-jct; buvid3=keep" || token != "new-token" {
+		t.Fatalf("Refresh() = %q, %q", cookie, token)
+	}
+	if client.GetCookie() != cookie {
+		t.Fatalf("client cookie = %q", client.GetCookie())
+	}
+	// 确认时要用新 Cookie 的 csrf 和旧的 refresh_token
+	if len(f.confirms) != 1 || f.confirms[0] != "new-jct/old-token" {
+		t.Fatalf("confirm/refresh calls = %v", f.confirms)
+	}
+}
+
+func TestCookieRefreshRejected(t *testing.T) {
+	newFakePassport(t)
+	client := bili.NewClient("SESSDATA=old; bili_jct=old-jct")
+	_, _, err := NewCookieRefresher(client).Refresh("stale-token")
+	if apiErr, ok := err.(*bili.APIError); !ok || apiErr.Code != 86095 {
+		t.Fatalf("Refresh() error = %v, want code 86095", err)
+	}
+	if client.GetCookie() != "SESSDATA=old; bili_jct=old-jct" {
+		t.Fatalf("failed refresh changed the cookie to %q", client.GetCookie())
+	}
+}
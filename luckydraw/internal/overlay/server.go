@@ -0,0 +1,264 @@
+package overlay
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//go:embed overlay.html
+var overlayPage []byte
+
+const (
+	clientBuffer = 64
+	pingInterval = 30 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+type Source interface {
+	IsLiveLotteryRunning() bool
+	GetParticipantCount() int
+	GetParticipants() (string, error)
+	GetLastWinners() (string, error)
+	GetSeedCommitment() string
+}
+
+type Status struct {
+	Running      bool   `json:"running"`
+	Participants int    `json:"participants"`
+	Commitment   string `json:"commitment,omitempty"`
+}
+
+type Message struct {
+	Event string `json:"event"`
+	Data  any    `json:"data,omitempty"`
+}
+
+type Server struct {
+	source   Source
+	token    string
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	clients  map[*client]struct{}
+	http     *http.Server
+	listener net.Listener
+}
+
+type client struct {
+	conn *websocket.Conn
+	send chan []byte
+}
+
+func NewServer(source Source, token string) *Server {
+	return &Server{
+		source:  source,
+		token:   token,
+		clients: make(map[*client]struct{}),
+		upgrader: websocket.Upgrader{
+			// OBS 的浏览器源和本地页面来源五花八门，靠 token 把关
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handlePage)
+	mux.HandleFunc("/api/status", s.auth(s.handleStatus))
+	mux.HandleFunc("/api/participants", s.auth(s.handleParticipants))
+	mux.HandleFunc("/api/winners", s.auth(s.handleWinners))
+	mux.HandleFunc("/ws", s.auth(s.handleWS))
+	return mux
+}
+
+func (s *Server) Start(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	s.mu.Lock()
+	s.http, s.listener = srv, ln
+	s.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.Close()
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	srv := s.http
+	s.http, s.listener = nil, nil
+	for c := range s.clients {
+		delete(s.clients, c)
+		close(c.send)
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Close()
+}
+
+func (s *Server) Emit(name string, data ...any) bool {
+	msg := Message{Event: name}
+	if len(data) == 1 {
+		msg.Data = data[0]
+	} else if len(data) > 1 {
+		msg.Data = data
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		select {
+		case c.send <- payload:
+		default:
+			// 叠加层卡住了就丢消息，别拖慢抽奖
+		}
+	}
+	return len(s.clients) > 0
+}
+
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "token 不对喵", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != "/overlay" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(overlayPage)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, Status{
+		Running:      s.source.IsLiveLotteryRunning(),
+		Participants: s.source.GetParticipantCount(),
+		Commitment:   s.source.GetSeedCommitment(),
+	})
+}
+
+func (s *Server) handleParticipants(w http.ResponseWriter, r *http.Request) {
+	writeRaw(w, s.source.GetParticipants)
+}
+
+func (s *Server) handleWinners(w http.ResponseWriter, r *http.Request) {
+	writeRaw(w, s.source.GetLastWinners)
+}
+
+func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &client{conn: conn, send: make(chan []byte, clientBuffer)}
+
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+
+	go s.writeLoop(c)
+	s.readLoop(c)
+}
+
+// 叠加层不会发东西过来，读只是为了知道它什么时候断开
+func (s *Server) readLoop(c *client) {
+	defer s.drop(c)
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) writeLoop(c *client) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case payload, ok := <-c.send:
+			if !ok {
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				c.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) drop(c *client) {
+	s.mu.Lock()
+	if _, ok := s.clients[c]; ok {
+		delete(s.clients, c)
+		close(c.send)
+	}
+	s.mu.Unlock()
+	c.conn.Close()
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeRaw(w http.ResponseWriter, get func() (string, error)) {
+	data, err := get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(data))
+}
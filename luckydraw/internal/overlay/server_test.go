@@ -0,0 +1,96 @@
+package overlay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type fakeSource struct{}
+
+func (fakeSource) IsLiveLotteryRunning() bool { return true }
+func (fakeSource) GetParticipantCount() int   { return 2 }
+func (fakeSource) GetParticipants() (string, error) {
+	return `[{"uid":1,"username":"alice"},{"uid":2,"username":"bob"}]`, nil
+}
+func (fakeSource) GetLastWinners() (string, error) { return `[{"uid":2,"username":"bob"}]`, nil }
+func (fakeSource) GetSeedCommitment() string       { return "abc" }
+
+func TestServerRequiresToken(t *testing.T) {
+	srv := httptest.NewServer(NewServer(fakeSource{}, "secret").Handler())
+	defer srv.Close()
+
+	for _, path := range []string{"/api/status", "/api/status?token=wrong", "/ws"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, want 401", path, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/api/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status Status
+	json.NewDecoder(resp.Body).Decode(&status)
+	if !status.Running || status.Participants != 2 || status.Commitment != "abc" {
+		t.Fatalf("status = %+v", status)
+	}
+
+	resp, err = http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("overlay page status = %d", resp.StatusCode)
+	}
+}
+
+func TestServerStreamsEvents(t *testing.T) {
+	s := NewServer(fakeSource{}, "secret")
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	defer s.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?token=secret"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !s.Emit("live:user_join", map[string]any{"uid": 1, "username": "alice"}) {
+		if time.Now().After(deadline) {
+			t.Fatal("client never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var msg struct {
+		Event string `json:"event"`
+		Data  struct {
+			Username string `json:"username"`
+		} `json:"data"`
+	}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "live:user_join" || msg.Data.Username != "alice" {
+		t.Fatalf("message = %+v", msg)
+	}
+}
@@ -0,0 +1,196 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv 设了就用口令派生的密钥，没有钥匙串的 Linux 服务器靠它
+const PassphraseEnv = "LUCKYDRAW_PASSPHRASE"
+
+const (
+	KeeperSystem     = "system"
+	KeeperPassphrase = "passphrase"
+
+	keySize     = 32
+	serviceName = "BiliLuckyDraw"
+	accountName = "config-key"
+	keyFileName = "secret.key"
+)
+
+var ErrUnavailable = errors.New("没有能放密钥的地方")
+
+// Keeper 负责拿到加密配置用的那把 32 字节的 key
+type Keeper interface {
+	Name() string
+	Key() ([]byte, error)
+}
+
+// Default 挑一个能用的：设了口令就听口令的，否则用系统的钥匙串
+func Default(dir string) (Keeper, error) {
+	if os.Getenv(PassphraseEnv) != "" {
+		return ByName(KeeperPassphrase, dir)
+	}
+	keeper, err := ByName(KeeperSystem, dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := keeper.Key(); err != nil {
+		return nil, fmt.Errorf("%w: %v，设置 %s 用口令加密", ErrUnavailable, err, PassphraseEnv)
+	}
+	return keeper, nil
+}
+
+// ByName 找回加密时用的那个
+func ByName(name, dir string) (Keeper, error) {
+	switch name {
+	case KeeperSystem:
+		return cached{systemKeeper(dir), dir}, nil
+	case KeeperPassphrase:
+		pass := os.Getenv(PassphraseEnv)
+		if pass == "" {
+			return nil, fmt.Errorf("%w: 凭据是用口令加密的，要先设置 %s", ErrUnavailable, PassphraseEnv)
+		}
+		return cached{&passphraseKeeper{pass: pass, path: filepath.Join(dir, keyFileName)}, dir}, nil
+	}
+	return nil, fmt.Errorf("不认识的密钥来源: %s", name)
+}
+
+var (
+	keyMu    sync.Mutex
+	keyCache = map[string][]byte{}
+)
+
+// 钥匙串和 scrypt 都慢，同一个进程里拿到一次就记住
+type cached struct {
+	Keeper
+	dir string
+}
+
+func (c cached) Key() ([]byte, error) {
+	id := c.Name() + "\x00" + c.dir
+	if p, ok := c.Keeper.(*passphraseKeeper); ok {
+		sum := sha256.Sum256([]byte(p.pass))
+		id += "\x00" + string(sum[:])
+	}
+
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if key, ok := keyCache[id]; ok {
+		return key, nil
+	}
+	key, err := c.Keeper.Key()
+	if err != nil {
+		return nil, err
+	}
+	keyCache[id] = key
+	return key, nil
+}
+
+func newKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Seal 用 AES-GCM 加密，nonce 放在密文前面
+func Seal(key, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func Open(key []byte, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("密文太短了")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("解不开，密钥或口令不对")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 口令派生：盐和 scrypt 参数放在 secret.key 里，口令本身不落盘
+type passphraseKeeper struct {
+	pass string
+	path string
+}
+
+type keyFile struct {
+	KDF  string `json:"kdf"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+func (k *passphraseKeeper) Name() string {
+	return KeeperPassphrase
+}
+
+func (k *passphraseKeeper) Key() ([]byte, error) {
+	var file keyFile
+	data, err := os.ReadFile(k.path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s 坏了: %v", k.path, err)
+		}
+		if file.KDF != "scrypt" {
+			return nil, fmt.Errorf("%s 里的 kdf 不认识: %s", k.path, file.KDF)
+		}
+	case os.IsNotExist(err):
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		file = keyFile{KDF: "scrypt", Salt: salt, N: 1 << 15, R: 8, P: 1}
+		data, _ := json.MarshalIndent(file, "", "  ")
+		if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(k.path, data, 0600); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return scrypt.Key([]byte(k.pass), file.Salt, file.N, file.R, file.P, keySize)
+}
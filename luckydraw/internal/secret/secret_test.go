@@ -0,0 +1,63 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	key, _ := newKey()
+	sealed, err := Seal(key, []byte("SESSDATA=abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := Open(key, sealed)
+	if err != nil || string(plaintext) != "SESSDATA=abc" {
+		t.Fatalf("got %q, %v", plaintext, err)
+	}
+
+	other, _ := newKey()
+	if _, err := Open(other, sealed); err == nil {
+		t.Fatal("换了把 key 还能解开")
+	}
+}
+
+func TestPassphraseKeeper(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(PassphraseEnv, "hunter2")
+
+	keeper, err := Default(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keeper.Name() != KeeperPassphrase {
+		t.Fatalf("设了口令却用了 %s", keeper.Name())
+	}
+	key, err := keeper.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, keyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("secret.key 权限是 %v", info.Mode().Perm())
+	}
+
+	// 同一个口令和盐，跳过缓存也得派生出同一把
+	again, err := (&passphraseKeeper{pass: "hunter2", path: filepath.Join(dir, keyFileName)}).Key()
+	if err != nil || string(again) != string(key) {
+		t.Fatal("同一个口令派生出了不同的 key")
+	}
+	wrong, _ := (&passphraseKeeper{pass: "hunter3", path: filepath.Join(dir, keyFileName)}).Key()
+	if string(wrong) == string(key) {
+		t.Fatal("口令不同 key 却一样")
+	}
+
+	t.Setenv(PassphraseEnv, "")
+	if _, err := ByName(KeeperPassphrase, dir); err == nil {
+		t.Fatal("没设口令也拿到了口令加密的 key")
+	}
+}
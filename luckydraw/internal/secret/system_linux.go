@@ -0,0 +1,160 @@
+package secret
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Linux 上走 freedesktop 的 Secret Service（GNOME Keyring、KWallet 都实现了）
+const (
+	ssDest       = "org.freedesktop.secrets"
+	ssPath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	ssService    = "org.freedesktop.Secret.Service"
+	ssCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	ssCallTime   = 5 * time.Second
+	ssPromptTime = 2 * time.Minute
+)
+
+type ssSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+type secretService struct{}
+
+func systemKeeper(dir string) Keeper {
+	return secretService{}
+}
+
+func (secretService) Name() string {
+	return KeeperSystem
+}
+
+func (secretService) Key() ([]byte, error) {
+	// 没有会话总线就是没桌面，别让 godbus 去自动拉起一个
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, fmt.Errorf("没有 D-Bus 会话总线")
+	}
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+	svc := conn.Object(ssDest, ssPath)
+
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	if err := call(svc, ssService+".OpenSession", "plain", dbus.MakeVariant("")).Store(&output, &session); err != nil {
+		return nil, fmt.Errorf("钥匙串打不开: %v", err)
+	}
+	defer call(conn.Object(ssDest, session), "org.freedesktop.Secret.Session.Close")
+
+	attrs := map[string]string{"service": serviceName, "account": accountName}
+	var unlocked, locked []dbus.ObjectPath
+	if err := call(svc, ssService+".SearchItems", attrs).Store(&unlocked, &locked); err != nil {
+		return nil, err
+	}
+	if len(unlocked) == 0 && len(locked) > 0 {
+		if err := unlock(conn, locked[:1]); err != nil {
+			return nil, err
+		}
+		unlocked = locked[:1]
+	}
+	if len(unlocked) > 0 {
+		var secret ssSecret
+		if err := call(conn.Object(ssDest, unlocked[0]), "org.freedesktop.Secret.Item.GetSecret", session).Store(&secret); err != nil {
+			return nil, err
+		}
+		key, err := base64.StdEncoding.DecodeString(string(secret.Value))
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("钥匙串里的密钥不对")
+		}
+		return key, nil
+	}
+
+	// 第一次用，生成一把存进默认钥匙串
+	if err := unlock(conn, []dbus.ObjectPath{ssCollection}); err != nil {
+		return nil, err
+	}
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	props := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(serviceName + " 配置密钥"),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(attrs),
+	}
+	secret := ssSecret{
+		Session:     session,
+		Parameters:  []byte{},
+		Value:       []byte(base64.StdEncoding.EncodeToString(key)),
+		ContentType: "text/plain",
+	}
+	var item, prompt dbus.ObjectPath
+	if err := call(conn.Object(ssDest, ssCollection), "org.freedesktop.Secret.Collection.CreateItem", props, secret, true).Store(&item, &prompt); err != nil {
+		return nil, fmt.Errorf("密钥存不进钥匙串: %v", err)
+	}
+	if err := runPrompt(conn, prompt); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func call(obj dbus.BusObject, method string, args ...any) *dbus.Call {
+	ctx, cancel := context.WithTimeout(context.Background(), ssCallTime)
+	defer cancel()
+	return obj.CallWithContext(ctx, method, 0, args...)
+}
+
+func unlock(conn *dbus.Conn, objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := call(conn.Object(ssDest, ssPath), ssService+".Unlock", objects).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("钥匙串解不了锁: %v", err)
+	}
+	return runPrompt(conn, prompt)
+}
+
+// runPrompt 等用户在弹窗里输完密码
+func runPrompt(conn *dbus.Conn, prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == "/" {
+		return nil
+	}
+	options := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface("org.freedesktop.Secret.Prompt"),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := conn.AddMatchSignal(options...); err != nil {
+		return err
+	}
+	defer conn.RemoveMatchSignal(options...)
+	signals := make(chan *dbus.Signal, 1)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	if err := call(conn.Object(ssDest, prompt), "org.freedesktop.Secret.Prompt.Prompt", "").Err; err != nil {
+		return err
+	}
+	timeout := time.After(ssPromptTime)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != prompt || len(sig.Body) == 0 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return fmt.Errorf("钥匙串的弹窗被关掉了")
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("等钥匙串解锁等太久了")
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !windows
+
+package secret
+
+import "fmt"
+
+type noSystem struct{}
+
+func systemKeeper(dir string) Keeper {
+	return noSystem{}
+}
+
+func (noSystem) Name() string {
+	return KeeperSystem
+}
+
+func (noSystem) Key() ([]byte, error) {
+	return nil, fmt.Errorf("这个系统上没有钥匙串")
+}
@@ -0,0 +1,78 @@
+package secret
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows 用 DPAPI 把密钥绑在当前用户上，加密后的密钥放在数据目录里
+type dpapi struct {
+	path string
+}
+
+func systemKeeper(dir string) Keeper {
+	return dpapi{path: filepath.Join(dir, "secret.dpapi")}
+}
+
+func (dpapi) Name() string {
+	return KeeperSystem
+}
+
+func (k dpapi) Key() ([]byte, error) {
+	data, err := os.ReadFile(k.path)
+	if err == nil {
+		key, err := crypt(data, false)
+		if err != nil {
+			return nil, fmt.Errorf("DPAPI 解不开密钥: %v", err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("%s 里的密钥不对", k.path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	protected, err := crypt(key, true)
+	if err != nil {
+		return nil, fmt.Errorf("DPAPI 加密失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(k.path, protected, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func crypt(data []byte, protect bool) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("空的")
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	var err error
+	if protect {
+		err = windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	} else {
+		err = windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	result := make([]byte, out.Size)
+	copy(result, unsafe.Slice(out.Data, out.Size))
+	return result, nil
+}
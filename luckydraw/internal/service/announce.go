@@ -0,0 +1,186 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/event"
+	"luckydraw/internal/live"
+)
+
+// AnnounceInterval 是两条弹幕之间隔多久，发太快会被 10030 拦下来
+var AnnounceInterval = 1500 * time.Millisecond
+
+const announceRetries = 2
+
+type announcement struct {
+	client *bili.Client
+	rooms  []int
+	groups []winnerGroup
+}
+
+type winnerGroup struct {
+	label string
+	names []string
+}
+
+// AnnounceWinners 把上一次开奖的中奖名单发到连着的直播间，返回每条弹幕发没发出去
+func (s *LiveLotteryService) AnnounceWinners() (string, error) {
+	s.mu.Lock()
+	a, err := s.announcement()
+	s.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(s.announce(a))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// 配置里开了自动发，开完奖就在后台慢慢发，不卡着开奖。调用方持锁
+func (s *LiveLotteryService) announceInBackground() {
+	a, err := s.announcement()
+	if err == nil && s.stopping > 0 {
+		err = fmt.Errorf("正在停下，不发了")
+	}
+	if err != nil {
+		s.emitAnnouncement(event.Announcement{Error: err.Error()})
+		return
+	}
+	s.announcing.Add(1)
+	go func() {
+		defer s.announcing.Done()
+		s.announce(a)
+	}()
+}
+
+// 调用方持锁
+func (s *LiveLotteryService) announcement() (*announcement, error) {
+	if s.lastDraw == nil {
+		return nil, fmt.Errorf("还没开奖呢")
+	}
+	if s.client == nil || s.liveLottery == nil {
+		return nil, fmt.Errorf("要用登录的号连着直播间才能发弹幕")
+	}
+	groups := winnerGroups(s.lastDraw)
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("没有人中奖，不用发了")
+	}
+
+	var rooms []int
+	for _, st := range s.liveLottery.RoomStatuses() {
+		room := st.RealRoomID
+		if room == 0 {
+			room = st.RoomID
+		}
+		rooms = append(rooms, room)
+	}
+	return &announcement{client: s.client, rooms: rooms, groups: groups}, nil
+}
+
+func winnerGroups(draw *live.DrawResult) []winnerGroup {
+	var groups []winnerGroup
+	add := func(label string, winners []*live.DanmakuUser) {
+		if len(winners) == 0 {
+			return
+		}
+		g := winnerGroup{label: label}
+		for _, w := range winners {
+			g.names = append(g.names, w.Username)
+		}
+		groups = append(groups, g)
+	}
+	if len(draw.Tiers) == 0 {
+		add("中奖", draw.Winners)
+	}
+	for _, t := range draw.Tiers {
+		add(t.Name, t.Winners)
+	}
+	return groups
+}
+
+// announce 不碰 s.mu，一条一条发，每条的结果都发个事件
+func (s *LiveLotteryService) announce(a *announcement) []event.Announcement {
+	var results []event.Announcement
+	for _, room := range a.rooms {
+		messages := announceMessages(a.groups, a.client.DanmakuLimit(room))
+		for i, msg := range messages {
+			if len(results) > 0 {
+				time.Sleep(AnnounceInterval)
+			}
+			result := event.Announcement{RoomID: room, Message: msg, Index: i + 1, Total: len(messages), OK: true}
+			if err := sendDanmaku(a.client, room, msg); err != nil {
+				result.OK, result.Error = false, err.Error()
+			}
+			s.emitAnnouncement(result)
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func (s *LiveLotteryService) emitAnnouncement(result event.Announcement) {
+	if s.emitter != nil {
+		s.emitter.Emit(event.LiveAnnounce, result)
+	}
+}
+
+// sendDanmaku 被说发太快就多等一会儿再试
+func sendDanmaku(client *bili.Client, room int, msg string) error {
+	var apiErr *bili.APIError
+	for attempt := 0; ; attempt++ {
+		err := client.SendDanmaku(room, msg)
+		if err == nil || attempt == announceRetries || !errors.As(err, &apiErr) || apiErr.Code != bili.CodeSendTooFast {
+			return err
+		}
+		time.Sleep(AnnounceInterval * time.Duration(attempt+2))
+	}
+}
+
+// announceMessages 每组以「一等奖：」开头，名字用空格隔开，一条塞不下就另起一条再带上标题；
+// 连标题都带不上的长名字就单独发，再长就截掉
+func announceMessages(groups []winnerGroup, limit int) []string {
+	var messages []string
+	for _, g := range groups {
+		header := g.label + "："
+		current := ""
+		for _, name := range g.names {
+			candidate := header + name
+			if current != "" {
+				candidate = current + " " + name
+			}
+			if utf8.RuneCountInString(candidate) <= limit {
+				current = candidate
+				continue
+			}
+			if current != "" {
+				messages = append(messages, current)
+			}
+			current = header + name
+			if utf8.RuneCountInString(current) > limit {
+				// 单独发掉，后面的名字重新带上标题
+				messages = append(messages, truncateRunes(name, limit))
+				current = ""
+			}
+		}
+		if current != "" {
+			messages = append(messages, current)
+		}
+	}
+	return messages
+}
+
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:limit]))
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/event"
+	"luckydraw/internal/live/livetest"
+)
+
+func TestAnnounceMessagesSplitAtLimit(t *testing.T) {
+	groups := []winnerGroup{
+		{label: "一等奖", names: []string{"alice"}},
+		{label: "二等奖", names: []string{"bob", "carol", "dave", "一个名字特别特别长的用户呀"}},
+	}
+	got := announceMessages(groups, 20)
+	want := []string{
+		"一等奖：alice",
+		"二等奖：bob carol dave",
+		"二等奖：一个名字特别特别长的用户呀",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("messages = %q, want %q", got, want)
+	}
+
+	got = announceMessages(groups, 10)
+	for _, msg := range got {
+		if utf8.RuneCountInString(msg) > 10 {
+			t.Fatalf("%q is over the limit", msg)
+		}
+	}
+	// 截断的长名字后面的人还要带标题
+	long := []winnerGroup{{label: "一等奖", names: []string{"一个名字特别特别长的用户呀", "bob"}}}
+	if got := announceMessages(long, 10); strings.Join(got, "|") != "一个名字特别特别长的|一等奖：bob" {
+		t.Fatalf("messages = %q", got)
+	}
+	if len(announceMessages(groups, 40)) != 2 {
+		t.Fatalf("messages = %q, want one per prize", announceMessages(groups, 40))
+	}
+}
+
+func TestAnnounceWinnersSendsDanmaku(t *testing.T) {
+	srv := livetest.NewServer(livetest.Room{RoomID: 21452505, ShortID: 1, UID: 1, Title: "test"})
+	defer srv.Close()
+	defer srv.Install()()
+
+	old := AnnounceInterval
+	AnnounceInterval = 10 * time.Millisecond
+	defer func() { AnnounceInterval = old }()
+
+	events := &eventLog{}
+	profiles := newTestProfileService(t)
+	client := bili.NewClient("DedeUserID=42; buvid3=abc; bili_jct=csrf")
+	s := NewLiveLotteryService(events, func(int64) (*bili.Client, error) { return client, nil }, profiles)
+	if err := s.ConnectLiveRooms([]int{1}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	if _, err := s.AnnounceWinners(); err == nil {
+		t.Fatal("announcing before a draw should fail")
+	}
+
+	profile := *profiles.ActiveProfile()
+	if err := s.StartLiveLottery("抽我", profile); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for uid := int64(1); uid <= 6; uid++ {
+		srv.Send(livetest.Danmaku(uid, fmt.Sprintf("观众%d号", uid), "抽我"))
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && s.GetParticipantCount() < 6 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := s.DrawWinners(6); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SendTooFast(1)
+	raw, err := s.AnnounceWinners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []event.Announcement
+	json.Unmarshal([]byte(raw), &results)
+	sent := srv.SentDanmaku()
+	if len(results) != 2 || len(sent) != 2 {
+		t.Fatalf("results = %+v, sent = %+v", results, sent)
+	}
+	for i, r := range results {
+		if !r.OK || r.RoomID != 21452505 || r.Index != i+1 || r.Total != 2 || sent[i].Message != r.Message {
+			t.Fatalf("result %d = %+v, sent %+v", i, r, sent[i])
+		}
+	}
+	if events.count(event.LiveAnnounce) != 2 {
+		t.Fatalf("announce events = %d", events.count(event.LiveAnnounce))
+	}
+}
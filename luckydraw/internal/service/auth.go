@@ -2,7 +2,9 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -13,37 +15,225 @@ import (
 
 type AuthService struct {
 	mu         sync.Mutex
-	client     *bili.Client
+	clients    map[int64]*bili.Client
 	config     *config.Config
 	configPath string
+	// 扫码成功时带回来的 refresh_token，等前端拿同一个 Cookie 来 LoginWithQRCode 时存下
+	qrCookie  string
+	qrRefresh string
+	checking  sync.WaitGroup
 }
 
+// NewAuthService 先拿存着的 Cookie 把号都登上，问 B 站还好不好使放到后台去，别卡着启动
 func NewAuthService(cfg *config.Config, configPath string) *AuthService {
-	s := &AuthService{config: cfg, configPath: configPath}
+	s := &AuthService{config: cfg, configPath: configPath, clients: make(map[int64]*bili.Client)}
 	if cfg.Cookie != "" {
-		s.autoLogin(cfg.Cookie)
+		s.clients[0] = bili.NewClient(cfg.Cookie)
 	}
+	for _, account := range cfg.Accounts {
+		if account.Cookie != "" {
+			s.clients[account.UID] = bili.NewClient(account.Cookie)
+		}
+	}
+	s.checking.Add(1)
+	go s.checkAccounts()
 	return s
 }
 
-func (s *AuthService) autoLogin(cookie string) {
-	if cookie == "" {
+// Wait 等启动时那遍检查做完
+func (s *AuthService) Wait() {
+	s.checking.Wait()
+}
+
+func (s *AuthService) checkAccounts() {
+	defer s.checking.Done()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.migrateLegacyCookie()
+	uids := make([]int64, 0, len(s.config.Accounts))
+	for _, account := range s.config.Accounts {
+		uids = append(uids, account.UID)
+	}
+	for _, uid := range uids {
+		s.autoLogin(uid)
+	}
+}
+
+// 老版本只存了一个 Cookie：UID 先从 DedeUserID 里拿，拿不到就问 myinfo。
+// UID 是 0 在别处表示「当前账号」，所以问不出来的时候不存号，老字段留着下次启动再迁
+func (s *AuthService) migrateLegacyCookie() {
+	if s.config.Cookie == "" {
 		return
 	}
-	s.client = bili.NewClient(cookie)
-	if info, err := s.client.GetMyInfo(); err != nil {
-		s.config.Cookie = ""
+	client := s.clients[0]
+	if client == nil {
+		client = bili.NewClient(s.config.Cookie)
+	}
+	uid, _ := strconv.ParseInt(client.CookieValue("DedeUserID"), 10, 64)
+	if uid == 0 {
+		info, err := client.GetMyInfo()
+		var apiErr *bili.APIError
+		switch {
+		case err == nil:
+			uid = info.Mid
+		case errors.As(err, &apiErr) && apiErr.Code == bili.CodeNotLoggedIn:
+			// 过期了先换一套新的，换不来这个 Cookie 就没用了
+			cookie, token, err := login.NewCookieRefresher(client).Refresh(s.config.RefreshToken)
+			if err == nil {
+				info, err = client.GetMyInfo()
+			}
+			if err != nil {
+				s.config.Cookie = ""
+				s.config.RefreshToken = ""
+				delete(s.clients, 0)
+				config.SaveConfig(s.configPath, s.config)
+				return
+			}
+			uid = info.Mid
+			s.config.Cookie, s.config.RefreshToken = cookie, token
+		default:
+			// 断网之类的：这次先拿老 Cookie 当当前账号用着，不落盘
+			s.clients[0] = client
+			return
+		}
+	}
+
+	if s.config.Account(uid) == nil {
+		s.config.Accounts = append(s.config.Accounts, config.Account{UID: uid})
+	}
+	account := s.config.Account(uid)
+	account.Cookie = s.config.Cookie
+	account.RefreshToken = s.config.RefreshToken
+	s.config.ActiveAccount = uid
+	s.config.Cookie = ""
+	s.config.RefreshToken = ""
+	delete(s.clients, 0)
+	s.clients[uid] = client
+	config.SaveConfig(s.configPath, s.config)
+}
+
+func (s *AuthService) autoLogin(uid int64) {
+	account := s.config.Account(uid)
+	if account == nil || account.Cookie == "" {
+		return
+	}
+	client := s.clients[uid]
+	if client == nil {
+		client = bili.NewClient(account.Cookie)
+		s.clients[uid] = client
+	}
+	info, err := client.GetMyInfo()
+	var apiErr *bili.APIError
+	switch {
+	case err == nil:
+		uid = s.remember(uid, info)
 		config.SaveConfig(s.configPath, s.config)
-		s.client = nil
-	} else {
-		_ = info
+		// 还能用也问问要不要换，能换就顺手换了
+		if need, err := login.NewCookieRefresher(client).NeedsRefresh(); err == nil && need {
+			s.refresh(uid)
+		}
+	case errors.As(err, &apiErr) && apiErr.Code == bili.CodeNotLoggedIn:
+		if s.refresh(uid) != nil {
+			// 号留着，只是要重新登录
+			account.Cookie = ""
+			account.RefreshToken = ""
+			delete(s.clients, uid)
+			config.SaveConfig(s.configPath, s.config)
+		}
+	default:
+		// 断网之类的先留着，别把还能用的 Cookie 删了
 	}
 }
 
+// remember 用 myinfo 更新名字和头像；迁移来的号 UID 还不知道的话顺便补上，返回真正的 UID。调用方负责保存
+func (s *AuthService) remember(uid int64, info *bili.UserInfo) int64 {
+	if uid != info.Mid {
+		if s.config.Account(info.Mid) != nil {
+			s.removeAccount(info.Mid)
+		}
+		s.config.Account(uid).UID = info.Mid
+		s.clients[info.Mid] = s.clients[uid]
+		delete(s.clients, uid)
+		if s.config.ActiveAccount == uid {
+			s.config.ActiveAccount = info.Mid
+		}
+	}
+	account := s.config.Account(info.Mid)
+	account.Name = info.Name
+	account.Face = info.Face
+	return info.Mid
+}
+
+// refresh 用存着的 refresh_token 给这个号换一套新 Cookie，调用方持锁
+func (s *AuthService) refresh(uid int64) error {
+	account := s.config.Account(uid)
+	if account == nil {
+		return fmt.Errorf("没有这个账号喵")
+	}
+	// 就在原来的 Client 上换，直播那边拿着的也跟着换成新的
+	client := s.clients[uid]
+	if client == nil {
+		client = bili.NewClient(account.Cookie)
+	}
+	cookie, token, err := login.NewCookieRefresher(client).Refresh(account.RefreshToken)
+	if err != nil {
+		return err
+	}
+	s.clients[uid] = client
+	account.Cookie = cookie
+	account.RefreshToken = token
+	info, err := client.GetMyInfo()
+	if err != nil {
+		// 旧的已经作废了，新的好不好使都先记下来
+		config.SaveConfig(s.configPath, s.config)
+		return fmt.Errorf("换来的 Cookie 也不好使: %v", err)
+	}
+	s.remember(uid, info)
+	return config.SaveConfig(s.configPath, s.config)
+}
+
+func (s *AuthService) RefreshCookie() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.config.Account(s.config.ActiveAccount)
+	if account == nil || account.Cookie == "" {
+		return "", fmt.Errorf("Login First！")
+	}
+	if err := s.refresh(account.UID); err != nil {
+		return "", fmt.Errorf("续不上了喵: %v", err)
+	}
+	return "续上了，下次不用扫码", nil
+}
+
+// Client 是当前账号的
 func (s *AuthService) Client() *bili.Client {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.client
+	return s.clients[s.config.ActiveAccount]
+}
+
+// ClientFor 给配置绑定的号用，uid 是 0 就用当前账号
+func (s *AuthService) ClientFor(uid int64) (*bili.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if uid == 0 {
+		if client := s.clients[s.config.ActiveAccount]; client != nil {
+			return client, nil
+		}
+		return nil, fmt.Errorf("Login First")
+	}
+	account := s.config.Account(uid)
+	if account == nil {
+		return nil, fmt.Errorf("绑定的账号 %d 已经不在了", uid)
+	}
+	client := s.clients[uid]
+	if client == nil {
+		return nil, fmt.Errorf("%s 的登录失效了，重新登录一下吧", account.Name)
+	}
+	return client, nil
 }
 
 func (s *AuthService) Login(cookie string) (string, error) {
@@ -55,16 +245,49 @@ func (s *AuthService) Login(cookie string) (string, error) {
 		return "", fmt.Errorf("Cookie是空的！")
 	}
 
-	s.client = bili.NewClient(cookie)
-	info, err := s.client.GetMyInfo()
+	client := bili.NewClient(cookie)
+	info, err := client.GetMyInfo()
 	if err != nil {
 		return "", fmt.Errorf("雜魚: %v", err)
 	}
 
-	s.config.Cookie = cookie
-	config.SaveConfig(s.configPath, s.config)
+	msg := fmt.Sprintf("这号是你吗: %s (UID: %d)", info.Name, info.Mid)
+	if err := s.addAccount(client, info, ""); err != nil {
+		msg += fmt.Sprintf("（不过%v）", err)
+	}
+	return msg, nil
+}
+
+// addAccount 登录成功后记下这个号并切过去，已经存过的就覆盖
+func (s *AuthService) addAccount(client *bili.Client, info *bili.UserInfo, refreshToken string) error {
+	account := s.config.Account(info.Mid)
+	if account == nil {
+		s.config.Accounts = append(s.config.Accounts, config.Account{UID: info.Mid})
+		account = &s.config.Accounts[len(s.config.Accounts)-1]
+	}
+	account.Name = info.Name
+	account.Face = info.Face
+	account.Cookie = client.GetCookie()
+	account.RefreshToken = refreshToken
+	// 重新登录已有的号时沿用原来的 Client，别处拿着的不会还是旧 Cookie
+	if old := s.clients[info.Mid]; old != nil {
+		old.SetCookie(account.Cookie)
+		client = old
+	}
+	s.clients[info.Mid] = client
+	s.config.ActiveAccount = info.Mid
+	return config.SaveConfig(s.configPath, s.config)
+}
 
-	return fmt.Sprintf("这号是你吗: %s (UID: %d)", info.Name, info.Mid), nil
+func (s *AuthService) removeAccount(uid int64) {
+	accounts := make([]config.Account, 0, len(s.config.Accounts))
+	for _, account := range s.config.Accounts {
+		if account.UID != uid {
+			accounts = append(accounts, account)
+		}
+	}
+	s.config.Accounts = accounts
+	delete(s.clients, uid)
 }
 
 func (s *AuthService) GetQRCode() (string, error) {
@@ -88,6 +311,12 @@ func (s *AuthService) CheckQRCodeStatus(qrcodeKey string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("验牌失败了: %v", err)
 	}
+	if status.Code == 0 && status.Data.Code == 0 {
+		s.mu.Lock()
+		s.qrCookie = status.Cookie
+		s.qrRefresh = status.Data.RefreshToken
+		s.mu.Unlock()
+	}
 
 	result := map[string]interface{}{
 		"code":    status.Code,
@@ -107,29 +336,30 @@ func (s *AuthService) LoginWithQRCode(cookie string) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.client = bili.NewClient(cookie)
-	info, err := s.client.GetMyInfo()
+	client := bili.NewClient(cookie)
+	info, err := client.GetMyInfo()
 	if err != nil {
 		return "", fmt.Errorf("登陆失效了喵: %v", err)
 	}
 
-	s.config.Cookie = cookie
-	config.SaveConfig(s.configPath, s.config)
-
-	return fmt.Sprintf("这号是你吗: %s (UID: %d)", info.Name, info.Mid), nil
+	refreshToken := ""
+	if cookie == s.qrCookie {
+		refreshToken = s.qrRefresh
+	}
+	s.qrCookie, s.qrRefresh = "", ""
+	msg := fmt.Sprintf("这号是你吗: %s (UID: %d)", info.Name, info.Mid)
+	if err := s.addAccount(client, info, refreshToken); err != nil {
+		msg += fmt.Sprintf("（不过%v）", err)
+	}
+	return msg, nil
 }
 
 func (s *AuthService) IsLoggedIn() bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.client != nil
+	return s.Client() != nil
 }
 
 func (s *AuthService) GetAccountInfo() (string, error) {
-	s.mu.Lock()
-	client := s.client
-	s.mu.Unlock()
-
+	client := s.Client()
 	if client == nil {
 		return "", fmt.Errorf("Login First！")
 	}
@@ -148,11 +378,82 @@ func (s *AuthService) GetAccountInfo() (string, error) {
 	return string(data), nil
 }
 
+// Logout 退出当前账号，还有别的号就切过去
 func (s *AuthService) Logout() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.deleteAccount(s.config.ActiveAccount)
+	return config.SaveConfig(s.configPath, s.config)
+}
+
+func (s *AuthService) GetAccounts() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	s.client = nil
-	s.config.Cookie = ""
+	accounts := make([]map[string]interface{}, 0, len(s.config.Accounts))
+	for _, account := range s.config.Accounts {
+		accounts = append(accounts, map[string]interface{}{
+			"uid":       account.UID,
+			"name":      account.Name,
+			"face":      account.Face,
+			"logged_in": s.clients[account.UID] != nil,
+		})
+	}
+	result := map[string]interface{}{
+		"accounts":       accounts,
+		"active_account": s.config.ActiveAccount,
+	}
+	data, _ := json.Marshal(result)
+	return string(data), nil
+}
+
+func (s *AuthService) SwitchAccount(uid int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.config.Account(uid)
+	if account == nil {
+		return "", fmt.Errorf("没有这个账号喵")
+	}
+	if s.clients[uid] == nil {
+		return "", fmt.Errorf("%s 的登录失效了，重新登录一下吧", account.Name)
+	}
+	s.config.ActiveAccount = uid
+	if err := config.SaveConfig(s.configPath, s.config); err != nil {
+		return "", err
+	}
+
+	result := map[string]interface{}{
+		"name": account.Name,
+		"uid":  account.UID,
+		"face": account.Face,
+	}
+	data, _ := json.Marshal(result)
+	return string(data), nil
+}
+
+func (s *AuthService) RemoveAccount(uid int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.Account(uid) == nil {
+		return fmt.Errorf("没有这个账号喵")
+	}
+	s.deleteAccount(uid)
 	return config.SaveConfig(s.configPath, s.config)
 }
+
+// deleteAccount 删掉的是当前账号的话，换成第一个还能用的
+func (s *AuthService) deleteAccount(uid int64) {
+	s.removeAccount(uid)
+	if s.config.ActiveAccount != uid {
+		return
+	}
+	s.config.ActiveAccount = 0
+	for _, account := range s.config.Accounts {
+		if s.clients[account.UID] != nil {
+			s.config.ActiveAccount = account.UID
+			return
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
+)
+
+// 假的 B 站：只认 SESSDATA=new（alice）和 SESSDATA=bob，拿 good-token 能把 old 换成 new
+func fakeAccountServer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/x/space/myinfo", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Cookie"), "SESSDATA=bob") {
+			fmt.Fprint(w, `{"code":0,"data":{"mid":7,"name":"bob"}}`)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Cookie"), "SESSDATA=new") {
+			fmt.Fprint(w, `{"code":-101,"message":"账号未登录"}`)
+			return
+		}
+		fmt.Fprint(w, `{"code":0,"data":{"mid":42,"name":"alice"}}`)
+	})
+	mux.HandleFunc("/x/passport-login/web/cookie/info", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":0,"data":{"refresh":false}}`)
+	})
+	mux.HandleFunc("/correspond/1/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<div id="1-name">page-csrf</div>`)
+	})
+	mux.HandleFunc("/x/passport-login/web/cookie/refresh", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("refresh_token") != "good-token" {
+			fmt.Fprint(w, `{"code":86095,"message":"refresh_token 错误"}`)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "SESSDATA", Value: "new"})
+		fmt.Fprint(w, `{"code":0,"data":{"refresh_token":"next-token"}}`)
+	})
+	mux.HandleFunc("/x/passport-login/web/confirm/refresh", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":0}`)
+	})
+	srv := httptest.NewServer(mux)
+
+	oldAPI, oldPassport, oldWWW := bili.APIBaseURL, bili.PassportBaseURL, bili.WWWBaseURL
+	bili.APIBaseURL, bili.PassportBaseURL, bili.WWWBaseURL = srv.URL, srv.URL, srv.URL
+	t.Cleanup(func() {
+		bili.APIBaseURL, bili.PassportBaseURL, bili.WWWBaseURL = oldAPI, oldPassport, oldWWW
+		srv.Close()
+	})
+}
+
+func TestAutoLoginRefreshesExpiredCookie(t *testing.T) {
+	fakeAccountServer(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	s := NewAuthService(&config.Config{Cookie: "SESSDATA=old; buvid3=keep", RefreshToken: "good-token"}, path)
+	s.Wait()
+	if !s.IsLoggedIn() {
+		t.Fatal("expired cookie was not refreshed")
+	}
+	saved, _ := config.LoadConfig(path)
+	account := saved.Account(42)
+	if saved.Cookie != "" || account == nil || saved.ActiveAccount != 42 {
+		t.Fatalf("saved config = %+v", saved)
+	}
+	if account.Cookie != "SESSDATA=new; buvid3=keep" || account.RefreshToken != "next-token" || account.Name != "alice" {
+		t.Fatalf("saved account = %+v", account)
+	}
+}
+
+func TestRefreshKeepsClient(t *testing.T) {
+	fakeAccountServer(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	s := NewAuthService(&config.Config{
+		Accounts:      []config.Account{{UID: 42, Cookie: "SESSDATA=new", RefreshToken: "good-token"}},
+		ActiveAccount: 42,
+	}, path)
+	s.Wait()
+	// 直播那边早就拿走了这个 Client，续完 Cookie 它得跟着换
+	client := s.Client()
+	if _, err := s.RefreshCookie(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Client() != client {
+		t.Fatal("refresh replaced the client other services hold")
+	}
+	if account := mustLoadConfig(t, path).Account(42); account == nil || account.RefreshToken != "next-token" {
+		t.Fatalf("saved account = %+v", account)
+	}
+}
+
+func TestAutoLoginDropsCookieWhenRefreshFails(t *testing.T) {
+	fakeAccountServer(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	s := NewAuthService(&config.Config{Cookie: "SESSDATA=old", RefreshToken: "stale-token"}, path)
+	s.Wait()
+	if s.IsLoggedIn() {
+		t.Fatal("still logged in with a dead cookie")
+	}
+	// 死掉的老 Cookie 问不出 UID，不能存一个 UID 是 0 的号
+	saved, _ := config.LoadConfig(path)
+	if saved.Cookie != "" || saved.RefreshToken != "" || len(saved.Accounts) != 0 || saved.ActiveAccount != 0 {
+		t.Fatalf("saved config = %+v", saved)
+	}
+}
+
+func TestAutoLoginKeepsCookieWhenOffline(t *testing.T) {
+	old := bili.APIBaseURL
+	bili.APIBaseURL = "http://127.0.0.1:1"
+	defer func() { bili.APIBaseURL = old }()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	s := NewAuthService(&config.Config{Cookie: "SESSDATA=old"}, path)
+	s.Wait()
+	if !s.IsLoggedIn() {
+		t.Fatal("cookie dropped because the network was down")
+	}
+	// UID 还不知道，老 Cookie 原样留着等下次迁
+	s.mu.Lock()
+	config.SaveConfig(path, s.config)
+	s.mu.Unlock()
+	saved := mustLoadConfig(t, path)
+	if saved.Cookie != "SESSDATA=old" || len(saved.Accounts) != 0 {
+		t.Fatalf("saved config = %+v", saved)
+	}
+}
+
+func TestNewAuthServiceDoesNotWaitForNetwork(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"code":0,"data":{"mid":42,"name":"alice"}}`)
+	}))
+	defer srv.Close()
+	old := bili.APIBaseURL
+	bili.APIBaseURL = srv.URL
+	defer func() { bili.APIBaseURL = old }()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	done := make(chan *AuthService, 1)
+	go func() {
+		done <- NewAuthService(&config.Config{
+			Accounts:      []config.Account{{UID: 42, Cookie: "SESSDATA=new"}},
+			ActiveAccount: 42,
+		}, path)
+	}()
+	var s *AuthService
+	select {
+	case s = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewAuthService waited for myinfo")
+	}
+	close(release)
+	s.Wait()
+	if client, err := s.ClientFor(42); err != nil || client.GetCookie() != "SESSDATA=new" {
+		t.Fatalf("ClientFor(42) = %v", err)
+	}
+}
+
+func TestMultipleAccounts(t *testing.T) {
+	fakeAccountServer(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	s := NewAuthService(&config.Config{}, path)
+	if _, err := s.Login("SESSDATA=new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Login("SESSDATA=bob"); err != nil {
+		t.Fatal(err)
+	}
+	if client := s.Client(); client == nil || client.GetCookie() != "SESSDATA=bob" {
+		t.Fatal("后登的号没有变成当前账号")
+	}
+
+	if _, err := s.SwitchAccount(42); err != nil {
+		t.Fatal(err)
+	}
+	if client, err := s.ClientFor(0); err != nil || client.GetCookie() != "SESSDATA=new" {
+		t.Fatalf("当前账号不对: %v", err)
+	}
+	if client, err := s.ClientFor(7); err != nil || client.GetCookie() != "SESSDATA=bob" {
+		t.Fatalf("绑定的号拿不到: %v", err)
+	}
+	if _, err := s.ClientFor(99); err == nil {
+		t.Fatal("没存过的号也给了客户端")
+	}
+
+	// 重启以后两个号都在，当前账号也记得
+	s = NewAuthService(mustLoadConfig(t, path), path)
+	s.Wait()
+	raw, _ := s.GetAccounts()
+	if !strings.Contains(raw, `"active_account":42`) || !strings.Contains(raw, `"name":"bob"`) || strings.Contains(raw, "SESSDATA") {
+		t.Fatalf("accounts = %s", raw)
+	}
+
+	if err := s.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if client := s.Client(); client == nil || client.GetCookie() != "SESSDATA=bob" {
+		t.Fatal("退出当前账号后没有切到剩下的号")
+	}
+	if saved := mustLoadConfig(t, path); len(saved.Accounts) != 1 || saved.ActiveAccount != 7 {
+		t.Fatalf("saved config = %+v", saved)
+	}
+}
+
+func TestLegacyCookieGetsUIDFromMyInfo(t *testing.T) {
+	fakeAccountServer(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	// 手动粘的 Cookie 没有 DedeUserID，UID 要靠 myinfo 补
+	s := NewAuthService(&config.Config{Cookie: "SESSDATA=new"}, path)
+	s.Wait()
+	if _, err := s.ClientFor(42); err != nil {
+		t.Fatal(err)
+	}
+	saved := mustLoadConfig(t, path)
+	if len(saved.Accounts) != 1 || saved.Accounts[0].UID != 42 || saved.ActiveAccount != 42 {
+		t.Fatalf("saved config = %+v", saved)
+	}
+}
+
+func mustLoadConfig(t *testing.T, path string) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"luckydraw/internal/config"
+)
+
+func (s *ProfileService) SaveExclusionPolicy(policy config.ExclusionPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	if policy.LastDraws < 0 || policy.LastDays < 0 {
+		return fmt.Errorf("排除范围不能是负数喵")
+	}
+	for _, id := range policy.Profiles {
+		if s.findProfile(id) == nil {
+			return fmt.Errorf("没有这个配置喵: %s", id)
+		}
+	}
+	profile.Exclusion = policy
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+func (s *ProfileService) ExcludedUIDs(profileID string) map[int64]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	excluded := make(map[int64]string)
+	profile := s.findProfile(profileID)
+	if profile == nil {
+		return excluded
+	}
+	policy := profile.Exclusion
+
+	exclude := func(records []config.HistoryRecord, why func(config.HistoryRecord) string) {
+		for _, r := range records {
+			for _, w := range r.Winners {
+				// 放弃了的人不算中过奖
+				if w.Forfeited {
+					continue
+				}
+				if _, ok := excluded[w.UID]; !ok {
+					excluded[w.UID] = why(r)
+				}
+			}
+		}
+	}
+
+	history := profile.History
+	if policy.LastDraws > 0 {
+		start := len(history) - policy.LastDraws
+		if start < 0 {
+			start = 0
+		}
+		exclude(history[start:], func(r config.HistoryRecord) string {
+			return fmt.Sprintf("最近 %d 次抽奖中过奖（%s）", policy.LastDraws, r.Time.Format("01-02 15:04"))
+		})
+	}
+	if policy.LastDays > 0 {
+		since := time.Now().AddDate(0, 0, -policy.LastDays)
+		var recent []config.HistoryRecord
+		for _, r := range history {
+			if r.Time.After(since) {
+				recent = append(recent, r)
+			}
+		}
+		exclude(recent, func(r config.HistoryRecord) string {
+			return fmt.Sprintf("%d 天内中过奖（%s）", policy.LastDays, r.Time.Format("01-02 15:04"))
+		})
+	}
+	for _, id := range policy.Profiles {
+		other := s.findProfile(id)
+		if other == nil {
+			continue
+		}
+		exclude(other.History, func(r config.HistoryRecord) string {
+			return fmt.Sprintf("在「%s」中过奖（%s）", other.Name, r.Time.Format("2006-01-02"))
+		})
+	}
+
+	for _, uid := range policy.Whitelist {
+		delete(excluded, uid)
+	}
+	for _, uid := range policy.Blacklist {
+		excluded[uid] = "在黑名单里"
+	}
+	return excluded
+}
+
+func (s *ProfileService) GetExcludedUsers(profileID string) (string, error) {
+	data, err := json.Marshal(s.ExcludedUIDs(profileID))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *ProfileService) findProfile(id string) *config.ProfileConfig {
+	for i := range s.state.Profiles {
+		if s.state.Profiles[i].ID == id {
+			return &s.state.Profiles[i]
+		}
+	}
+	return nil
+}
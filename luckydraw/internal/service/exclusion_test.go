@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"luckydraw/internal/config"
+)
+
+func TestExcludedUIDs(t *testing.T) {
+	s := newTestProfileService(t)
+	main := s.ActiveProfile().ID
+
+	if _, err := s.CreateProfile("other"); err != nil {
+		t.Fatal(err)
+	}
+	otherID := s.ActiveProfile().ID
+	if _, err := s.AddHistory(otherID, config.HistoryRecord{Winners: []config.HistoryWinner{{UID: 9}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SwitchProfile(main); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uid := range []int64{1, 2, 3} {
+		if _, err := s.AddHistory(main, config.HistoryRecord{Winners: []config.HistoryWinner{{UID: uid}}}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.SaveExclusionPolicy(config.ExclusionPolicy{
+		LastDraws: 2,
+		Profiles:  []string{otherID},
+		Blacklist: []int64{42},
+		Whitelist: []int64{3},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	excluded := s.ExcludedUIDs(main)
+	for _, uid := range []int64{2, 9, 42} {
+		if _, ok := excluded[uid]; !ok {
+			t.Errorf("uid %d should be excluded", uid)
+		}
+	}
+	for _, uid := range []int64{1, 3} {
+		if why, ok := excluded[uid]; ok {
+			t.Errorf("uid %d excluded: %s", uid, why)
+		}
+	}
+}
+
+func TestExcludedUIDsSkipsForfeited(t *testing.T) {
+	profiles := newTestProfileService(t)
+	s := NewLiveLotteryService(nil, nil, profiles)
+	profileID := profiles.ActiveProfile().ID
+	historyID, winners := addDrawnHistory(t, profiles, []int64{1, 2, 3, 4, 5, 6}, 2)
+
+	raw, err := s.RedrawWinner(historyID, winners[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replacement config.HistoryWinner
+	json.Unmarshal([]byte(raw), &replacement)
+
+	if err := profiles.SaveExclusionPolicy(config.ExclusionPolicy{LastDraws: 1}); err != nil {
+		t.Fatal(err)
+	}
+	excluded := profiles.ExcludedUIDs(profileID)
+	if why, ok := excluded[winners[0]]; ok {
+		t.Errorf("forfeited uid %d excluded: %s", winners[0], why)
+	}
+	for _, uid := range []int64{winners[1], replacement.UID} {
+		if _, ok := excluded[uid]; !ok {
+			t.Errorf("uid %d should be excluded", uid)
+		}
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"luckydraw/internal/config"
+	"luckydraw/internal/live"
 )
 
-func (s *ProfileService) AddHistory(profileID string, keyword string, winnerCount int, winners []config.HistoryWinner) error {
+func (s *ProfileService) AddHistory(profileID string, record config.HistoryRecord, participants []config.Participant) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -18,17 +21,24 @@ func (s *ProfileService) AddHistory(profileID string, keyword string, winnerCoun
 		if s.state.Profiles[i].ID != profileID {
 			continue
 		}
-		record := config.HistoryRecord{
-			ID:          fmt.Sprintf("hs_%d", time.Now().UnixNano()),
-			Keyword:     keyword,
-			WinnerCount: winnerCount,
-			Time:        time.Now(),
-			Winners:     winners,
+		record.ID = fmt.Sprintf("hs_%d", time.Now().UnixNano())
+		record.Time = time.Now()
+		if participants != nil {
+			record.SnapshotFile = record.ID + ".json"
+			record.ParticipantCount = len(participants)
+			snap := &config.ParticipantSnapshot{
+				HistoryID:    record.ID,
+				Time:         record.Time,
+				Participants: participants,
+			}
+			if err := config.SaveSnapshot(s.snapshotPath(record.SnapshotFile), snap); err != nil {
+				return "", fmt.Errorf("参与名单没存下来: %v", err)
+			}
 		}
 		s.state.Profiles[i].History = append(s.state.Profiles[i].History, record)
-		return config.SaveRuntimeState(s.statePath, s.state)
+		return record.ID, config.SaveRuntimeState(s.statePath, s.state)
 	}
-	return fmt.Errorf("没有这个配置喵")
+	return "", fmt.Errorf("没有这个配置喵")
 }
 
 func (s *ProfileService) GetHistory(profileID string) (string, error) {
@@ -58,6 +68,7 @@ func (s *ProfileService) DeleteHistory(profileID, historyID string) error {
 		hist := s.state.Profiles[i].History
 		for j, h := range hist {
 			if h.ID == historyID {
+				s.removeSnapshot(h)
 				s.state.Profiles[i].History = append(hist[:j], hist[j+1:]...)
 				return config.SaveRuntimeState(s.statePath, s.state)
 			}
@@ -75,6 +86,9 @@ func (s *ProfileService) DeleteAllHistory(profileID string) error {
 		if s.state.Profiles[i].ID != profileID {
 			continue
 		}
+		for _, h := range s.state.Profiles[i].History {
+			s.removeSnapshot(h)
+		}
 		s.state.Profiles[i].History = nil
 		return config.SaveRuntimeState(s.statePath, s.state)
 	}
@@ -112,6 +126,189 @@ func (s *ProfileService) ExportHistory(profileID, historyID, path string) (strin
 	return path, nil
 }
 
+func (s *ProfileService) GetHistorySnapshot(profileID, historyID string) (string, error) {
+	snap, _, err := s.loadSnapshot(profileID, historyID)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *ProfileService) VerifyHistory(profileID, historyID string) (string, error) {
+	bundle, err := s.verifyBundle(profileID, historyID)
+	if err != nil {
+		return "", err
+	}
+
+	winners, verr := bundle.Verify()
+	result := map[string]interface{}{
+		"ok":      verr == nil,
+		"winners": winners,
+	}
+	if verr != nil {
+		result["error"] = verr.Error()
+	}
+	data, _ := json.Marshal(result)
+	return string(data), nil
+}
+
+func (s *ProfileService) ExportDrawProof(profileID, historyID, path string) (string, error) {
+	bundle, err := s.verifyBundle(profileID, historyID)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (s *ProfileService) verifyBundle(profileID, historyID string) (*live.VerifyBundle, error) {
+	snap, record, err := s.loadSnapshot(profileID, historyID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Proof == nil {
+		return nil, fmt.Errorf("这次开奖没有留种子，没法复验")
+	}
+
+	bundle := &live.VerifyBundle{
+		Proof:        *record.Proof,
+		Count:        record.WinnerCount,
+		Participants: tierEntries(record, snap, -1),
+		Redraws:      record.Redraws,
+	}
+	if len(record.Tiers) == 0 {
+		for _, w := range record.Winners {
+			if w.Replaces == 0 {
+				bundle.Winners = append(bundle.Winners, w.UID)
+			}
+		}
+		return bundle, nil
+	}
+
+	for i, t := range record.Tiers {
+		if t.Proof == nil {
+			return nil, fmt.Errorf("「%s」没有留种子，没法复验", t.Name)
+		}
+		tier := live.VerifyBundle{
+			Name:         t.Name,
+			Proof:        *t.Proof,
+			Count:        t.Quantity,
+			Participants: tierEntries(record, snap, i),
+		}
+		for _, w := range record.Winners {
+			if w.Replaces == 0 && w.Prize == t.Name {
+				tier.Winners = append(tier.Winners, w.UID)
+			}
+		}
+		bundle.Tiers = append(bundle.Tiers, tier)
+	}
+	return bundle, nil
+}
+
+// tierEntries 还原第 tier 个奖项开奖时的名单：不够格的和前面奖项中过的都不在里面。
+// tier 给 -1 就是整份名单
+func tierEntries(record config.HistoryRecord, snap *config.ParticipantSnapshot, tier int) []live.SnapshotEntry {
+	earlier := make(map[int64]bool)
+	for _, w := range record.Winners {
+		if w.Replaces != 0 {
+			continue
+		}
+		for j := 0; j < tier; j++ {
+			if w.Prize == record.Tiers[j].Name {
+				earlier[w.UID] = true
+			}
+		}
+	}
+
+	var entries []live.SnapshotEntry
+	for _, p := range snap.Participants {
+		if p.Excluded != "" || earlier[p.UID] || slices.Contains(p.Ineligible, tier) {
+			continue
+		}
+		entries = append(entries, live.SnapshotEntry{UID: p.UID, Weight: p.Weight})
+	}
+	return entries
+}
+
+func (s *ProfileService) LoadHistory(historyID string) (string, config.HistoryRecord, *config.ParticipantSnapshot, error) {
+	s.mu.Lock()
+	profileID := ""
+	for _, p := range s.state.Profiles {
+		for _, h := range p.History {
+			if h.ID == historyID {
+				profileID = p.ID
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if profileID == "" {
+		return "", config.HistoryRecord{}, nil, fmt.Errorf("没有这条历史喵")
+	}
+	snap, record, err := s.loadSnapshot(profileID, historyID)
+	return profileID, record, snap, err
+}
+
+func (s *ProfileService) AmendHistory(profileID, historyID string, amend func(*config.HistoryRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.findHistory(profileID, historyID)
+	if record == nil {
+		return fmt.Errorf("没有这条历史喵")
+	}
+	updated := *record
+	updated.Winners = append([]config.HistoryWinner(nil), record.Winners...)
+	updated.Redraws = append([]config.RedrawRecord(nil), record.Redraws...)
+	if err := amend(&updated); err != nil {
+		return err
+	}
+	*record = updated
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+func (s *ProfileService) loadSnapshot(profileID, historyID string) (*config.ParticipantSnapshot, config.HistoryRecord, error) {
+	s.mu.Lock()
+	found := s.findHistory(profileID, historyID)
+	var record config.HistoryRecord
+	if found != nil {
+		record = *found
+	}
+	s.mu.Unlock()
+
+	if found == nil {
+		return nil, record, fmt.Errorf("没有这条历史喵")
+	}
+	if record.SnapshotFile == "" {
+		return nil, record, fmt.Errorf("这次开奖没有存参与名单")
+	}
+	snap, err := config.LoadSnapshot(s.snapshotPath(record.SnapshotFile))
+	if err != nil {
+		return nil, record, fmt.Errorf("参与名单找不到了: %v", err)
+	}
+	return snap, record, nil
+}
+
+func (s *ProfileService) snapshotPath(name string) string {
+	return filepath.Join(config.SnapshotDir(s.statePath), filepath.Base(name))
+}
+
+func (s *ProfileService) removeSnapshot(record config.HistoryRecord) {
+	if record.SnapshotFile != "" {
+		os.Remove(s.snapshotPath(record.SnapshotFile))
+	}
+}
+
 func (s *ProfileService) findHistory(profileID, historyID string) *config.HistoryRecord {
 	for i := range s.state.Profiles {
 		if s.state.Profiles[i].ID != profileID {
@@ -142,10 +339,60 @@ func buildMarkdown(r *config.HistoryRecord) string {
 	var b strings.Builder
 	b.WriteString(fmt.Sprintf("# %s 中奖名单\n\n", r.Keyword))
 	b.WriteString(fmt.Sprintf("- 中奖人数：%d\n", r.WinnerCount))
-	b.WriteString(fmt.Sprintf("- 抽奖时间：%s\n\n", r.Time.Format("2006-01-02 15:04:05")))
-	b.WriteString("| 排名 | 昵称 | UID |\n| --- | --- | --- |\n")
-	for i, w := range r.Winners {
-		b.WriteString(fmt.Sprintf("| %d | %s | %d |\n", i+1, w.Username, w.UID))
+	b.WriteString(fmt.Sprintf("- 抽奖时间：%s\n", r.Time.Format("2006-01-02 15:04:05")))
+	if p := r.Proof; p != nil {
+		if len(r.Tiers) > 0 {
+			b.WriteString(fmt.Sprintf("- 开奖算法：%s（%d 个奖项，%d 人参与）\n", p.Algorithm, len(r.Tiers), p.Participants))
+		} else {
+			b.WriteString(fmt.Sprintf("- 开奖算法：%s（第 %d 轮，%d 人参与）\n", p.Algorithm, p.Round, p.Participants))
+		}
+		b.WriteString(fmt.Sprintf("- 种子承诺：`%s`\n", p.Commitment))
+		b.WriteString(fmt.Sprintf("- 种子：`%s`\n", p.Seed))
+		b.WriteString(fmt.Sprintf("- 名单哈希：`%s`\n", p.SnapshotHash))
+	}
+	if r.ParticipantCount > 0 {
+		b.WriteString(fmt.Sprintf("- 参与人数：%d\n", r.ParticipantCount))
+	}
+	if r.Replay != "" {
+		b.WriteString(fmt.Sprintf("- 回放录像：%s\n", r.Replay))
+	}
+
+	if len(r.Tiers) == 0 {
+		b.WriteString("\n")
+		writeWinnerTable(&b, r.Winners)
+		return b.String()
+	}
+	for _, t := range r.Tiers {
+		b.WriteString(fmt.Sprintf("\n## %s（%d 名）\n\n", t.Name, t.Quantity))
+		if p := t.Proof; p != nil {
+			b.WriteString(fmt.Sprintf("- 第 %d 轮，%d 人有资格\n", p.Round, p.Participants))
+			b.WriteString(fmt.Sprintf("- 名单哈希：`%s`\n\n", p.SnapshotHash))
+		}
+		var winners []config.HistoryWinner
+		for _, w := range r.Winners {
+			if w.Prize == t.Name {
+				winners = append(winners, w)
+			}
+		}
+		if len(winners) == 0 {
+			b.WriteString("没有人中这个奖\n")
+			continue
+		}
+		writeWinnerTable(&b, winners)
 	}
 	return b.String()
 }
+
+func writeWinnerTable(b *strings.Builder, winners []config.HistoryWinner) {
+	b.WriteString("| 排名 | 昵称 | UID |\n| --- | --- | --- |\n")
+	for i, w := range winners {
+		name := w.Username
+		if w.Forfeited {
+			name = fmt.Sprintf("~~%s~~（放弃）", name)
+		}
+		if w.Replaces != 0 {
+			name = fmt.Sprintf("%s（补抽，替 %d）", name, w.Replaces)
+		}
+		b.WriteString(fmt.Sprintf("| %d | %s | %d |\n", i+1, name, w.UID))
+	}
+}
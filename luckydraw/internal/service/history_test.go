@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/live"
+)
+
+func newTestProfileService(t *testing.T) *ProfileService {
+	t.Helper()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	state, err := config.LoadRuntimeState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProfileService(state, statePath, nil)
+}
+
+// addDrawnHistory 用 uids 当参与名单真抽一次 count 个人，记进当前配置的历史，能过校验
+func addDrawnHistory(t *testing.T, s *ProfileService, uids []int64, count int) (string, []int64) {
+	t.Helper()
+	seed, commitment, _ := live.NewSeed()
+	var entries []live.SnapshotEntry
+	var participants []config.Participant
+	for _, uid := range uids {
+		entries = append(entries, live.SnapshotEntry{UID: uid, Weight: 1})
+		participants = append(participants, config.Participant{UID: uid, Username: "u", Weight: 1})
+	}
+	proof := config.DrawProof{
+		Algorithm:    live.DrawAlgorithm,
+		Commitment:   commitment,
+		Seed:         seed,
+		SnapshotHash: live.SnapshotHash(entries),
+		Round:        1,
+		Participants: len(entries),
+	}
+	winners, err := live.VerifyDraw(proof, entries, count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := config.HistoryRecord{Keyword: "抽", WinnerCount: count, Proof: &proof}
+	for _, uid := range winners {
+		record.Winners = append(record.Winners, config.HistoryWinner{UID: uid})
+	}
+	id, err := s.AddHistory(s.ActiveProfile().ID, record, participants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, winners
+}
+
+func TestHistorySnapshotRoundTrip(t *testing.T) {
+	s := newTestProfileService(t)
+	profile := s.ActiveProfile()
+	id, _ := addDrawnHistory(t, s, []int64{3, 1, 2}, 2)
+
+	var history []config.HistoryRecord
+	raw, _ := s.GetHistory(profile.ID)
+	json.Unmarshal([]byte(raw), &history)
+	if len(history) != 1 || history[0].ParticipantCount != 3 || history[0].SnapshotFile == "" {
+		t.Fatalf("history = %+v", history)
+	}
+
+	raw, err := s.VerifyHistory(profile.ID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		OK bool `json:"ok"`
+	}
+	json.Unmarshal([]byte(raw), &result)
+	if !result.OK {
+		t.Fatalf("verify = %s", raw)
+	}
+
+	snapshot := filepath.Join(config.SnapshotDir(s.statePath), history[0].SnapshotFile)
+	if err := s.DeleteHistory(profile.ID, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(snapshot); !os.IsNotExist(err) {
+		t.Fatalf("snapshot not removed: %v", err)
+	}
+}
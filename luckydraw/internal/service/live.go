@@ -2,56 +2,144 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
 	"luckydraw/internal/event"
 	"luckydraw/internal/live"
 )
 
 type LiveLotteryService struct {
-	mu         sync.Mutex
+	mu          sync.Mutex
 	liveLottery *live.LiveLottery
-	emitter    event.Emitter
-	cookie     func() *bili.Client
+	emitter     event.Emitter
+	accounts    func(uid int64) (*bili.Client, error)
+	client      *bili.Client
+	lastDraw    *live.DrawResult
+	profiles    *ProfileService
+	profile     config.ProfileConfig
+	keyword     string
+	recorder    *live.Recorder
+	recording   string
+	replay      string
+	window      *lotteryWindow
+	announcing  sync.WaitGroup
+	// stopping 是正在 Stop 等弹幕发完的个数，这时不能再往 announcing 里加
+	stopping int
 }
 
-func NewLiveLotteryService(emitter event.Emitter, cookie func() *bili.Client) *LiveLotteryService {
-	return &LiveLotteryService{emitter: emitter, cookie: cookie}
+// accounts 按 UID 给出登录好的客户端，0 是当前账号
+func NewLiveLotteryService(emitter event.Emitter, accounts func(uid int64) (*bili.Client, error), profiles *ProfileService) *LiveLotteryService {
+	return &LiveLotteryService{emitter: emitter, accounts: accounts, profiles: profiles}
 }
 
+// ConnectLiveRooms 用当前配置绑定的号去连
 func (s *LiveLotteryService) ConnectLiveRooms(roomIDs []int) error {
+	var profile config.ProfileConfig
+	if s.profiles != nil {
+		if active := s.profiles.ActiveProfile(); active != nil {
+			profile = *active
+		}
+	}
+	return s.ConnectProfileRooms(roomIDs, profile)
+}
+
+func (s *LiveLotteryService) ConnectProfileRooms(roomIDs []int, profile config.ProfileConfig) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	client := s.cookie()
-	if client == nil {
-		return fmt.Errorf("Login First")
+	client, err := s.accounts(profile.AccountUID)
+	if err != nil {
+		return err
 	}
 
+	s.cancelWindow()
 	if s.liveLottery != nil && s.liveLottery.IsRunning() {
 		s.liveLottery.Stop()
 	}
+	s.stopRecording()
 
-	s.liveLottery = live.NewLiveLottery(roomIDs, client.GetCookie())
+	s.liveLottery = live.NewClientLottery(roomIDs, client)
+	s.liveLottery.SetEmitter(s.emitter)
+	s.client = client
+	s.replay = ""
 	return nil
 }
 
-func (s *LiveLotteryService) StartLiveLottery(keyword string) error {
+func (s *LiveLotteryService) StartLiveLottery(keyword string, profile config.ProfileConfig) error {
+	return s.StartLotteryWindow(keyword, profile, config.LotteryWindow{})
+}
+
+// StartLotteryWindow 跟 StartLiveLottery 一样，只是到点会自己停，AutoDraw 的话顺手开奖
+func (s *LiveLotteryService) StartLotteryWindow(keyword string, profile config.ProfileConfig, window config.LotteryWindow) error {
+	deadline, err := windowDeadline(window, time.Now())
+	if err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.liveLottery == nil {
 		return fmt.Errorf("先看几个直播呢？")
 	}
+	// 正在抽的这一轮的定时、规则都不能动
+	if s.liveLottery.IsRunning() {
+		return fmt.Errorf("在抽了，我有自己的节奏……")
+	}
+	s.cancelWindow()
+
+	strategy, err := live.NewWeightStrategy(profile.Weighting)
+	if err != nil {
+		return err
+	}
+	matcher, err := live.NewMatcher(ProfileMatch(keyword, profile))
+	if err != nil {
+		return err
+	}
 
 	s.liveLottery.OnUserJoin = func(user *live.DanmakuUser) {
 		if s.emitter != nil {
-			s.emitter.Emit("live:user_join", user)
+			s.emitter.Emit(event.LiveUserJoin, user)
 		}
 	}
-	return s.liveLottery.Start(keyword)
+	s.liveLottery.OnUserReject = func(rejection *live.Rejection) {
+		if s.emitter != nil {
+			s.emitter.Emit(event.LiveUserReject, rejection)
+		}
+	}
+	s.liveLottery.SetRules(profile.Rules)
+	s.liveLottery.SetEntryMode(profile.EntryMode, profile.GiftEntry)
+	s.liveLottery.SetWeightStrategy(strategy)
+	s.liveLottery.SetMatcher(matcher)
+	s.profile = profile
+	s.keyword = matcher.String()
+	s.refreshExclusions()
+	if err := s.liveLottery.Start(keyword); err != nil {
+		return err
+	}
+	// 开起来了才换录像，免得没开成还把上一场的录像截断了
+	if err := s.startRecording(profile); err != nil {
+		s.liveLottery.Stop()
+		return err
+	}
+	if !deadline.IsZero() {
+		s.startWindow(deadline, window.AutoDraw)
+	}
+	return nil
+}
+
+// ProfileMatch 配置里没写关键词也没写正则，就用传进来的这一个，跟以前一样
+func ProfileMatch(keyword string, profile config.ProfileConfig) config.KeywordMatch {
+	match := profile.Match
+	if len(match.Keywords) == 0 && match.Pattern == "" && keyword != "" {
+		match.Keywords = []string{keyword}
+	}
+	return match
 }
 
 func (s *LiveLotteryService) StopLiveLottery() error {
@@ -61,7 +149,9 @@ func (s *LiveLotteryService) StopLiveLottery() error {
 	if s.liveLottery == nil {
 		return fmt.Errorf("啥也不看抽什么奖？")
 	}
+	s.cancelWindow()
 	s.liveLottery.Stop()
+	s.stopRecording()
 	return nil
 }
 
@@ -72,15 +162,128 @@ func (s *LiveLotteryService) DrawWinners(count int) (string, error) {
 	if s.liveLottery == nil {
 		return "", fmt.Errorf("没有直播间给你抽哦～")
 	}
+	return s.draw(count, false)
+}
+
+// DrawPrizes 按奖项顺序一个一个开，前面中过的人后面不会再中
+func (s *LiveLotteryService) DrawPrizes(prizes []config.PrizeTier) (string, error) {
+	if len(prizes) == 0 {
+		return "", fmt.Errorf("一个奖项都没有喵")
+	}
+	if err := validatePrizes(prizes); err != nil {
+		return "", err
+	}
 
-	winners := s.liveLottery.Draw(count)
-	data, err := json.Marshal(winners)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.liveLottery == nil {
+		return "", fmt.Errorf("没有直播间给你抽哦～")
+	}
+	return s.drawPrizes(prizes, false)
+}
+
+// draw 调用方持锁；auto 是定时到点自动开的
+func (s *LiveLotteryService) draw(count int, auto bool) (string, error) {
+	s.refreshExclusions()
+	result, err := s.liveLottery.Draw(count)
+	if err != nil {
+		return "", err
+	}
+	return s.finishDraw(result, count, auto)
+}
+
+// 调用方持锁
+func (s *LiveLotteryService) drawPrizes(prizes []config.PrizeTier, auto bool) (string, error) {
+	s.refreshExclusions()
+	count := 0
+	for _, p := range prizes {
+		count += p.Quantity
+	}
+	result, err := s.liveLottery.DrawTiers(prizes)
+	if err != nil {
+		return "", err
+	}
+	return s.finishDraw(result, count, auto)
+}
+
+// ErrHistoryNotSaved 是人已经抽出来了，但历史和参与名单没存下来，之后没法校验
+var ErrHistoryNotSaved = errors.New("开奖了但没存进历史，这次没法校验了喵")
+
+// finishDraw 记历史、发事件。调用方持锁
+func (s *LiveLotteryService) finishDraw(result *live.DrawResult, count int, auto bool) (string, error) {
+	s.lastDraw = result
+	var historyID string
+	var historyErr error
+	if s.profiles != nil && s.profile.ID != "" {
+		var err error
+		historyID, err = s.profiles.AddHistory(s.profile.ID, config.HistoryRecord{
+			Keyword:     s.keyword,
+			WinnerCount: count,
+			Winners:     result.HistoryWinners(),
+			Proof:       &result.Proof,
+			Recording:   s.recording,
+			Replay:      s.replay,
+			Tiers:       result.TierRecords(),
+		}, result.Snapshot())
+		if err != nil {
+			historyID, historyErr = "", fmt.Errorf("%w: %v", ErrHistoryNotSaved, err)
+		}
+	}
+
+	if s.emitter != nil {
+		completed := event.DrawCompleted{
+			HistoryID:    historyID,
+			Count:        count,
+			Participants: result.Proof.Participants,
+			Round:        result.Proof.Round,
+			Auto:         auto,
+			Winners:      make([]event.Winner, 0, len(result.Winners)),
+		}
+		if historyErr != nil {
+			completed.Error = historyErr.Error()
+		}
+		for _, w := range result.Winners {
+			completed.Winners = append(completed.Winners, event.Winner{UID: w.UID, Username: w.Username, Weight: w.Weight, Prize: w.Prize})
+		}
+		s.emitter.Emit(event.LiveDrawCompleted, completed)
+	}
+	if s.profile.Announce {
+		s.announceInBackground()
+	}
+	if historyErr != nil {
+		return "", historyErr
+	}
+
+	data, err := json.Marshal(result.Winners)
 	if err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
 
+func (s *LiveLotteryService) refreshExclusions() {
+	if s.profiles != nil && s.profile.ID != "" {
+		s.liveLottery.SetExclusions(s.profiles.ExcludedUIDs(s.profile.ID))
+	}
+}
+
+func (s *LiveLotteryService) GetSeedCommitment() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.liveLottery == nil {
+		return ""
+	}
+	return s.liveLottery.Commitment()
+}
+
+func (s *LiveLotteryService) LastDraw() *live.DrawResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastDraw
+}
+
 func (s *LiveLotteryService) GetParticipantCount() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -91,6 +294,72 @@ func (s *LiveLotteryService) GetParticipantCount() int {
 	return s.liveLottery.GetParticipantCount()
 }
 
+func (s *LiveLotteryService) GetParticipants() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.liveLottery == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s.liveLottery.Participants())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *LiveLotteryService) GetLastWinners() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastDraw == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s.lastDraw.Winners)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *LiveLotteryService) GetRoomStatuses() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.liveLottery == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s.liveLottery.RoomStatuses())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *LiveLotteryService) GetRejectedUsers() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.liveLottery == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s.liveLottery.Rejections())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *LiveLotteryService) GetUndecodedPacketCount() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.liveLottery == nil {
+		return 0
+	}
+	return s.liveLottery.UndecodedPackets()
+}
+
 func (s *LiveLotteryService) IsLiveLotteryRunning() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -101,11 +370,21 @@ func (s *LiveLotteryService) IsLiveLotteryRunning() bool {
 	return s.liveLottery.IsRunning()
 }
 
+// Stop 会等还在发的中奖弹幕发完
 func (s *LiveLotteryService) Stop() {
+	s.mu.Lock()
+	s.stopping++
+	s.mu.Unlock()
+	s.announcing.Wait()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.stopping--
+	s.cancelWindow()
 	if s.liveLottery != nil {
 		s.liveLottery.Stop()
 		s.liveLottery = nil
 	}
+	s.client = nil
+	s.stopRecording()
 }
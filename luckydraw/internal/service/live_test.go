@@ -0,0 +1,212 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
+	"luckydraw/internal/live/livetest"
+)
+
+func TestDrawWinnersRecordsHistory(t *testing.T) {
+	srv := livetest.NewServer(livetest.Room{RoomID: 21452505, ShortID: 1, UID: 1, Title: "test"})
+	defer srv.Close()
+	defer srv.Install()()
+
+	profiles := newTestProfileService(t)
+	profile := *profiles.ActiveProfile()
+	profile.Exclusion = config.ExclusionPolicy{Blacklist: []int64{200}}
+	profiles.state.SetActiveProfile(&profile)
+
+	client := bili.NewClient("DedeUserID=42; buvid3=abc")
+	s := NewLiveLotteryService(nil, func(int64) (*bili.Client, error) { return client, nil }, profiles)
+	if err := s.ConnectLiveRooms([]int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartLiveLottery("抽我", profile); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	srv.Send(
+		livetest.Danmaku(100, "alice", "抽我"),
+		livetest.Danmaku(200, "bob", "抽我"),
+	)
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		rejected, _ := s.GetRejectedUsers()
+		if s.GetParticipantCount() == 1 && strings.Contains(rejected, "bob") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := s.DrawWinners(2); err != nil {
+		t.Fatal(err)
+	}
+	draw := s.LastDraw()
+	if len(draw.Winners) != 1 || draw.Winners[0].UID != 100 {
+		t.Fatalf("winners = %+v, want only uid 100", draw.Winners)
+	}
+
+	history := profiles.ActiveProfile().History
+	if len(history) != 1 {
+		t.Fatalf("history = %d records, want 1", len(history))
+	}
+	if history[0].Keyword != "抽我" || history[0].Proof == nil || history[0].ParticipantCount != 1 {
+		t.Fatalf("history record = %+v", history[0])
+	}
+}
+
+func TestConnectLiveRoomsUsesBoundAccount(t *testing.T) {
+	srv := livetest.NewServer(livetest.Room{RoomID: 21452505, ShortID: 1, UID: 1, Title: "test"})
+	defer srv.Close()
+	defer srv.Install()()
+
+	profiles := newTestProfileService(t)
+	profileID := profiles.ActiveProfile().ID
+	if err := profiles.BindAccount(profileID, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	clients := map[int64]*bili.Client{
+		0: bili.NewClient("DedeUserID=42; buvid3=abc"),
+		7: bili.NewClient("DedeUserID=7; buvid3=abc"),
+	}
+	s := NewLiveLotteryService(nil, func(uid int64) (*bili.Client, error) {
+		if client := clients[uid]; client != nil {
+			return client, nil
+		}
+		return nil, fmt.Errorf("没有 %d", uid)
+	}, profiles)
+	if err := s.ConnectLiveRooms([]int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartLiveLottery("", *profiles.ActiveProfile()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if cookie := srv.DanmuInfoCookie(); !strings.Contains(cookie, "DedeUserID=7") {
+		t.Fatalf("连直播间用的 Cookie = %q", cookie)
+	}
+
+	profiles.BindAccount(profileID, 99)
+	if err := s.ConnectLiveRooms([]int{1}); err == nil {
+		t.Fatal("绑定的号不在了还连上了")
+	}
+}
+
+func TestDrawPrizesRecordsTiers(t *testing.T) {
+	s, profiles, srv := newWindowTestService(t, &eventLog{})
+	profile := *profiles.ActiveProfile()
+	if err := s.StartLiveLottery("抽我", profile); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for uid := int64(1); uid <= 8; uid++ {
+		srv.Send(livetest.Danmaku(uid, fmt.Sprintf("u%d", uid), "抽我"))
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && s.GetParticipantCount() < 8 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := s.DrawPrizes([]config.PrizeTier{{Name: "一等奖", Quantity: 1}, {Name: "一等奖", Quantity: 2}}); err == nil {
+		t.Fatal("duplicate prize names should be rejected")
+	}
+	prizes := []config.PrizeTier{{Name: "一等奖", Quantity: 1}, {Name: "二等奖", Quantity: 3}}
+	if _, err := s.DrawPrizes(prizes); err != nil {
+		t.Fatal(err)
+	}
+
+	record := profiles.ActiveProfile().History[0]
+	if len(record.Tiers) != 2 || record.WinnerCount != 4 || len(record.Winners) != 4 {
+		t.Fatalf("record = %+v", record)
+	}
+	second := record.Winners[1]
+	if record.Winners[0].Prize != "一等奖" || second.Prize != "二等奖" {
+		t.Fatalf("winners = %+v", record.Winners)
+	}
+
+	raw, err := s.RedrawWinner(record.ID, second.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(raw, `"prize":"二等奖"`) {
+		t.Fatalf("replacement = %s", raw)
+	}
+	raw, err = profiles.VerifyHistory(profile.ID, record.ID)
+	if err != nil || !strings.Contains(raw, `"ok":true`) {
+		t.Fatalf("verify = %s, %v", raw, err)
+	}
+
+	md := buildMarkdown(&profiles.ActiveProfile().History[0])
+	if !strings.Contains(md, "## 一等奖（1 名）") || !strings.Contains(md, "## 二等奖（3 名）") || !strings.Contains(md, "补抽") {
+		t.Fatalf("markdown = %s", md)
+	}
+}
+
+func TestDrawReportsHistoryError(t *testing.T) {
+	events := &eventLog{}
+	s, profiles, srv := newWindowTestService(t, events)
+	if err := s.StartLiveLottery("抽我", *profiles.ActiveProfile()); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	srv.Send(livetest.Danmaku(100, "alice", "抽我"))
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && s.GetParticipantCount() < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 状态文件所在的目录其实是个文件，名单和历史都存不下来
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	os.WriteFile(blocker, nil, 0o644)
+	profiles.statePath = filepath.Join(blocker, "state.json")
+
+	if _, err := s.DrawWinners(1); !errors.Is(err, ErrHistoryNotSaved) {
+		t.Fatalf("err = %v, want ErrHistoryNotSaved", err)
+	}
+	if draw := s.LastDraw(); draw == nil || len(draw.Winners) != 1 {
+		t.Fatalf("last draw = %+v", draw)
+	}
+	if len(events.draws) != 1 || events.draws[0].Error == "" || events.draws[0].HistoryID != "" {
+		t.Fatalf("draw events = %+v", events.draws)
+	}
+}
+
+func TestFailedStartKeepsRecording(t *testing.T) {
+	s, profiles, _ := newWindowTestService(t, &eventLog{})
+	profile := *profiles.ActiveProfile()
+	profile.RecordSessions = true
+	if err := s.StartLiveLottery("抽我", profile); err != nil {
+		t.Fatal(err)
+	}
+	recording := s.recording
+	if err := s.StartLiveLottery("抽我", profile); err == nil {
+		t.Fatal("second start should fail")
+	}
+	if s.recording != recording || s.recorder == nil {
+		t.Fatalf("recording = %q, want %q still open", s.recording, recording)
+	}
+	entries, _ := os.ReadDir(config.RecordingDir(profiles.statePath))
+	if len(entries) != 1 {
+		t.Fatalf("recordings = %d, want 1", len(entries))
+	}
+}
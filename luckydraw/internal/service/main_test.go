@@ -0,0 +1,14 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"luckydraw/internal/secret"
+)
+
+// 测试里用口令加密配置，别去碰开发机上的钥匙串
+func TestMain(m *testing.M) {
+	os.Setenv(secret.PassphraseEnv, "test-passphrase")
+	os.Exit(m.Run())
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
+	"luckydraw/internal/event"
+	"luckydraw/internal/live"
+)
+
+// NoticeInterval 是两条私信之间隔多久，私信发快了容易被风控；重试时按次数翻倍
+var NoticeInterval = 5 * time.Second
+
+const (
+	noticeRetries      = 3
+	noticeDeadlineDays = 7
+)
+
+const DefaultClaimTemplate = "恭喜 {name} 抽中了{prize}！请在 {deadline} 前回复这条私信留下收货信息，抽奖编号 {history_id}"
+
+// NoticeService 开完奖私信通知中奖者，用的是配置绑定的号
+type NoticeService struct {
+	mu       sync.Mutex
+	busy     bool
+	sending  sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+	emitter  event.Emitter
+	accounts func(uid int64) (*bili.Client, error)
+	profiles *ProfileService
+}
+
+func NewNoticeService(emitter event.Emitter, accounts func(uid int64) (*bili.Client, error), profiles *ProfileService) *NoticeService {
+	return &NoticeService{emitter: emitter, accounts: accounts, profiles: profiles, stop: make(chan struct{})}
+}
+
+// NotifyWinners 按配置的模板挨个私信这次的中奖者，发成功过的和放弃了的跳过，所以失败了可以再点一次。
+// 私信要隔好一阵才能发下一条，所以在后台发，这里只返回排上队的人，每个人的结果看 LiveWinnerNotified 事件
+func (s *NoticeService) NotifyWinners(historyID string) (string, error) {
+	// 同时只跑一批，免得有人收到两条；锁只管开批，不跨着等
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy {
+		return "", fmt.Errorf("上一批私信还没发完喵")
+	}
+	select {
+	case <-s.stop:
+		return "", fmt.Errorf("已经停下了喵")
+	default:
+	}
+
+	profile, record, err := s.profiles.historyRecord(historyID)
+	if err != nil {
+		return "", err
+	}
+	client, err := s.accounts(profile.AccountUID)
+	if err != nil {
+		return "", err
+	}
+
+	var pending []config.HistoryWinner
+	queued := []event.WinnerNotice{}
+	for _, w := range record.Winners {
+		if w.Forfeited || (w.Notice != nil && w.Notice.Sent) {
+			continue
+		}
+		pending = append(pending, w)
+		queued = append(queued, event.WinnerNotice{HistoryID: historyID, UID: w.UID, Username: w.Username})
+	}
+	data, err := json.Marshal(queued)
+	if err != nil {
+		return "", err
+	}
+	if len(pending) == 0 {
+		return string(data), nil
+	}
+
+	s.busy = true
+	s.sending.Add(1)
+	go func() {
+		defer s.sending.Done()
+		s.notify(client, profile, record, pending)
+		s.mu.Lock()
+		s.busy = false
+		s.mu.Unlock()
+	}()
+	return string(data), nil
+}
+
+// Wait 等后台这批私信发完
+func (s *NoticeService) Wait() {
+	s.sending.Wait()
+}
+
+// Stop 不再等下一条，没轮到的人下次再点会接着发
+func (s *NoticeService) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.sending.Wait()
+}
+
+func (s *NoticeService) notify(client *bili.Client, profile config.ProfileConfig, record config.HistoryRecord, pending []config.HistoryWinner) {
+	sent := false
+	for _, w := range pending {
+		var notice config.Notice
+		if live.IsOpenUID(w.UID) {
+			// 开放平台给的是编出来的 UID，发出去会落到不相干的人头上
+			notice = config.Notice{Time: time.Now(), Error: "开放平台用户没法私信"}
+		} else {
+			if sent && !s.sleep(NoticeInterval) {
+				return
+			}
+			sent = true
+			notice = s.sendNotice(client, w.UID, claimMessage(profile.ClaimNotice, record, w), w.Notice)
+		}
+
+		result := event.WinnerNotice{
+			HistoryID: record.ID,
+			UID:       w.UID,
+			Username:  w.Username,
+			Sent:      notice.Sent,
+			Attempts:  notice.Attempts,
+			Error:     notice.Error,
+		}
+		err := s.profiles.AmendHistory(profile.ID, record.ID, func(r *config.HistoryRecord) error {
+			for i := range r.Winners {
+				if r.Winners[i].UID == w.UID && !r.Winners[i].Forfeited {
+					n := notice
+					r.Winners[i].Notice = &n
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			result.Error = fmt.Sprintf("私信发了但没记下来: %v", err)
+		}
+		if s.emitter != nil {
+			s.emitter.Emit(event.LiveWinnerNotified, result)
+		}
+	}
+}
+
+// sleep 等 d，中途 Stop 了就返回 false
+func (s *NoticeService) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// sendNotice 失败了隔一阵再试，等的时间一次比一次长；Attempts 接着上次的往下数
+func (s *NoticeService) sendNotice(client *bili.Client, uid int64, text string, prev *config.Notice) config.Notice {
+	var notice config.Notice
+	if prev != nil {
+		notice.Attempts = prev.Attempts
+	}
+	for try := 0; try <= noticeRetries; try++ {
+		if try > 0 && !s.sleep(NoticeInterval<<try) {
+			break
+		}
+		notice.Attempts++
+		err := client.SendPrivateMessage(uid, text)
+		notice.Time = time.Now()
+		if err == nil {
+			notice.Sent, notice.Error = true, ""
+			return notice
+		}
+		notice.Error = err.Error()
+		// 负数的是没登录、csrf 不对这类通用错误，重试也没用
+		var apiErr *bili.APIError
+		if errors.As(err, &apiErr) && apiErr.Code < 0 {
+			break
+		}
+	}
+	return notice
+}
+
+func claimMessage(claim config.ClaimNotice, record config.HistoryRecord, w config.HistoryWinner) string {
+	template := claim.Template
+	if strings.TrimSpace(template) == "" {
+		template = DefaultClaimTemplate
+	}
+	days := claim.DeadlineDays
+	if days <= 0 {
+		days = noticeDeadlineDays
+	}
+	prize := w.Prize
+	if prize == "" {
+		prize = "奖品"
+	}
+	return strings.NewReplacer(
+		"{name}", w.Username,
+		"{prize}", prize,
+		"{deadline}", record.Time.AddDate(0, 0, days).Format("2006-01-02 15:04"),
+		"{history_id}", record.ID,
+	).Replace(template)
+}
+
+// historyRecord 按历史 ID 找到记录和它所在的配置
+func (s *ProfileService) historyRecord(historyID string) (config.ProfileConfig, config.HistoryRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.state.Profiles {
+		for _, h := range p.History {
+			if h.ID == historyID {
+				return p, h, nil
+			}
+		}
+	}
+	return config.ProfileConfig{}, config.HistoryRecord{}, fmt.Errorf("没有这条历史喵")
+}
+
+// SaveClaimNotice 模板留空就用 DefaultClaimTemplate
+func (s *ProfileService) SaveClaimNotice(claim config.ClaimNotice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	if claim.DeadlineDays < 0 {
+		return fmt.Errorf("领奖期限不能是负数喵")
+	}
+	claim.Template = strings.TrimSpace(claim.Template)
+	profile.ClaimNotice = claim
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
+	"luckydraw/internal/event"
+	"luckydraw/internal/live"
+	"luckydraw/internal/live/livetest"
+)
+
+func TestNotifyWinners(t *testing.T) {
+	srv := livetest.NewServer()
+	defer srv.Close()
+	defer srv.Install()()
+
+	old := NoticeInterval
+	NoticeInterval = time.Millisecond
+	defer func() { NoticeInterval = old }()
+
+	profiles := newTestProfileService(t)
+	if err := profiles.SaveClaimNotice(config.ClaimNotice{Template: "{name} 中了{prize}，{deadline} 前回复，编号 {history_id}", DeadlineDays: 3}); err != nil {
+		t.Fatal(err)
+	}
+	profileID := profiles.ActiveProfile().ID
+	historyID, err := profiles.AddHistory(profileID, config.HistoryRecord{
+		WinnerCount: 2,
+		Winners: []config.HistoryWinner{
+			{UID: 100, Username: "alice", Prize: "一等奖"},
+			{UID: 200, Username: "bob", Forfeited: true},
+			{UID: 300, Username: "carol", Replaces: 200},
+			{UID: live.OpenUID(0, "open-dave"), Username: "dave"},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := &eventLog{}
+	client := bili.NewClient("DedeUserID=42; buvid3=abc; bili_jct=csrf")
+	s := NewNoticeService(events, func(int64) (*bili.Client, error) { return client, nil }, profiles)
+
+	// 第一条先被限流一次，重试后发出去；bob 放弃了不发
+	srv.FailMessages(1, 21046)
+	raw, err := s.NotifyWinners(historyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queued []event.WinnerNotice
+	json.Unmarshal([]byte(raw), &queued)
+	if len(queued) != 3 {
+		t.Fatalf("queued = %+v", queued)
+	}
+	s.Wait()
+	results := events.notices
+	if len(results) != 3 || !results[0].Sent || results[0].Attempts != 2 || !results[1].Sent || results[2].Sent {
+		t.Fatalf("results = %+v", results)
+	}
+	messages := srv.PrivateMessages()
+	if len(messages) != 2 || messages[0].Receiver != 100 || messages[1].Receiver != 300 {
+		t.Fatalf("messages = %+v", messages)
+	}
+	record := profiles.ActiveProfile().History[0]
+	deadline := record.Time.AddDate(0, 0, 3).Format("2006-01-02 15:04")
+	if want := "alice 中了一等奖，" + deadline + " 前回复，编号 " + historyID; messages[0].Content != want {
+		t.Fatalf("content = %q, want %q", messages[0].Content, want)
+	}
+	if !strings.Contains(messages[1].Content, "carol 中了奖品") {
+		t.Fatalf("content = %q", messages[1].Content)
+	}
+	if n := record.Winners[0].Notice; n == nil || !n.Sent || n.Attempts != 2 {
+		t.Fatalf("notice = %+v", n)
+	}
+	if record.Winners[1].Notice != nil {
+		t.Fatal("forfeited winner should not be notified")
+	}
+	if n := record.Winners[3].Notice; n == nil || n.Sent || n.Attempts != 0 || n.Error != "开放平台用户没法私信" {
+		t.Fatalf("open platform notice = %+v", n)
+	}
+
+	srv.FailMessages(0, 0)
+	if _, err := s.NotifyWinners(historyID); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if len(srv.PrivateMessages()) != 2 {
+		t.Fatalf("second run sent %d messages, want none", len(srv.PrivateMessages())-2)
+	}
+	if events.count(event.LiveWinnerNotified) != 4 {
+		t.Fatalf("notice events = %d", events.count(event.LiveWinnerNotified))
+	}
+}
+
+func TestNotifyWinnersStopsOnPermanentError(t *testing.T) {
+	srv := livetest.NewServer()
+	defer srv.Close()
+	defer srv.Install()()
+
+	old := NoticeInterval
+	NoticeInterval = time.Millisecond
+	defer func() { NoticeInterval = old }()
+
+	profiles := newTestProfileService(t)
+	historyID, err := profiles.AddHistory(profiles.ActiveProfile().ID, config.HistoryRecord{
+		Winners: []config.HistoryWinner{{UID: 100, Username: "alice"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := bili.NewClient("DedeUserID=42; buvid3=abc; bili_jct=csrf")
+	s := NewNoticeService(nil, func(int64) (*bili.Client, error) { return client, nil }, profiles)
+
+	srv.FailMessages(5, bili.CodeNotLoggedIn)
+	if _, err := s.NotifyWinners(historyID); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	n := profiles.ActiveProfile().History[0].Winners[0].Notice
+	if n == nil || n.Sent || n.Attempts != 1 || n.Error == "" {
+		t.Fatalf("notice = %+v, want one failed attempt", n)
+	}
+}
+
+func TestNotifyWinnersRunsInBackground(t *testing.T) {
+	srv := livetest.NewServer()
+	defer srv.Close()
+	defer srv.Install()()
+
+	old := NoticeInterval
+	NoticeInterval = time.Hour
+	defer func() { NoticeInterval = old }()
+
+	profiles := newTestProfileService(t)
+	historyID, err := profiles.AddHistory(profiles.ActiveProfile().ID, config.HistoryRecord{
+		Winners: []config.HistoryWinner{{UID: 100, Username: "alice"}, {UID: 200, Username: "bob"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := bili.NewClient("DedeUserID=42; buvid3=abc; bili_jct=csrf")
+	s := NewNoticeService(nil, func(int64) (*bili.Client, error) { return client, nil }, profiles)
+
+	// 下一条要等一小时，调用还是马上回来
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.NotifyWinners(historyID)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("NotifyWinners blocked on the batch")
+	}
+	if _, err := s.NotifyWinners(historyID); err == nil {
+		t.Fatal("second batch should be refused while the first is running")
+	}
+
+	s.Stop()
+	winners := profiles.ActiveProfile().History[0].Winners
+	if len(srv.PrivateMessages()) != 1 || winners[0].Notice == nil || !winners[0].Notice.Sent || winners[1].Notice != nil {
+		t.Fatalf("messages = %+v, winners = %+v", srv.PrivateMessages(), winners)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
+	"luckydraw/internal/live"
+)
+
+func (s *AuthService) OpenPlatform() config.OpenPlatformConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config.OpenPlatform
+}
+
+// secret 不回给前端，只告诉它填没填
+func (s *AuthService) GetOpenPlatformSettings() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.openPlatformSettings()
+}
+
+// secret 传空就沿用之前存的，省得每次都要重新粘贴
+func (s *AuthService) SaveOpenPlatformSettings(accessKeyID, accessKeySecret string, appID int64, identityCode string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	open := &s.config.OpenPlatform
+	open.AccessKeyID = strings.TrimSpace(accessKeyID)
+	if secret := strings.TrimSpace(accessKeySecret); secret != "" {
+		open.AccessKeySecret = secret
+	}
+	open.AppID = appID
+	open.IdentityCode = strings.TrimSpace(identityCode)
+	if err := config.SaveConfig(s.configPath, s.config); err != nil {
+		return "", err
+	}
+	return s.openPlatformSettings()
+}
+
+func (s *AuthService) openPlatformSettings() (string, error) {
+	open := s.config.OpenPlatform
+	data, err := json.Marshal(map[string]interface{}{
+		"access_key_id": open.AccessKeyID,
+		"has_secret":    open.AccessKeySecret != "",
+		"app_id":        open.AppID,
+		"identity_code": open.IdentityCode,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ConnectOpenPlatform 不用登录，走开放平台拿主播身份码开局；真正开局在 StartLiveLottery 时
+func (s *LiveLotteryService) ConnectOpenPlatform(settings config.OpenPlatformConfig) error {
+	if settings.AccessKeyID == "" || settings.AccessKeySecret == "" || settings.AppID == 0 {
+		return fmt.Errorf("开放平台的 key 和 app_id 还没填")
+	}
+	if settings.IdentityCode == "" {
+		return fmt.Errorf("身份码呢？直播姬里能找到")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancelWindow()
+	if s.liveLottery != nil && s.liveLottery.IsRunning() {
+		s.liveLottery.Stop()
+	}
+	s.stopRecording()
+
+	api := bili.NewOpenClient(settings.AccessKeyID, settings.AccessKeySecret)
+	s.liveLottery = live.NewSourceLottery(live.NewOpenPlatformSource(api, settings.AppID, settings.IdentityCode))
+	s.liveLottery.SetEmitter(s.emitter)
+	s.client = nil
+	s.replay = ""
+	return nil
+}
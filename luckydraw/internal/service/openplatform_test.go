@@ -0,0 +1,43 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"luckydraw/internal/config"
+)
+
+func TestSaveOpenPlatformSettingsKeepsSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	s := NewAuthService(&config.Config{}, path)
+
+	if _, err := s.SaveOpenPlatformSettings("key", "secret", 1, "CODE"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := s.SaveOpenPlatformSettings("key", "", 1, " NEWCODE ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(raw, `"secret"`) || !strings.Contains(raw, `"has_secret":true`) {
+		t.Fatalf("settings = %s, want secret hidden but present", raw)
+	}
+
+	saved, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.OpenPlatform; got.AccessKeySecret != "secret" || got.IdentityCode != "NEWCODE" {
+		t.Fatalf("saved open platform = %+v", got)
+	}
+}
+
+func TestConnectOpenPlatformNeedsSettings(t *testing.T) {
+	s := NewLiveLotteryService(nil, nil, nil)
+	if err := s.ConnectOpenPlatform(config.OpenPlatformConfig{AccessKeyID: "key", AccessKeySecret: "secret", AppID: 1}); err == nil {
+		t.Fatal("connected without an identity code")
+	}
+	if err := s.ConnectOpenPlatform(config.OpenPlatformConfig{IdentityCode: "CODE"}); err == nil {
+		t.Fatal("connected without app keys")
+	}
+}
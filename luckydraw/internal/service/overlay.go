@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/overlay"
+)
+
+const defaultOverlayAddr = "127.0.0.1:17878"
+
+type OverlayService struct {
+	mu         sync.Mutex
+	config     *config.Config
+	configPath string
+	source     overlay.Source
+	server     *overlay.Server
+}
+
+func NewOverlayService(cfg *config.Config, configPath string) *OverlayService {
+	return &OverlayService{config: cfg, configPath: configPath}
+}
+
+// 直播服务要先拿到发事件的地方，所以数据源是后接上的
+func (s *OverlayService) Attach(source overlay.Source) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source = source
+	if !s.config.Overlay.Enabled {
+		return nil
+	}
+	return s.start()
+}
+
+func (s *OverlayService) Emit(name string, data ...any) bool {
+	s.mu.Lock()
+	server := s.server
+	s.mu.Unlock()
+
+	if server == nil {
+		return false
+	}
+	return server.Emit(name, data...)
+}
+
+func (s *OverlayService) GetOverlaySettings() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings()
+}
+
+func (s *OverlayService) SaveOverlaySettings(enabled bool, addr string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config.Overlay.Enabled = enabled
+	s.config.Overlay.Addr = addr
+	s.stop()
+	if enabled {
+		if err := s.start(); err != nil {
+			s.config.Overlay.Enabled = false
+			config.SaveConfig(s.configPath, s.config)
+			return "", err
+		}
+	}
+	if err := config.SaveConfig(s.configPath, s.config); err != nil {
+		return "", err
+	}
+	return s.settings()
+}
+
+func (s *OverlayService) ResetOverlayToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config.Overlay.Token = ""
+	if s.server != nil {
+		s.stop()
+		if err := s.start(); err != nil {
+			return "", err
+		}
+	} else if err := s.ensureToken(); err != nil {
+		return "", err
+	}
+	if err := config.SaveConfig(s.configPath, s.config); err != nil {
+		return "", err
+	}
+	return s.settings()
+}
+
+func (s *OverlayService) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+func (s *OverlayService) start() error {
+	if s.source == nil {
+		return fmt.Errorf("直播服务还没起来")
+	}
+	if err := s.ensureToken(); err != nil {
+		return err
+	}
+
+	server := overlay.NewServer(s.source, s.config.Overlay.Token)
+	if err := server.Start(s.addr()); err != nil {
+		return fmt.Errorf("叠加层端口被占了: %v", err)
+	}
+	s.server = server
+	return nil
+}
+
+func (s *OverlayService) stop() {
+	if s.server != nil {
+		s.server.Close()
+		s.server = nil
+	}
+}
+
+func (s *OverlayService) ensureToken() error {
+	if s.config.Overlay.Token != "" {
+		return nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	s.config.Overlay.Token = hex.EncodeToString(buf)
+	return config.SaveConfig(s.configPath, s.config)
+}
+
+func (s *OverlayService) addr() string {
+	if s.config.Overlay.Addr != "" {
+		return s.config.Overlay.Addr
+	}
+	return defaultOverlayAddr
+}
+
+func (s *OverlayService) settings() (string, error) {
+	result := map[string]interface{}{
+		"enabled": s.config.Overlay.Enabled,
+		"addr":    s.addr(),
+		"token":   s.config.Overlay.Token,
+		"running": s.server != nil,
+	}
+	if s.server != nil {
+		result["url"] = "http://" + s.server.Addr() + "/?token=" + url.QueryEscape(s.config.Overlay.Token)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -3,11 +3,13 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"luckydraw/internal/config"
 	"luckydraw/internal/event"
+	"luckydraw/internal/live"
 )
 
 type ProfileService struct {
@@ -62,7 +64,7 @@ func (s *ProfileService) SwitchProfile(id string) (string, error) {
 	profile := s.state.GetActiveProfile()
 	profileData, _ := json.Marshal(profile)
 	if s.emitter != nil {
-		s.emitter.Emit("profile:switched", string(profileData))
+		s.emitter.Emit(event.ProfileSwitched, string(profileData))
 	}
 	return string(profileData), nil
 }
@@ -77,6 +79,7 @@ func (s *ProfileService) CreateProfile(name string) (string, error) {
 		Name:         name,
 		WatchedRooms: []int{},
 		WinnerCount:  1,
+		Match:        config.KeywordMatch{IgnoreCase: true, IgnoreWidth: true, IgnoreEmoji: true, IgnoreScript: true},
 	}
 	s.state.Profiles = append(s.state.Profiles, profile)
 	s.state.ActiveProfile = id
@@ -87,7 +90,7 @@ func (s *ProfileService) CreateProfile(name string) (string, error) {
 
 	profileData, _ := json.Marshal(profile)
 	if s.emitter != nil {
-		s.emitter.Emit("profile:created", string(profileData))
+		s.emitter.Emit(event.ProfileCreated, string(profileData))
 	}
 	return string(profileData), nil
 }
@@ -146,6 +149,179 @@ func (s *ProfileService) SaveProfileConfig(keyword string, winnerCount int) erro
 	return config.SaveRuntimeState(s.statePath, s.state)
 }
 
+func (s *ProfileService) SaveKeywordMatch(match config.KeywordMatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	match.Keywords = trimWords(match.Keywords)
+	match.Exclude = trimWords(match.Exclude)
+	if _, err := live.NewMatcher(match); err != nil {
+		return err
+	}
+	profile.Match = match
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+func trimWords(words []string) []string {
+	var out []string
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func (s *ProfileService) SaveEligibilityRules(rules config.EligibilityRules) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	if err := validateRules(rules); err != nil {
+		return err
+	}
+	profile.Rules = rules
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+func validateRules(rules config.EligibilityRules) error {
+	if rules.MinMedalLevel < 0 || rules.MinUserLevel < 0 || rules.GuardLevel < 0 || rules.GuardLevel > 3 {
+		return fmt.Errorf("这规则谁也抽不中吧")
+	}
+	return nil
+}
+
+// SavePrizeTiers 奖项按给的顺序开，清空就回到只按 WinnerCount 抽一把
+func (s *ProfileService) SavePrizeTiers(prizes []config.PrizeTier) error {
+	for i := range prizes {
+		prizes[i].Name = strings.TrimSpace(prizes[i].Name)
+	}
+	if err := validatePrizes(prizes); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	profile.Prizes = prizes
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+// 历史和补抽靠名字认奖项，所以名字不能重
+func validatePrizes(prizes []config.PrizeTier) error {
+	seen := make(map[string]bool, len(prizes))
+	for _, p := range prizes {
+		if p.Name == "" {
+			return fmt.Errorf("奖项要有个名字")
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("有两个都叫「%s」", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Quantity < 1 {
+			return fmt.Errorf("「%s」至少得有一个名额", p.Name)
+		}
+		if p.Rules != nil {
+			if err := validateRules(*p.Rules); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ProfileService) SaveGiftEntry(mode string, gift config.GiftEntryRules) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	switch mode {
+	case "", config.EntryModeDanmaku, config.EntryModeGift, config.EntryModeAny:
+	default:
+		return fmt.Errorf("不认识的参与方式: %s", mode)
+	}
+	if gift.MinNum < 0 || gift.MinCoin < 0 || gift.MinSuperChatPrice < 0 {
+		return fmt.Errorf("礼物门槛不能是负数喵")
+	}
+	profile.EntryMode = mode
+	profile.GiftEntry = gift
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+func (s *ProfileService) SaveWeighting(weighting config.WeightingConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	if _, err := live.NewWeightStrategy(weighting); err != nil {
+		return err
+	}
+	profile.Weighting = weighting
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+func (s *ProfileService) SaveRecording(enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	profile.RecordSessions = enabled
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+// SaveAnnounce 开了的话每次开完奖都把中奖名单发到直播间弹幕
+func (s *ProfileService) SaveAnnounce(enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.state.GetActiveProfile()
+	if profile == nil {
+		return fmt.Errorf("没有活跃的配置喵")
+	}
+	profile.Announce = enabled
+	s.state.SetActiveProfile(profile)
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
+// BindAccount 让这个配置固定用某个号连直播间，uid 给 0 就是跟着当前账号走
+func (s *ProfileService) BindAccount(profileID string, uid int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile := s.findProfile(profileID)
+	if profile == nil {
+		return fmt.Errorf("没有这个配置喵")
+	}
+	profile.AccountUID = uid
+	return config.SaveRuntimeState(s.statePath, s.state)
+}
+
 func (s *ProfileService) SetBackgroundImage(imagePath string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/live"
+)
+
+const recordingExt = ".jsonl.gz"
+
+type RecordingInfo struct {
+	Name string    `json:"name"`
+	Size int64     `json:"size"`
+	Time time.Time `json:"time"`
+}
+
+func (s *LiveLotteryService) ConnectReplay(path string, speed float64) error {
+	if speed < 0 {
+		return fmt.Errorf("倍速不能是负的")
+	}
+	if s.profiles != nil {
+		path = s.profiles.RecordingPath(path)
+	}
+	replay, err := live.LoadReplay(path, speed)
+	if err != nil {
+		return err
+	}
+	if len(replay.Messages) == 0 {
+		return fmt.Errorf("录像是空的喵")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancelWindow()
+	if s.liveLottery != nil && s.liveLottery.IsRunning() {
+		s.liveLottery.Stop()
+	}
+	s.stopRecording()
+
+	s.liveLottery = live.NewReplayLottery(replay)
+	s.client = nil
+	s.liveLottery.SetEmitter(s.emitter)
+	s.replay = filepath.Base(path)
+	return nil
+}
+
+func (s *LiveLotteryService) startRecording(profile config.ProfileConfig) error {
+	s.stopRecording()
+	s.recording = ""
+	if !profile.RecordSessions || s.replay != "" || s.profiles == nil {
+		return nil
+	}
+
+	name := fmt.Sprintf("%s-%s%s", time.Now().Format("20060102-150405"), profile.ID, recordingExt)
+	recorder, err := live.NewRecorder(filepath.Join(config.RecordingDir(s.profiles.statePath), name))
+	if err != nil {
+		return fmt.Errorf("录像开不了: %v", err)
+	}
+	s.recorder = recorder
+	s.recording = name
+	s.liveLottery.SetRecorder(recorder)
+	return nil
+}
+
+func (s *LiveLotteryService) stopRecording() {
+	if s.recorder == nil {
+		return
+	}
+	if s.liveLottery != nil {
+		s.liveLottery.SetRecorder(nil)
+	}
+	s.recorder.Close()
+	s.recorder = nil
+}
+
+// 只给文件名就去录像目录里找
+func (s *ProfileService) RecordingPath(name string) string {
+	if filepath.IsAbs(name) || strings.ContainsAny(name, `/\`) {
+		return name
+	}
+	return filepath.Join(config.RecordingDir(s.statePath), name)
+}
+
+func (s *ProfileService) GetRecordings() (string, error) {
+	entries, err := os.ReadDir(config.RecordingDir(s.statePath))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	recordings := make([]RecordingInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), recordingExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, RecordingInfo{Name: entry.Name(), Size: info.Size(), Time: info.ModTime()})
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].Time.After(recordings[j].Time) })
+
+	data, err := json.Marshal(recordings)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/event"
+	"luckydraw/internal/live"
+)
+
+func (s *LiveLotteryService) RedrawWinner(historyID string, uid int64) (string, error) {
+	if s.profiles == nil {
+		return "", fmt.Errorf("没有历史记录可以补抽")
+	}
+
+	profileID, record, snap, err := s.profiles.LoadHistory(historyID)
+	if err != nil {
+		return "", err
+	}
+	if record.Proof == nil {
+		return "", fmt.Errorf("这次开奖没有留种子，没法补抽")
+	}
+
+	active := false
+	prize := ""
+	taken := make(map[int64]bool, len(record.Winners))
+	for _, w := range record.Winners {
+		taken[w.UID] = true
+		if w.UID == uid && !w.Forfeited {
+			active = true
+			prize = w.Prize
+		}
+	}
+	if !active {
+		return "", fmt.Errorf("%d 不在这次的中奖名单里", uid)
+	}
+
+	participants := make(map[int64]config.Participant, len(snap.Participants))
+	for _, p := range snap.Participants {
+		participants[p.UID] = p
+	}
+
+	// 分奖项的话只在这个奖项够格的人里补，用这个奖项那一轮的证明
+	proof := *record.Proof
+	entries := tierEntries(record, snap, -1)
+	if len(record.Tiers) > 0 {
+		tier := slices.IndexFunc(record.Tiers, func(t config.TierRecord) bool { return t.Name == prize })
+		if tier < 0 || record.Tiers[tier].Proof == nil {
+			return "", fmt.Errorf("找不到「%s」这个奖项的种子，没法补抽", prize)
+		}
+		proof = *record.Tiers[tier].Proof
+		entries = tierEntries(record, snap, tier)
+	}
+
+	pool := live.RemainingPool(entries, taken)
+	attempt := len(record.Redraws) + 1
+	newUID, poolHash, ok := live.RedrawOne(proof, pool, attempt)
+	if !ok {
+		return "", fmt.Errorf("没有人可以补了喵")
+	}
+
+	p := participants[newUID]
+	replacement := config.HistoryWinner{
+		UID:      p.UID,
+		Username: p.Username,
+		Count:    p.Count,
+		Weight:   p.Weight,
+		Replaces: uid,
+		Prize:    prize,
+	}
+	redraw := config.RedrawRecord{
+		Time:           time.Now(),
+		Attempt:        attempt,
+		ForfeitedUID:   uid,
+		ReplacementUID: newUID,
+		PoolHash:       poolHash,
+		PoolSize:       len(pool),
+		Prize:          prize,
+	}
+
+	err = s.profiles.AmendHistory(profileID, historyID, func(r *config.HistoryRecord) error {
+		if len(r.Redraws)+1 != attempt {
+			return fmt.Errorf("别人刚补抽过，刷新一下再来")
+		}
+		for i := range r.Winners {
+			if r.Winners[i].UID == uid {
+				r.Winners[i].Forfeited = true
+			}
+		}
+		r.Winners = append(r.Winners, replacement)
+		r.Redraws = append(r.Redraws, redraw)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if s.emitter != nil {
+		s.emitter.Emit(event.LiveWinnerRedrawn, event.WinnerRedrawn{
+			HistoryID: historyID,
+			Forfeited: uid,
+			Replacement: event.Winner{
+				UID:      replacement.UID,
+				Username: replacement.Username,
+				Weight:   replacement.Weight,
+				Prize:    replacement.Prize,
+			},
+		})
+	}
+
+	data, err := json.Marshal(replacement)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
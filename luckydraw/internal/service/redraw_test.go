@@ -0,0 +1,46 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"luckydraw/internal/config"
+)
+
+func TestRedrawWinner(t *testing.T) {
+	profiles := newTestProfileService(t)
+	s := NewLiveLotteryService(nil, nil, profiles)
+
+	profileID := profiles.ActiveProfile().ID
+	historyID, winners := addDrawnHistory(t, profiles, []int64{1, 2, 3, 4, 5, 6}, 2)
+
+	raw, err := s.RedrawWinner(historyID, winners[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replacement config.HistoryWinner
+	json.Unmarshal([]byte(raw), &replacement)
+	if replacement.UID == winners[0] || replacement.UID == winners[1] || replacement.Replaces != winners[0] {
+		t.Fatalf("replacement = %+v, winners = %v", replacement, winners)
+	}
+
+	if _, err := s.RedrawWinner(historyID, winners[0]); err == nil {
+		t.Fatal("forfeited winner redrawn twice")
+	}
+	if _, err := s.RedrawWinner(historyID, replacement.UID); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err = profiles.VerifyHistory(profileID, historyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		OK      bool    `json:"ok"`
+		Winners []int64 `json:"winners"`
+	}
+	json.Unmarshal([]byte(raw), &result)
+	if !result.OK || len(result.Winners) != 4 {
+		t.Fatalf("verify = %s", raw)
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"luckydraw/internal/config"
+	"luckydraw/internal/event"
+)
+
+// CountdownInterval 是倒计时事件的间隔
+var CountdownInterval = time.Second
+
+type lotteryWindow struct {
+	endsAt   time.Time
+	autoDraw bool
+	stop     chan struct{}
+}
+
+func windowDeadline(window config.LotteryWindow, now time.Time) (time.Time, error) {
+	switch {
+	case !window.EndAt.IsZero():
+		if !window.EndAt.After(now) {
+			return time.Time{}, fmt.Errorf("结束时间已经过了喵")
+		}
+		return window.EndAt, nil
+	case window.DurationSeconds < 0:
+		return time.Time{}, fmt.Errorf("时长不能是负数喵")
+	case window.DurationSeconds > 0:
+		return now.Add(time.Duration(window.DurationSeconds) * time.Second), nil
+	}
+	return time.Time{}, nil
+}
+
+// 调用方持锁
+func (s *LiveLotteryService) startWindow(endsAt time.Time, autoDraw bool) {
+	w := &lotteryWindow{endsAt: endsAt, autoDraw: autoDraw, stop: make(chan struct{})}
+	s.window = w
+	go s.runWindow(w)
+}
+
+// cancelWindow 手动停了、重新开始或者换了直播间，定时就不算数了。调用方持锁
+func (s *LiveLotteryService) cancelWindow() {
+	if s.window != nil {
+		close(s.window.stop)
+		s.window = nil
+	}
+}
+
+// 倒计时在后端跑，前端刷新了也照样到点停
+func (s *LiveLotteryService) runWindow(w *lotteryWindow) {
+	ticker := time.NewTicker(CountdownInterval)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(w.endsAt))
+	defer timer.Stop()
+
+	s.emitCountdown(w, time.Now())
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			s.emitCountdown(w, now)
+		case <-timer.C:
+			s.finishWindow(w)
+			return
+		}
+	}
+}
+
+func (s *LiveLotteryService) finishWindow(w *lotteryWindow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 等锁的时候被手动停掉了
+	if s.window != w {
+		return
+	}
+	s.window = nil
+	s.emitCountdown(w, w.endsAt)
+	if s.liveLottery == nil {
+		if w.autoDraw {
+			s.emitAutoDrawError(fmt.Errorf("直播间已经断开了"))
+		}
+		return
+	}
+	s.liveLottery.Stop()
+	s.stopRecording()
+	var err error
+	switch {
+	case !w.autoDraw:
+	case len(s.profile.Prizes) > 0:
+		if err = validatePrizes(s.profile.Prizes); err == nil {
+			_, err = s.drawPrizes(s.profile.Prizes, true)
+		}
+	default:
+		count := s.profile.WinnerCount
+		if count < 1 {
+			count = 1
+		}
+		_, err = s.draw(count, true)
+	}
+	// 历史没存上的已经跟着开奖事件发过了
+	if err != nil && !errors.Is(err, ErrHistoryNotSaved) {
+		s.emitAutoDrawError(err)
+	}
+}
+
+// 到点的时候前端可能早就刷新没了，自动开奖失败也得发个事件留个底
+func (s *LiveLotteryService) emitAutoDrawError(err error) {
+	if s.emitter != nil {
+		s.emitter.Emit(event.LiveDrawCompleted, event.DrawCompleted{
+			Auto:    true,
+			Winners: []event.Winner{},
+			Error:   fmt.Sprintf("自动开奖失败: %v", err),
+		})
+	}
+}
+
+func (s *LiveLotteryService) emitCountdown(w *lotteryWindow, now time.Time) {
+	if s.emitter != nil {
+		s.emitter.Emit(event.LiveCountdown, countdown(w, now))
+	}
+}
+
+func countdown(w *lotteryWindow, now time.Time) event.Countdown {
+	remaining := w.endsAt.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return event.Countdown{
+		EndsAt:    w.endsAt,
+		Remaining: int64((remaining + time.Second - 1) / time.Second),
+		AutoDraw:  w.autoDraw,
+	}
+}
+
+// GetLotteryWindow 前端刷新以后拿这个接上倒计时，没在定时就是 null
+func (s *LiveLotteryService) GetLotteryWindow() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.window == nil {
+		return "null", nil
+	}
+	data, err := json.Marshal(countdown(s.window, time.Now()))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"luckydraw/internal/bili"
+	"luckydraw/internal/config"
+	"luckydraw/internal/event"
+	"luckydraw/internal/live/livetest"
+)
+
+type eventLog struct {
+	mu      sync.Mutex
+	events  []string
+	draws   []event.DrawCompleted
+	notices []event.WinnerNotice
+}
+
+func (l *eventLog) Emit(name string, data ...any) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, name)
+	if d, ok := data[0].(event.DrawCompleted); ok {
+		l.draws = append(l.draws, d)
+	}
+	if n, ok := data[0].(event.WinnerNotice); ok {
+		l.notices = append(l.notices, n)
+	}
+	return true
+}
+
+func (l *eventLog) count(name string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, e := range l.events {
+		if e == name {
+			n++
+		}
+	}
+	return n
+}
+
+func newWindowTestService(t *testing.T, events *eventLog) (*LiveLotteryService, *ProfileService, *livetest.Server) {
+	srv := livetest.NewServer(livetest.Room{RoomID: 21452505, ShortID: 1, UID: 1, Title: "test"})
+	t.Cleanup(srv.Close)
+	t.Cleanup(srv.Install())
+
+	old := CountdownInterval
+	CountdownInterval = 50 * time.Millisecond
+	t.Cleanup(func() { CountdownInterval = old })
+
+	profiles := newTestProfileService(t)
+	client := bili.NewClient("DedeUserID=42; buvid3=abc")
+	s := NewLiveLotteryService(events, func(int64) (*bili.Client, error) { return client, nil }, profiles)
+	if err := s.ConnectLiveRooms([]int{1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	return s, profiles, srv
+}
+
+func TestLotteryWindowAutoDraws(t *testing.T) {
+	events := &eventLog{}
+	s, profiles, srv := newWindowTestService(t, events)
+	profile := *profiles.ActiveProfile()
+
+	window := config.LotteryWindow{EndAt: time.Now().Add(time.Second), AutoDraw: true}
+	if err := s.StartLotteryWindow("抽我", profile, window); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetLotteryWindow(); got == "null" {
+		t.Fatal("window should be running")
+	}
+	if err := srv.WaitAccepted(1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	srv.Send(livetest.Danmaku(100, "alice", "抽我"))
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && events.count(event.LiveDrawCompleted) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if events.count(event.LiveDrawCompleted) != 1 {
+		t.Fatal("window did not auto draw")
+	}
+	if events.count(event.LiveCountdown) < 2 {
+		t.Fatalf("countdown events = %d, want several", events.count(event.LiveCountdown))
+	}
+	if draw := events.draws[0]; !draw.Auto || len(draw.Winners) != 1 || draw.Winners[0].UID != 100 {
+		t.Fatalf("draw = %+v", draw)
+	}
+	if s.IsLiveLotteryRunning() {
+		t.Fatal("lottery should stop when the window ends")
+	}
+	if got, _ := s.GetLotteryWindow(); got != "null" {
+		t.Fatalf("window = %s, want null", got)
+	}
+	if len(profiles.ActiveProfile().History) != 1 {
+		t.Fatal("auto draw should be recorded in history")
+	}
+}
+
+func TestLotteryWindowReportsAutoDrawError(t *testing.T) {
+	events := &eventLog{}
+	s, profiles, _ := newWindowTestService(t, events)
+	profile := *profiles.ActiveProfile()
+	profile.Prizes = []config.PrizeTier{{Name: "一等奖", Quantity: 0}}
+
+	window := config.LotteryWindow{EndAt: time.Now().Add(200 * time.Millisecond), AutoDraw: true}
+	if err := s.StartLotteryWindow("抽我", profile, window); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && events.count(event.LiveDrawCompleted) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if events.count(event.LiveDrawCompleted) != 1 {
+		t.Fatal("failed auto draw was not reported")
+	}
+	if draw := events.draws[0]; !draw.Auto || draw.Error == "" || len(draw.Winners) != 0 {
+		t.Fatalf("draw = %+v", draw)
+	}
+	if len(profiles.ActiveProfile().History) != 0 {
+		t.Fatal("failed auto draw should not be recorded")
+	}
+}
+
+func TestLotteryWindowCancelledByManualStop(t *testing.T) {
+	events := &eventLog{}
+	s, profiles, _ := newWindowTestService(t, events)
+	profile := *profiles.ActiveProfile()
+
+	window := config.LotteryWindow{EndAt: time.Now().Add(300 * time.Millisecond), AutoDraw: true}
+	if err := s.StartLotteryWindow("抽我", profile, window); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StopLiveLottery(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if events.count(event.LiveDrawCompleted) != 0 {
+		t.Fatal("cancelled window should not draw")
+	}
+	if got, _ := s.GetLotteryWindow(); got != "null" {
+		t.Fatalf("window = %s, want null", got)
+	}
+}
+
+func TestLotteryWindowKeptOnSecondStart(t *testing.T) {
+	events := &eventLog{}
+	s, profiles, _ := newWindowTestService(t, events)
+	profile := *profiles.ActiveProfile()
+
+	window := config.LotteryWindow{EndAt: time.Now().Add(300 * time.Millisecond), AutoDraw: true}
+	if err := s.StartLotteryWindow("抽我", profile, window); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartLiveLottery("别的", profile); err == nil {
+		t.Fatal("second start should fail while the lottery is running")
+	}
+	if got, _ := s.GetLotteryWindow(); got == "null" {
+		t.Fatal("failed second start cancelled the window")
+	}
+	if s.keyword != "抽我" {
+		t.Fatalf("keyword = %q, failed start swapped the matcher", s.keyword)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && events.count(event.LiveDrawCompleted) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if events.count(event.LiveDrawCompleted) != 1 {
+		t.Fatal("window should still auto draw")
+	}
+}
+
+func TestLotteryWindowRejectsPastEnd(t *testing.T) {
+	s, profiles, _ := newWindowTestService(t, &eventLog{})
+	window := config.LotteryWindow{EndAt: time.Now().Add(-time.Minute)}
+	if err := s.StartLotteryWindow("抽我", *profiles.ActiveProfile(), window); err == nil {
+		t.Fatal("past end time should be rejected")
+	}
+}